@@ -74,7 +74,8 @@ $(pGen)/ReplacementTransformer.go: $(pSrc)/replacementtransformer/ReplacementTra
 $(pGen)/ReplicaCountTransformer.go: $(pSrc)/replicacounttransformer/ReplicaCountTransformer.go
 $(pGen)/SecretGenerator.go: $(pSrc)/secretgenerator/SecretGenerator.go
 $(pGen)/ValueAddTransformer.go: $(pSrc)/valueaddtransformer/ValueAddTransformer.go
-$(pGen)/HelmChartInflationGenerator.go: $(pSrc)/helmchartinflationgenerator/HelmChartInflationGenerator.go
+$(pGen)/HelmChartInflationGenerator.go: $(pSrc)/helmchartinflationgenerator/HelmChartInflationGenerator.go \
+	$(filter-out %_test.go,$(wildcard $(pSrc)/helmchartinflationgenerator/HelmChartInflationGenerator_*.go))
 
 # The (verbose but portable) Makefile way to convert to lowercase.
 toLowerCase = $(subst A,a,$(subst B,b,$(subst C,c,$(subst D,d,$(subst E,e,$(subst F,f,$(subst G,g,$(subst H,h,$(subst I,i,$(subst J,j,$(subst K,k,$(subst L,l,$(subst M,m,$(subst N,n,$(subst O,o,$(subst P,p,$(subst Q,q,$(subst R,r,$(subst S,s,$(subst T,t,$(subst U,u,$(subst V,v,$(subst W,w,$(subst X,x,$(subst Y,y,$(subst Z,z,$1))))))))))))))))))))))))))
@@ -86,7 +87,7 @@ $(pGen)/%.go: $(MYGOBIN)/pluginator $(MYGOBIN)/goimports
 		cd $(pSrc)/$(call toLowerCase,$*); \
 		go generate .; \
 		cd ../../../$(pGen); \
-		$(MYGOBIN)/goimports -w $*.go \
+		$(MYGOBIN)/goimports -w $*.go $$(find . -maxdepth 1 -name '$*_*.go') \
 	)
 
 # Generate builtin plugins
@@ -52,5 +52,12 @@ type KustHasher interface {
 	Hash(*yaml.RNode) (string, error)
 }
 
+// ValuesProvider fetches the values of a helm chart from an
+// external source, such as a config server or a feature-flag service.
+type ValuesProvider interface {
+	// Values returns the values of the chart for the environment.
+	Values(chart, environment string) (map[string]interface{}, error)
+}
+
 // See core.v1.SecretTypeOpaque
 const SecretTypeOpaque = "Opaque"
@@ -121,6 +121,11 @@ func (fl *FileLoader) Root() string {
 	return fl.root.String()
 }
 
+// FileSystem returns the file system the loader reads from.
+func (fl *FileLoader) FileSystem() filesys.FileSystem {
+	return fl.fSys
+}
+
 func NewLoaderOrDie(
 	lr LoadRestrictorFunc,
 	fSys filesys.FileSystem, path string) *FileLoader {
@@ -13,6 +13,7 @@ import (
 	"sigs.k8s.io/kustomize/api/resource"
 	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
@@ -163,6 +164,7 @@ var generatorConfigurators = map[builtinhelpers.BuiltinPluginType]func(
 		if kt.kustomization.HelmGlobals != nil {
 			globals = *kt.kustomization.HelmGlobals
 		}
+		var charts []chartGenerator
 		for _, chart := range kt.kustomization.HelmCharts {
 			c.HelmGlobals = globals
 			c.HelmChart = chart
@@ -171,6 +173,22 @@ var generatorConfigurators = map[builtinhelpers.BuiltinPluginType]func(
 				return nil, err
 			}
 			result = append(result, p)
+			charts = append(charts, chartGenerator{Generator: p, chart: chart.Name})
+		}
+		switch globals.CRDCollisions {
+		case "":
+		case types.HelmCRDCollisionsError, types.HelmCRDCollisionsDedupe:
+			if len(result) > 1 {
+				result = []resmap.Generator{&helmChartsGenerator{
+					charts: charts,
+					mode:   globals.CRDCollisions,
+				}}
+			}
+		default:
+			return nil, fmt.Errorf(
+				"crdCollisions must be one of [%s %s], got '%s'",
+				types.HelmCRDCollisionsError, types.HelmCRDCollisionsDedupe,
+				globals.CRDCollisions)
 		}
 		return
 	},
@@ -444,3 +462,61 @@ var transformerConfigurators = map[builtinhelpers.BuiltinPluginType]func(
 		return nil, fmt.Errorf("valueadd keyword not yet defined")
 	},
 }
+
+// chartGenerator is the generator of the named helm chart.
+type chartGenerator struct {
+	resmap.Generator
+	chart string
+}
+
+// helmChartsGenerator runs the generators of several helm charts,
+// handling the CustomResourceDefinitions rendered by more than one
+// of them according to mode.  Only identical CRDs are deduped; the
+// charts rendering differing ones are an error in either mode.
+type helmChartsGenerator struct {
+	charts []chartGenerator
+	mode   string
+}
+
+func (g *helmChartsGenerator) Generate() (resmap.ResMap, error) {
+	result := resmap.New()
+	type owned struct {
+		chart string
+		crd   *resource.Resource
+	}
+	owners := map[resid.ResId]owned{}
+	for _, c := range g.charts {
+		rm, err := c.Generate()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rm.Resources() {
+			if !isCRD(r) {
+				continue
+			}
+			owner, found := owners[r.CurId()]
+			if !found {
+				owners[r.CurId()] = owned{chart: c.chart, crd: r}
+				continue
+			}
+			if g.mode == types.HelmCRDCollisionsError {
+				return nil, fmt.Errorf(
+					"charts '%s' and '%s' both declare CustomResourceDefinition '%s'",
+					owner.chart, c.chart, r.GetName())
+			}
+			if err = owner.crd.ErrIfNotEquals(r); err != nil {
+				return nil, fmt.Errorf(
+					"charts '%s' and '%s' declare differing CustomResourceDefinitions '%s':\n%w",
+					owner.chart, c.chart, r.GetName(), err)
+			}
+		}
+		if err = result.AppendAllSkipping(rm, isCRD); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func isCRD(r *resource.Resource) bool {
+	return r.GetKind() == "CustomResourceDefinition"
+}
@@ -4,7 +4,10 @@
 package krusty_test
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -886,6 +889,235 @@ spec:
 `)
 }
 
+func TestHelmChartInflationGeneratorWithCRDCollisions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping: fake helm requires a POSIX shell")
+	}
+	th := kusttest_test.MakeEnhancedHarnessWithTmpRoot(t)
+	defer th.Reset()
+
+	// The fake helm renders the same CRD for every chart,
+	// except for a newer version of it for the release 'newer'.
+	helm := filepath.Join(th.GetRoot(), "fake-helm")
+	require.NoError(t, os.WriteFile(helm, []byte(`#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "v3.13.1+g3547a4b"
+  exit 0
+fi
+version=v1
+if [ "$2" = "newer" ]; then
+  version=v2
+fi
+cat <<YAML
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  version: $version
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: $2
+YAML
+`), 0755)) //nolint:gosec
+	for _, chart := range []string{"a", "b", "c"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(th.GetRoot(), "charts", chart), 0755))
+		th.WriteF(filepath.Join(th.GetRoot(), "charts", chart, "Chart.yaml"),
+			"apiVersion: v2\nname: "+chart+"\nversion: 1.0.0\n")
+	}
+	kustomization := `
+helmGlobals:
+  crdCollisions: %s
+helmCharts:
+- name: a
+  releaseName: first
+  includeCRDs: true
+- name: b
+  releaseName: second
+  includeCRDs: true
+`
+	o := th.MakeOptionsPluginsEnabled()
+	o.PluginConfig.HelmConfig.Command = helm
+
+	th.WriteK(th.GetRoot(), fmt.Sprintf(kustomization, "error"))
+	err := th.RunWithErr(th.GetRoot(), o)
+	require.Error(t, err)
+	require.Contains(t, err.Error(),
+		"charts 'a' and 'b' both declare CustomResourceDefinition 'widgets.example.com'")
+
+	th.WriteK(th.GetRoot(), fmt.Sprintf(kustomization, "dedupe"))
+	m := th.Run(th.GetRoot(), o)
+	th.AssertActualEqualsExpected(m, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  version: v1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+`)
+
+	// Differing CRDs aren't deduped.
+	th.WriteK(th.GetRoot(), `
+helmGlobals:
+  crdCollisions: dedupe
+helmCharts:
+- name: a
+  releaseName: first
+  includeCRDs: true
+- name: c
+  releaseName: newer
+  includeCRDs: true
+`)
+	err = th.RunWithErr(th.GetRoot(), o)
+	require.Error(t, err)
+	require.Contains(t, err.Error(),
+		"charts 'a' and 'c' declare differing CustomResourceDefinitions 'widgets.example.com'")
+}
+
+func TestHelmChartInflationGeneratorWithCRDCollisionsAcrossGroups(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping: fake helm requires a POSIX shell")
+	}
+	th := kusttest_test.MakeEnhancedHarnessWithTmpRoot(t)
+	defer th.Reset()
+
+	// The fake helm renders a CRD of the same name, but in the
+	// group named by the release, for every chart.
+	helm := filepath.Join(th.GetRoot(), "fake-helm")
+	require.NoError(t, os.WriteFile(helm, []byte(`#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "v3.13.1+g3547a4b"
+  exit 0
+fi
+cat <<YAML
+apiVersion: $2/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+YAML
+`), 0755)) //nolint:gosec
+	for _, chart := range []string{"a", "b"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(th.GetRoot(), "charts", chart), 0755))
+		th.WriteF(filepath.Join(th.GetRoot(), "charts", chart, "Chart.yaml"),
+			"apiVersion: v2\nname: "+chart+"\nversion: 1.0.0\n")
+	}
+	th.WriteK(th.GetRoot(), `
+helmGlobals:
+  crdCollisions: error
+helmCharts:
+- name: a
+  releaseName: apiextensions.k8s.io
+  includeCRDs: true
+- name: b
+  releaseName: example.com
+  includeCRDs: true
+`)
+	o := th.MakeOptionsPluginsEnabled()
+	o.PluginConfig.HelmConfig.Command = helm
+	m := th.Run(th.GetRoot(), o)
+	th.AssertActualEqualsExpected(m, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+apiVersion: example.com/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`)
+}
+
+func TestHelmChartInflationGeneratorWithMergeWithExisting(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping: fake helm requires a POSIX shell")
+	}
+	th := kusttest_test.MakeEnhancedHarnessWithTmpRoot(t)
+	defer th.Reset()
+
+	helm := filepath.Join(th.GetRoot(), "fake-helm")
+	require.NoError(t, os.WriteFile(helm, []byte(`#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "v3.13.1+g3547a4b"
+  exit 0
+fi
+cat <<YAML
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+YAML
+`), 0755)) //nolint:gosec
+	require.NoError(t, os.MkdirAll(filepath.Join(th.GetRoot(), "charts", "web"), 0755))
+	th.WriteF(filepath.Join(th.GetRoot(), "charts", "web", "Chart.yaml"),
+		"apiVersion: v2\nname: web\nversion: 1.0.0\n")
+	th.WriteF(filepath.Join(th.GetRoot(), "deployment.yaml"), `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: web
+        env:
+        - name: MODE
+          value: production
+`)
+	th.WriteK(th.GetRoot(), `
+resources:
+- deployment.yaml
+helmCharts:
+- name: web
+  releaseName: web
+  mergeWithExisting: true
+`)
+	o := th.MakeOptionsPluginsEnabled()
+	o.PluginConfig.HelmConfig.Command = helm
+	m := th.Run(th.GetRoot(), o)
+	th.AssertActualEqualsExpected(m, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app: web
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - env:
+        - name: MODE
+          value: production
+        image: nginx:1.25
+        name: web
+`)
+}
+
 func copyValuesFilesTestChartsIntoHarness(t *testing.T, th *kusttest_test.HarnessEnhanced) {
 	t.Helper()
 
@@ -896,3 +1128,91 @@ func copyValuesFilesTestChartsIntoHarness(t *testing.T, th *kusttest_test.Harnes
 	require.NoError(t, fs.MkdirAll(filepath.Join(thDir, "templates")))
 	require.NoError(t, copyutil.CopyDir(th.GetFSys(), chartDir, thDir))
 }
+
+func TestHelmChartInflationGeneratorWithSharedValues(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping: fake helm requires a POSIX shell")
+	}
+	th := kusttest_test.MakeEnhancedHarnessWithTmpRoot(t)
+	defer th.Reset()
+
+	// The fake helm renders the values file it's given.
+	helm := filepath.Join(th.GetRoot(), "fake-helm")
+	require.NoError(t, os.WriteFile(helm, []byte(`#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "v3.13.1+g3547a4b"
+  exit 0
+fi
+name=$2
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-f" ]; then
+    values=$2
+  fi
+  shift
+done
+cat <<YAML
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: $name
+data:
+  values: |
+$(sed 's/^/    /' "$values")
+YAML
+`), 0755)) //nolint:gosec
+	for _, chart := range []string{"api", "web"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(th.GetRoot(), "charts", chart), 0755))
+		th.WriteF(filepath.Join(th.GetRoot(), "charts", chart, "Chart.yaml"),
+			"apiVersion: v2\nname: "+chart+"\nversion: 1.0.0\n")
+		th.WriteF(filepath.Join(th.GetRoot(), "charts", chart, "values.yaml"), "replicas: 1\n")
+	}
+	th.WriteF(filepath.Join(th.GetRoot(), "shared.yaml"), `
+domain: example.com
+image:
+  registry: registry.example.com
+`)
+	th.WriteK(th.GetRoot(), `
+helmGlobals:
+  sharedValuesFile: shared.yaml
+  sharedValues:
+    image:
+      pullPolicy: IfNotPresent
+helmCharts:
+- name: api
+  releaseName: api
+- name: web
+  releaseName: web
+  valuesInline:
+    domain: web.example.com
+    image:
+      pullPolicy: Always
+`)
+	o := th.MakeOptionsPluginsEnabled()
+	o.PluginConfig.HelmConfig.Command = helm
+	m := th.Run(th.GetRoot(), o)
+	th.AssertActualEqualsExpected(m, `
+apiVersion: v1
+data:
+  values: |
+    replicas: 1
+    domain: example.com
+    image:
+      pullPolicy: IfNotPresent
+      registry: registry.example.com
+kind: ConfigMap
+metadata:
+  name: api
+---
+apiVersion: v1
+data:
+  values: |
+    replicas: 1
+    domain: web.example.com
+    image:
+      pullPolicy: Always
+      registry: registry.example.com
+kind: ConfigMap
+metadata:
+  name: web
+`)
+}
@@ -9,6 +9,7 @@ import (
 	"sigs.k8s.io/kustomize/api/ifc"
 	"sigs.k8s.io/kustomize/api/resource"
 	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/resid"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
@@ -72,6 +73,16 @@ func (c *PluginHelpers) Loader() ifc.Loader {
 	return c.ldr
 }
 
+// FileSystem returns the file system the loader reads from, so
+// that plugins write their files next to the ones they read.  It
+// falls back to the file system on disk for loaders without one.
+func (c *PluginHelpers) FileSystem() filesys.FileSystem {
+	if l, ok := c.ldr.(interface{ FileSystem() filesys.FileSystem }); ok {
+		return l.FileSystem()
+	}
+	return filesys.MakeFsOnDisk()
+}
+
 func (c *PluginHelpers) ResmapFactory() *Factory {
 	return c.rf
 }
@@ -137,6 +148,14 @@ type ResMap interface {
 	// failing on any CurId collision.
 	AppendAll(ResMap) error
 
+	// AppendAllSkipping appends another ResMap to self, like
+	// AppendAll, except that a resource the skip function
+	// returns true for is dropped if self already holds an
+	// identical one, e.g. to keep only the first of identical
+	// resources rendered by several sources.  A resource that
+	// differs from the one of its CurId is still an error.
+	AppendAllSkipping(other ResMap, skip func(*resource.Resource) bool) error
+
 	// AbsorbAll appends, replaces or merges the contents
 	// of another ResMap into self,
 	// allowing and sometimes demanding ID collisions.
@@ -472,6 +472,26 @@ func (m *resWrangler) appendAll(list []*resource.Resource) error {
 	return nil
 }
 
+// AppendAllSkipping implements ResMap.
+func (m *resWrangler) AppendAllSkipping(
+	other ResMap, skip func(*resource.Resource) bool) error {
+	if other == nil {
+		return nil
+	}
+	for _, res := range other.Resources() {
+		if skip(res) {
+			matches := m.GetMatchingResourcesByCurrentId(res.CurId().Equals)
+			if len(matches) == 1 && matches[0].ErrIfNotEquals(res) == nil {
+				continue
+			}
+		}
+		if err := m.Append(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AbsorbAll implements ResMap.
 func (m *resWrangler) AbsorbAll(other ResMap) error {
 	if other == nil {
@@ -575,10 +595,14 @@ func (m *resWrangler) appendReplaceOrMerge(res *resource.Resource) error {
 		if index < 0 {
 			return fmt.Errorf("indexing problem")
 		}
-		switch res.Behavior() {
-		case types.BehaviorReplace:
+		switch {
+		case res.MergesWithExisting():
+			if err := res.ApplySmPatch(old); err != nil {
+				return err
+			}
+		case res.Behavior() == types.BehaviorReplace:
 			res.CopyMergeMetaDataFieldsFrom(old)
-		case types.BehaviorMerge:
+		case res.Behavior() == types.BehaviorMerge:
 			// ensure the origin annotation doesn't get overwritten
 			orig, err := old.GetOrigin()
 			if err != nil {
@@ -822,6 +822,47 @@ func TestAppendAll(t *testing.T) {
 	}
 }
 
+func TestAppendAllSkipping(t *testing.T) {
+	crd := func(apiVersion string) *resource.Resource {
+		return rf.FromMap(map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]interface{}{
+				"name": "widgets.example.com",
+			},
+		})
+	}
+	isCRD := func(r *resource.Resource) bool {
+		return r.GetKind() == "CustomResourceDefinition"
+	}
+	w := New()
+	assert.NoError(t, w.AppendAllSkipping(
+		rmF.FromResourceSlice([]*resource.Resource{crd("apiextensions.k8s.io/v1"), makeCm(1)}), isCRD))
+
+	// The CRD of the same id is skipped, the one of another group is not.
+	assert.NoError(t, w.AppendAllSkipping(
+		rmF.FromResourceSlice([]*resource.Resource{
+			crd("apiextensions.k8s.io/v1"), crd("example.com/v1"), makeCm(2)}), isCRD))
+	var ids []string
+	for _, r := range w.Resources() {
+		ids = append(ids, r.CurId().String())
+	}
+	assert.Equal(t, []string{
+		"CustomResourceDefinition.v1.apiextensions.k8s.io/widgets.example.com.[noNs]",
+		"ConfigMap.v1.[noGrp]/cm001.[noNs]",
+		"CustomResourceDefinition.v1.example.com/widgets.example.com.[noNs]",
+		"ConfigMap.v1.[noGrp]/cm002.[noNs]",
+	}, ids)
+
+	// Other collisions are still errors, as are differing CRDs.
+	err := w.AppendAllSkipping(rmF.FromResource(makeCm(1)), isCRD)
+	assert.ErrorContains(t, err, "may not add resource with an already registered id")
+	differing := crd("apiextensions.k8s.io/v1")
+	differing.SetLabels(map[string]string{"version": "v2"})
+	err = w.AppendAllSkipping(rmF.FromResource(differing), isCRD)
+	assert.ErrorContains(t, err, "may not add resource with an already registered id")
+}
+
 func makeMap1(t *testing.T) ResMap {
 	t.Helper()
 	r, err := rf.FromMapAndOption(
@@ -37,6 +37,7 @@ var BuildAnnotations = []string{
 	utils.BuildAnnotationsRefBy,
 	utils.BuildAnnotationsGenBehavior,
 	utils.BuildAnnotationsGenAddHashSuffix,
+	utils.BuildAnnotationsMergeWithExisting,
 
 	kioutil.PathAnnotation,
 	kioutil.IndexAnnotation,
@@ -410,6 +411,19 @@ func (r *Resource) EnableHashSuffix() {
 	r.enable(utils.BuildAnnotationsGenAddHashSuffix)
 }
 
+// MergesWithExisting returns true if a resource with the same id
+// that is already in a ResMap is to be merged into this resource
+// as a strategic merge patch, rather than conflict with it.
+func (r *Resource) MergesWithExisting() bool {
+	return r.isEnabled(utils.BuildAnnotationsMergeWithExisting)
+}
+
+// EnableMergeWithExisting marks the resource as merging with
+// an existing resource with the same id.
+func (r *Resource) EnableMergeWithExisting() {
+	r.enable(utils.BuildAnnotationsMergeWithExisting)
+}
+
 // OrgId returns the original, immutable ResId for the resource.
 // This doesn't have to be unique in a ResMap.
 func (r *Resource) OrgId() resid.ResId {
@@ -174,6 +174,34 @@ func (th *HarnessEnhanced) LoadAndRunGeneratorWithBuildAnnotations(
 	return rm
 }
 
+func (th *HarnessEnhanced) LoadGenerator(config string) resmap.Generator {
+	res, err := th.rf.RF().FromBytes([]byte(config))
+	if err != nil {
+		th.t.Fatalf("Err: %v", err)
+	}
+	g, err := th.pl.LoadGenerator(
+		th.ldr, valtest_test.MakeFakeValidator(), res)
+	if err != nil {
+		th.t.Fatalf("Err: %v", err)
+	}
+	return g
+}
+
+func (th *HarnessEnhanced) ErrorFromLoadAndRunGenerator(
+	config string) error {
+	res, err := th.rf.RF().FromBytes([]byte(config))
+	if err != nil {
+		th.t.Fatalf("Err: %v", err)
+	}
+	g, err := th.pl.LoadGenerator(
+		th.ldr, valtest_test.MakeFakeValidator(), res)
+	if err != nil {
+		return err
+	}
+	_, err = g.Generate()
+	return err
+}
+
 func (th *HarnessEnhanced) LoadAndRunTransformer(
 	config, input string) resmap.ResMap {
 	resMap, err := th.RunTransformer(config, input)
@@ -3,10 +3,21 @@
 
 package types
 
-import "path/filepath"
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 const HelmDefaultHome = "charts"
 
+// Legal values of HelmChart.LookupMode.
+const (
+	HelmLookupModeOffline = "offline"
+	HelmLookupModeCluster = "cluster"
+)
+
 type HelmGlobals struct {
 	// ChartHome is a file path, relative to the kustomization root,
 	// to a directory containing a subdirectory for each chart to be
@@ -32,8 +43,58 @@ type HelmGlobals struct {
 	//   HELM_DATA_HOME={ConfigHome}/.data
 	// for the helm subprocess.
 	ConfigHome string `json:"configHome,omitempty" yaml:"configHome,omitempty"`
+
+	// PluginsHome is a directory of helm plugins, e.g. the downloader
+	// plugins that let helm pull charts from 's3://' or 'gs://' URLs,
+	// that kustomize passes to helm via the HELM_PLUGINS environment
+	// variable.  A relative path is relative to the kustomization root.
+	// If omitted, helm looks for plugins in {ConfigHome}/.data/plugins.
+	PluginsHome string `json:"pluginsHome,omitempty" yaml:"pluginsHome,omitempty"`
+
+	// MaxPullConcurrency bounds the number of 'helm pull' invocations
+	// that may run at the same time, counting those of all charts with
+	// the same bound.  Zero means no bound.
+	MaxPullConcurrency int `json:"maxPullConcurrency,omitempty" yaml:"maxPullConcurrency,omitempty"`
+
+	// MaxTemplateConcurrency bounds the number of 'helm template'
+	// invocations that may run at the same time, counting those of all
+	// charts with the same bound.  Zero means no bound.
+	MaxTemplateConcurrency int `json:"maxTemplateConcurrency,omitempty" yaml:"maxTemplateConcurrency,omitempty"`
+
+	// CRDCollisions handles a CustomResourceDefinition rendered by more
+	// than one of the HelmCharts, e.g. because each ships it with
+	// IncludeCRDs, which can't be applied twice.  Legal values: 'error',
+	// to fail naming the charts, and 'dedupe', to keep the CRD of the
+	// first chart only, if the charts' CRDs are identical; differing ones
+	// fail naming the charts.  Omit to fail on the conflicting resource ids.
+	CRDCollisions string `json:"crdCollisions,omitempty" yaml:"crdCollisions,omitempty"`
+
+	// DefaultRepoURL is the chart repository given to the charts of the
+	// deprecated helmChartInflationGenerator field that set no
+	// chartRepoUrl, and so relied on the default 'stable' repository,
+	// which no longer exists, when they're converted to HelmCharts.
+	DefaultRepoURL string `json:"defaultRepoURL,omitempty" yaml:"defaultRepoURL,omitempty"` //nolint: tagliatelle
+
+	// SharedValuesFile is a local file path to values shared by all of
+	// the HelmCharts, e.g. the image registry or the domain.
+	SharedValuesFile string `json:"sharedValuesFile,omitempty" yaml:"sharedValuesFile,omitempty"`
+
+	// SharedValues are values shared by all of the HelmCharts, merged
+	// over SharedValuesFile.  The shared values underlie each chart's
+	// ValuesInline, so that the chart's own values override them.
+	SharedValues map[string]interface{} `json:"sharedValues,omitempty" yaml:"sharedValues,omitempty"`
 }
 
+// HelmDefaultRepoName is the name of the chart repository that the
+// deprecated HelmChartArgs default to.
+const HelmDefaultRepoName = "stable"
+
+// Legal values of HelmGlobals.CRDCollisions.
+const (
+	HelmCRDCollisionsError  = "error"
+	HelmCRDCollisionsDedupe = "dedupe"
+)
+
 type HelmChart struct {
 	// Name is the name of the chart, e.g. 'minecraft'.
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
@@ -41,11 +102,98 @@ type HelmChart struct {
 	// Version is the version of the chart, e.g. '3.1.3'
 	Version string `json:"version,omitempty" yaml:"version,omitempty"`
 
+	// FallbackVersion is the version of the chart to pull if Version
+	// isn't found in Repo, e.g. because it was pruned.
+	FallbackVersion string `json:"fallbackVersion,omitempty" yaml:"fallbackVersion,omitempty"`
+
+	// RefreshIndexOnMiss retries the pull once, with an empty repository
+	// cache so that helm fetches the index again, if the chart version
+	// isn't found, as happens when the cached repository index is stale.
+	// It's tried before FallbackVersion.
+	RefreshIndexOnMiss bool `json:"refreshIndexOnMiss,omitempty" yaml:"refreshIndexOnMiss,omitempty"`
+
+	// RefreshOnChecksumMismatch clears the cached repository indexes and
+	// retries the pull once if helm reports a checksum mismatch, as
+	// happens when a cached index is corrupted.
+	RefreshOnChecksumMismatch bool `json:"refreshOnChecksumMismatch,omitempty" yaml:"refreshOnChecksumMismatch,omitempty"`
+
 	// Repo is a URL locating the chart on the internet.
 	// This is the argument to helm's  `--repo` flag, e.g.
 	// `https://itzg.github.io/minecraft-server-charts`.
+	// The URL of a packaged chart, ending in '.tgz', is instead passed to
+	// 'helm pull' as is, e.g. 's3://charts/minecraft-3.1.3.tgz' for a
+	// protocol handled by a downloader plugin (see PluginsHome).
 	Repo string `json:"repo,omitempty" yaml:"repo,omitempty"`
 
+	// RegistryCAFile is a local file path to a CA bundle used to verify
+	// the TLS certificate of the OCI registry when Repo is an 'oci://'
+	// reference.
+	RegistryCAFile string `json:"registryCAFile,omitempty" yaml:"registryCAFile,omitempty"` //nolint: tagliatelle
+
+	// RegistryMirror is the host, optionally followed by a path, of a
+	// pull-through mirror, e.g. 'mirror.example.com/cache', to pull
+	// 'oci://' charts and dependencies from instead of their registry.
+	// The registry host of a reference is replaced by the mirror,
+	// keeping the repository path, version and digest, so that
+	// 'oci://registry.example.com/charts/app' is pulled from
+	// 'oci://mirror.example.com/cache/charts/app'.
+	RegistryMirror string `json:"registryMirror,omitempty" yaml:"registryMirror,omitempty"`
+
+	// CosignVerify verifies the signature of an 'oci://' chart with
+	// cosign before pulling it, failing if verification fails.  The
+	// chart is then pulled by the digest that was verified, from
+	// RegistryMirror if set.  Requires --enable-exec.
+	CosignVerify *HelmCosignVerify `json:"cosignVerify,omitempty" yaml:"cosignVerify,omitempty"`
+
+	// ChartTarball is a local file path to a packaged chart, e.g.
+	// 'vendor/minecraft-3.1.3.tgz', to inflate instead of looking up the
+	// chart in ChartHome.  The tarball is extracted into a temporary
+	// directory.
+	ChartTarball string `json:"chartTarball,omitempty" yaml:"chartTarball,omitempty"`
+
+	// ChartTarballData is a base64 encoded packaged chart to inflate,
+	// vendoring the chart within the generator configuration.
+	// Mutually exclusive with ChartTarball.
+	ChartTarballData string `json:"chartTarballData,omitempty" yaml:"chartTarballData,omitempty"`
+
+	// ProvenanceFile is a local file path to the provenance file ('.prov')
+	// of ChartTarball.  If set, the tarball is verified with
+	// 'helm verify' against Keyring before it's extracted.
+	ProvenanceFile string `json:"provenanceFile,omitempty" yaml:"provenanceFile,omitempty"`
+
+	// Keyring is a local file path to the keyring holding the public keys
+	// used to verify ProvenanceFile.
+	Keyring string `json:"keyring,omitempty" yaml:"keyring,omitempty"`
+
+	// MaxChartBytes bounds both the size of the chart tarball and the
+	// total size of the files extracted from it, guarding against
+	// decompression bombs in untrusted charts.  Zero means no bound.
+	MaxChartBytes int64 `json:"maxChartBytes,omitempty" yaml:"maxChartBytes,omitempty"`
+
+	// FollowSymlinks allows the charts extracted by kustomize, i.e.
+	// ChartTarball, ChartTarballData and charts pulled with MaxChartBytes,
+	// to contain symlinks pointing outside of ChartHome.  By default such
+	// symlinks are rejected, as a malicious chart could use them to read
+	// or overwrite files elsewhere.  Symlinks within ChartHome are fine.
+	// Either way, no entry is ever extracted through a symlink.
+	FollowSymlinks bool `json:"followSymlinks,omitempty" yaml:"followSymlinks,omitempty"`
+
+	// FetchDependencies fetches the dependencies declared in the chart's
+	// Chart.yaml that are missing from its 'charts' directory.  Fetched
+	// dependencies are cached in '{ChartHome}/.dependencies', their
+	// tarballs stored by sha256 digest in 'sha256' and referenced by
+	// name and version, so charts sharing a dependency fetch it, and
+	// the cache stores it, only once.  Version ranges are resolved
+	// against the repository first, and cached by the version they
+	// resolve to.
+	FetchDependencies bool `json:"fetchDependencies,omitempty" yaml:"fetchDependencies,omitempty"`
+
+	// CacheMaxBytes bounds the total size of the tarballs in the
+	// dependency cache.  When a fetch exceeds it, the least recently
+	// used tarballs are evicted, and fetched again if needed later.
+	// Zero means no bound.
+	CacheMaxBytes int64 `json:"cacheMaxBytes,omitempty" yaml:"cacheMaxBytes,omitempty"`
+
 	// ReleaseName replaces RELEASE-NAME in chart template output,
 	// making a particular inflation of a chart unique with respect to
 	// other inflations of the same chart in a cluster. It's the first
@@ -55,10 +203,64 @@ type HelmChart struct {
 	// If omitted, the flag --generate-name is passed to 'helm template'.
 	ReleaseName string `json:"releaseName,omitempty" yaml:"releaseName,omitempty"`
 
+	// ReleaseService overrides .Release.Service, which helm always sets
+	// to 'Helm'.  As helm has no flag for it, the value is applied after
+	// rendering instead: the 'app.kubernetes.io/managed-by' label of
+	// every inflated resource that carries it is set to ReleaseService.
+	ReleaseService string `json:"releaseService,omitempty" yaml:"releaseService,omitempty"`
+
+	// ReleaseRevision overrides .Release.Revision, which 'helm template'
+	// always sets to 1.  As no helm 3 version has a flag for it, nor can
+	// it be applied after rendering, the chart is rendered from a copy of
+	// it whose templates, including those of unpacked subcharts, have
+	// .Release.Revision replaced by ReleaseRevision.  Subcharts packed as
+	// tarballs are left alone.  Zero leaves the revision to helm.
+	ReleaseRevision int `json:"releaseRevision,omitempty" yaml:"releaseRevision,omitempty"`
+
+	// ReleaseNamePattern is a regular expression that ReleaseName must
+	// match, e.g. '^[a-z0-9]([-a-z0-9]*[a-z0-9])?$' to enforce lower case
+	// DNS-1123 names.  The pattern isn't anchored unless it says so.
+	ReleaseNamePattern string `json:"releaseNamePattern,omitempty" yaml:"releaseNamePattern,omitempty"`
+
+	// EnforceInstanceLabel sets the 'app.kubernetes.io/instance' label of
+	// every inflated resource to ReleaseName, overriding the chart, for
+	// tooling that selects the resources of a release by it.  Selectors
+	// are left alone, as changing them could orphan existing pods.
+	EnforceInstanceLabel bool `json:"enforceInstanceLabel,omitempty" yaml:"enforceInstanceLabel,omitempty"`
+
+	// FixedNow is an RFC3339 time, e.g. '2000-01-01T00:00:00Z', to which
+	// timestamps rendered by the chart, e.g. with 'now', are pinned so
+	// that the output doesn't differ between builds and machines.  Helm
+	// can't be told what time it is, so the inflated resources are
+	// post-processed instead: any annotation or label value, of a
+	// resource or of the pods it templates, that is a timestamp in
+	// RFC3339 or in the default format of 'now' is replaced.  Timestamps
+	// elsewhere, e.g. in the data of a ConfigMap, in other formats, or
+	// embedded in longer strings, are left alone.
+	FixedNow string `json:"fixedNow,omitempty" yaml:"fixedNow,omitempty"`
+
 	// Namespace set the target namespace for a release. It is .Release.Namespace
 	// in the helm template
 	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 
+	// CreateNamespace adds a Namespace resource for Namespace to the
+	// inflated resources, unless the chart renders one itself.
+	CreateNamespace bool `json:"createNamespace,omitempty" yaml:"createNamespace,omitempty"`
+
+	// NamespaceLabels are labels to set on the Namespace created by
+	// CreateNamespace, e.g. pod security admission labels.
+	NamespaceLabels map[string]string `json:"namespaceLabels,omitempty" yaml:"namespaceLabels,omitempty"`
+
+	// NamespaceAnnotations are annotations to set on the Namespace
+	// created by CreateNamespace.
+	NamespaceAnnotations map[string]string `json:"namespaceAnnotations,omitempty" yaml:"namespaceAnnotations,omitempty"`
+
+	// DefaultDenyNetworkPolicy adds a NetworkPolicy named
+	// '{ReleaseName}-default-deny' to Namespace, denying all ingress and
+	// egress traffic of its pods that no other policy allows, unless the
+	// chart renders such a policy, i.e. one with an empty podSelector.
+	DefaultDenyNetworkPolicy bool `json:"defaultDenyNetworkPolicy,omitempty" yaml:"defaultDenyNetworkPolicy,omitempty"`
+
 	// AdditionalValuesFiles are local file paths to values files to be used in
 	// addition to either the default values file or the values specified in ValuesFile.
 	AdditionalValuesFiles []string `json:"additionalValuesFiles,omitempty" yaml:"additionalValuesFiles,omitempty"`
@@ -68,15 +270,110 @@ type HelmChart struct {
 	// The default values are in '{ChartHome}/{Name}/values.yaml'.
 	ValuesFile string `json:"valuesFile,omitempty" yaml:"valuesFile,omitempty"`
 
+	// ChartValuesFile is the name of a values file shipped within the
+	// chart, e.g. 'values-prod.yaml', to use instead of the chart's
+	// 'values.yaml'.  Mutually exclusive with ValuesFile.
+	ChartValuesFile string `json:"chartValuesFile,omitempty" yaml:"chartValuesFile,omitempty"`
+
+	// ValuesLayers names values layers, e.g. ['base', 'region', 'cluster'],
+	// each mapped to a values file by ValuesLayerPattern.  The layers are
+	// applied in order after AdditionalValuesFiles, so the last layer
+	// wins on conflicts.
+	ValuesLayers []string `json:"valuesLayers,omitempty" yaml:"valuesLayers,omitempty"`
+
+	// ValuesLayerPattern maps a values layer to a local file path by
+	// replacing '{layer}' with the layer name.
+	// Defaults to 'values-{layer}.yaml'.
+	ValuesLayerPattern string `json:"valuesLayerPattern,omitempty" yaml:"valuesLayerPattern,omitempty"`
+
 	// ValuesInline holds value mappings specified directly,
 	// rather than in a separate file.
 	ValuesInline map[string]interface{} `json:"valuesInline,omitempty" yaml:"valuesInline,omitempty"`
 
+	// ValuesEnvironment is the environment, e.g. 'staging', for which
+	// the generator's ValuesProvider, if one is set programmatically,
+	// fetches the chart's values.  ValuesInline is merged over them.
+	ValuesEnvironment string `json:"valuesEnvironment,omitempty" yaml:"valuesEnvironment,omitempty"`
+
 	// ValuesMerge specifies how to treat ValuesInline with respect to Values.
 	// Legal values: 'merge', 'override', 'replace'.
 	// Defaults to 'override'.
 	ValuesMerge string `json:"valuesMerge,omitempty" yaml:"valuesMerge,omitempty"`
 
+	// ValuesMatrix holds sets of values, each merged into ValuesInline for
+	// one inflation of the chart by the generator's GenerateMatrix method,
+	// which returns the resources of each.  It's meant for chart authors
+	// testing a chart against a number of configurations, and is ignored
+	// by a normal inflation.
+	ValuesMatrix []map[string]interface{} `json:"valuesMatrix,omitempty" yaml:"valuesMatrix,omitempty"`
+
+	// ValuesVars are variables that, referenced as '${NAME}' in the string
+	// values of ValuesInline, are replaced by a field of one of the
+	// resources in ValuesVarsFiles, e.g. the clusterIP of a Service.  A
+	// value that is nothing but the reference takes the type of the field;
+	// only scalar fields may be embedded in a longer string.
+	ValuesVars []Var `json:"valuesVars,omitempty" yaml:"valuesVars,omitempty"`
+
+	// ValuesVarsFiles are file paths, relative to the kustomization root,
+	// to the resources that ValuesVars refer to.  The resources are read
+	// as written in the files: they're not the resources of the build, so
+	// its transformations, such as namePrefix or namespace, don't apply,
+	// and ValuesVars must refer to them by their names in the files.
+	ValuesVarsFiles []string `json:"valuesVarsFiles,omitempty" yaml:"valuesVarsFiles,omitempty"`
+
+	// SetValues are values given as 'key=value', passed to helm with --set.
+	// A value of the form '@path', e.g. 'config=@files/app.conf', names a
+	// local file whose content becomes the value, and is passed to helm
+	// with --set-file instead.
+	SetValues []string `json:"setValues,omitempty" yaml:"setValues,omitempty"`
+
+	// RemoveValuesKeys are dotted paths, e.g. 'auth.password', of values
+	// to remove from the chart's defaults, so that they must be provided,
+	// e.g. in AdditionalValuesFiles.  The keys are set to null in the
+	// values file given to helm, which makes helm drop them.
+	RemoveValuesKeys []string `json:"removeValuesKeys,omitempty" yaml:"removeValuesKeys,omitempty"`
+
+	// SecretValuesKeys are dotted paths, e.g. 'db.password', of values
+	// holding secrets, which RedactValuesInErrors keeps out of errors.
+	SecretValuesKeys []string `json:"secretValuesKeys,omitempty" yaml:"secretValuesKeys,omitempty"`
+
+	// RedactValuesInErrors replaces the values of SecretValuesKeys, as
+	// given in the values files, ValuesInline or SetValues, with
+	// '[redacted]' in the errors of the inflation, e.g. in the helm
+	// command line and output quoted when helm fails, so that they
+	// don't leak into CI logs.  Defaults to true.
+	RedactValuesInErrors *bool `json:"redactValuesInErrors,omitempty" yaml:"redactValuesInErrors,omitempty"`
+
+	// PrecheckRequired looks for the values the chart's templates demand
+	// with 'required "message" .Values.x', and, before rendering, reports
+	// all of those that none of the values files or set values provide in
+	// one error, rather than helm failing on the first of them.
+	PrecheckRequired bool `json:"precheckRequired,omitempty" yaml:"precheckRequired,omitempty"`
+
+	// ValidateValuesSchema validates the merged values against the
+	// chart's values.schema.json before rendering, and reports all
+	// violations, located by JSON pointer, in one error.  Schemas using
+	// keywords newer than draft 4, such as 'const' or 'if', are an error.
+	ValidateValuesSchema bool `json:"validateValuesSchema,omitempty" yaml:"validateValuesSchema,omitempty"`
+
+	// ReportUnusedValues reports the provided values, from ValuesFile,
+	// AdditionalValuesFiles, ValuesInline and SetValues, that the chart's
+	// templates don't appear to reference, e.g. misspelled override keys.
+	// The templates are searched heuristically for '.Values.x' references.
+	// Legal values: 'warn', 'error'.  Omit to skip the check.
+	ReportUnusedValues string `json:"reportUnusedValues,omitempty" yaml:"reportUnusedValues,omitempty"`
+
+	// StrictValuesMerge merges the chart's default values and the values
+	// files before rendering, and fails if a key is a map in one of them
+	// but a scalar or list in another, which helm silently resolves by
+	// letting the later file win.
+	StrictValuesMerge bool `json:"strictValuesMerge,omitempty" yaml:"strictValuesMerge,omitempty"`
+
+	// Tags enable or disable the chart's dependencies by the tags
+	// declared for them in Chart.yaml.  They're passed to helm as
+	// '--set tags.{name}={bool}', and must be declared by the chart.
+	Tags map[string]bool `json:"tags,omitempty" yaml:"tags,omitempty"`
+
 	// IncludeCRDs specifies if Helm should also generate CustomResourceDefinitions.
 	// Defaults to 'false'.
 	IncludeCRDs bool `json:"includeCRDs,omitempty" yaml:"includeCRDs,omitempty"` //nolint: tagliatelle
@@ -85,17 +382,548 @@ type HelmChart struct {
 	// helm from erroneously rendering test templates.
 	SkipHooks bool `json:"skipHooks,omitempty" yaml:"skipHooks,omitempty"`
 
+	// DropAnnotations are annotation keys, e.g. of custom hooks, that
+	// mark resources to leave out: any inflated resource carrying one
+	// of them, whatever its value, is removed after rendering.
+	DropAnnotations []string `json:"dropAnnotations,omitempty" yaml:"dropAnnotations,omitempty"`
+
+	// FocusWorkload is the 'Kind/name' of an inflated workload, e.g.
+	// 'Deployment/web'.  If set, only that workload is kept, along with
+	// the ConfigMaps, Secrets and ServiceAccount it references and the
+	// Services selecting its pods, so as to deploy it on its own.
+	FocusWorkload string `json:"focusWorkload,omitempty" yaml:"focusWorkload,omitempty"`
+
+	// StripServerFields removes the fields that are managed by the API
+	// server, and cause noise when applied or diffed, from the inflated
+	// resources: the status, metadata such as creationTimestamp, also in
+	// pod templates, and empty annotations.  Defaults to true; set it to
+	// false to keep the resources as the chart renders them.
+	StripServerFields *bool `json:"stripServerFields,omitempty" yaml:"stripServerFields,omitempty"`
+
 	// ApiVersions is the kubernetes apiversions used for Capabilities.APIVersions
 	ApiVersions []string `json:"apiVersions,omitempty" yaml:"apiVersions,omitempty"`
 
 	// KubeVersion is the kubernetes version used by Helm for Capabilities.KubeVersion"
 	KubeVersion string `json:"kubeVersion,omitempty" yaml:"kubeVersion,omitempty"`
 
+	// WarnDeprecatedAPIs annotates inflated resources using an API version
+	// that is removed in KubeVersion, or in any known kubernetes version if
+	// KubeVersion is unset, with the API version to migrate to.
+	WarnDeprecatedAPIs bool `json:"warnDeprecatedAPIs,omitempty" yaml:"warnDeprecatedAPIs,omitempty"` //nolint: tagliatelle
+
 	// NameTemplate is for specifying the name template used to name the release.
 	NameTemplate string `json:"nameTemplate,omitempty" yaml:"nameTemplate,omitempty"`
 
 	// SkipTests skips tests from templated output.
 	SkipTests bool `json:"skipTests,omitempty" yaml:"skipTests,omitempty"`
+
+	// TestHooksOutputFile is a file path, relative to the kustomization
+	// root.  If set, helm test hooks are removed from the inflated
+	// resources and written to this file instead, so that they can be
+	// applied separately, e.g. as post-deploy smoke tests.
+	TestHooksOutputFile string `json:"testHooksOutputFile,omitempty" yaml:"testHooksOutputFile,omitempty"`
+
+	// Validate sets the --validate flag when calling helm template, so that
+	// the manifests are validated against the Kubernetes cluster that is
+	// currently pointed at.
+	Validate bool `json:"validate,omitempty" yaml:"validate,omitempty"`
+
+	// KubeContext is the name of the kubeconfig context to validate against.
+	// It is only passed to helm when Validate is true.
+	KubeContext string `json:"kubeContext,omitempty" yaml:"kubeContext,omitempty"`
+
+	// LookupMode specifies what the chart's 'lookup' template function
+	// returns.  Legal values: 'offline', where lookups return empty
+	// results as usual for 'helm template', and 'cluster', where they
+	// query the cluster of Kubeconfig.  Defaults to 'offline'.  'cluster'
+	// passes --dry-run=server to helm, so it requires helm v3.13 or newer.
+	LookupMode string `json:"lookupMode,omitempty" yaml:"lookupMode,omitempty"`
+
+	// Kubeconfig is a file path, relative to the kustomization root or
+	// absolute, to the kubeconfig helm uses to connect to a cluster, i.e.
+	// with Validate or LookupMode 'cluster'.  It's passed to helm as
+	// KUBECONFIG.
+	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
+
+	// HelmBin is the helm executable to inflate this chart with, instead
+	// of the one given by --helm-command, so that charts needing different
+	// helm versions can be inflated side by side.  A path is relative to
+	// the kustomization root; a bare name is looked up in PATH.  Each
+	// executable must be helm V3, and using one requires --enable-exec.
+	HelmBin string `json:"helmBin,omitempty" yaml:"helmBin,omitempty"`
+
+	// DisableOpenAPIValidation sets the --disable-openapi-validation flag,
+	// so that the cluster's OpenAPI schema isn't used to validate the
+	// manifests.  It is only passed to helm when Validate is true.
+	DisableOpenAPIValidation bool `json:"disableOpenAPIValidation,omitempty" yaml:"disableOpenAPIValidation,omitempty"` //nolint: tagliatelle
+
+	// HookTimeout is the time to wait for any individual kubernetes
+	// operation, e.g. of hooks, as a duration such as '2m'.
+	// It's passed to helm's --timeout flag.
+	HookTimeout string `json:"hookTimeout,omitempty" yaml:"hookTimeout,omitempty"`
+
+	// PullTimeout bounds each helm invocation pulling the chart or one
+	// of its dependencies, as a duration such as '2m'.
+	PullTimeout string `json:"pullTimeout,omitempty" yaml:"pullTimeout,omitempty"`
+
+	// ReportPath is a file path, relative to the kustomization root, to
+	// which a summary of the inflated resources (counts by kind, namespaces
+	// and images) is written.  No report is written if omitted.
+	ReportPath string `json:"reportPath,omitempty" yaml:"reportPath,omitempty"`
+
+	// MetricsPath is a file path, relative to the kustomization root, to
+	// which the durations of the pull, dependency fetch and template
+	// phases of the inflation are written, to help find slow charts.
+	MetricsPath string `json:"metricsPath,omitempty" yaml:"metricsPath,omitempty"`
+
+	// PinLatest, when Version is omitted, makes kustomize resolve the
+	// version of the chart that was actually inflated and warn about it,
+	// since inflating the latest version isn't reproducible.
+	PinLatest bool `json:"pinLatest,omitempty" yaml:"pinLatest,omitempty"`
+
+	// PinnedVersionFile is a file path, relative to the kustomization root,
+	// to which the version resolved by PinLatest is written.
+	PinnedVersionFile string `json:"pinnedVersionFile,omitempty" yaml:"pinnedVersionFile,omitempty"`
+
+	// FailOnDeprecatedChart reports a chart whose Chart.yaml declares it
+	// 'deprecated: true', i.e. no longer maintained, once it's pulled.
+	// Legal values: 'warn', 'error'.  Omit to skip the check.
+	FailOnDeprecatedChart string `json:"failOnDeprecatedChart,omitempty" yaml:"failOnDeprecatedChart,omitempty"`
+
+	// ExpectedAppVersion is the application version the chart must ship,
+	// checked against the 'appVersion' of its Chart.yaml once it's pulled,
+	// so that a release doesn't silently inflate another version of the
+	// application.  Omit to skip the check.
+	ExpectedAppVersion string `json:"expectedAppVersion,omitempty" yaml:"expectedAppVersion,omitempty"`
+
+	// CompatV2 reports the helm v2 constructs that helm 3 no longer
+	// supports, found in the chart before rendering it, each with what
+	// to change: a requirements.yaml, '.Release.Time' and
+	// '.Capabilities.TillerVersion'.  Helps migrating old charts.
+	// Legal values: 'warn', 'error'.  Omit to skip the check.
+	CompatV2 string `json:"compatV2,omitempty" yaml:"compatV2,omitempty"`
+
+	// OutputFile is a file path, relative to the kustomization root, to
+	// which the inflated resources are written as a single YAML stream,
+	// with "---" separators and no trailing whitespace.
+	OutputFile string `json:"outputFile,omitempty" yaml:"outputFile,omitempty"`
+
+	// GoldenFile is a file path, relative to the kustomization root, of
+	// the expected inflated resources.  If set, the inflated resources
+	// are compared against it, both normalized the way kustomize writes
+	// them, and inflation fails with the differing lines if they don't
+	// match.  This allows for snapshot testing of a chart.
+	GoldenFile string `json:"goldenFile,omitempty" yaml:"goldenFile,omitempty"`
+
+	// GroupOutputByKind sorts the resources written to OutputFile by
+	// kind, and heads each group with a comment naming it, e.g.
+	// '# Deployment', to make the file easier to review.
+	GroupOutputByKind bool `json:"groupOutputByKind,omitempty" yaml:"groupOutputByKind,omitempty"`
+
+	// OutputDir is a directory path, relative to the kustomization root,
+	// to which each inflated resource is written as its own file, named
+	// '[{namespace}_]{kind}[.{group}]_{name}.yaml' in lower case, e.g.
+	// 'web_deployment.apps_frontend.yaml'.  The directory is owned by
+	// the generator: YAML files in it that the current inflation didn't
+	// write, e.g. those of resources since removed from the chart, are
+	// deleted.
+	OutputDir string `json:"outputDir,omitempty" yaml:"outputDir,omitempty"`
+
+	// OutputTarball is a file path, relative to the kustomization root,
+	// to which the inflated resources are written as a gzipped tarball
+	// holding a YAML file per kind, e.g. 'deployment.yaml', as a
+	// portable bundle for artifact storage.
+	OutputTarball string `json:"outputTarball,omitempty" yaml:"outputTarball,omitempty"`
+
+	// OutputComponent also writes a kustomization.yaml of kind Component
+	// to OutputDir, listing the resource files, so that the directory can
+	// be used as a kustomize Component elsewhere.
+	OutputComponent bool `json:"outputComponent,omitempty" yaml:"outputComponent,omitempty"`
+
+	// EmitKustomization also writes a kustomization.yaml to OutputDir,
+	// listing the resource files, so that the directory can be used as a
+	// kustomize base right away.  Mutually exclusive with OutputComponent.
+	EmitKustomization bool `json:"emitKustomization,omitempty" yaml:"emitKustomization,omitempty"`
+
+	// RawOutputPath is a file path, relative to the kustomization root, to
+	// which the output of helm template is written before it's parsed.
+	// Unlike the inflated resources, it keeps the comments emitted by
+	// helm and the chart, which helps debugging.
+	RawOutputPath string `json:"rawOutputPath,omitempty" yaml:"rawOutputPath,omitempty"`
+
+	// RawOutputProvenance prepends each document written to RawOutputPath
+	// with a comment naming the chart, its version and the template that
+	// rendered the document, e.g. for when raw outputs are concatenated.
+	RawOutputProvenance bool `json:"rawOutputProvenance,omitempty" yaml:"rawOutputProvenance,omitempty"`
+
+	// NormalizeLineEndings converts the CRLF line endings that helm may
+	// emit on Windows to LF before the output of helm template is
+	// post-processed and parsed.  Defaults to true on Windows only.
+	NormalizeLineEndings *bool `json:"normalizeLineEndings,omitempty" yaml:"normalizeLineEndings,omitempty"`
+
+	// DumpValuesPath is a file path, relative to the kustomization root,
+	// to which the values file given to helm is written, for review.
+	// When ValuesInline is merged into the chart's values, the comments
+	// and key order of the latter are kept.
+	DumpValuesPath string `json:"dumpValuesPath,omitempty" yaml:"dumpValuesPath,omitempty"`
+
+	// ValuesDiffPath is a file path, relative to the kustomization root,
+	// to which the differences between the chart's default values, as
+	// shown by 'helm show values', and the values the chart is inflated
+	// with are written, to review the overrides applied.
+	ValuesDiffPath string `json:"valuesDiffPath,omitempty" yaml:"valuesDiffPath,omitempty"`
+
+	// PostCommands is a pipeline of commands, each given as the command
+	// followed by its arguments, through which the output of helm template
+	// is piped in order before it's parsed.  The commands run in the
+	// kustomization root, and require --enable-exec.
+	PostCommands [][]string `json:"postCommands,omitempty" yaml:"postCommands,omitempty"`
+
+	// CommonValues holds typed overrides for values most charts expose,
+	// passed to helm with --set.
+	CommonValues *HelmCommonValues `json:"commonValues,omitempty" yaml:"commonValues,omitempty"`
+
+	// MaxMetadataEntries, if positive, is the maximum number of labels,
+	// and separately of annotations, that an inflated resource may carry.
+	// Some admission controllers reject resources with too many entries.
+	MaxMetadataEntries int `json:"maxMetadataEntries,omitempty" yaml:"maxMetadataEntries,omitempty"`
+
+	// RequireLabels are label keys that every inflated resource must
+	// carry, e.g. to enforce labeling standards on charts.
+	RequireLabels []string `json:"requireLabels,omitempty" yaml:"requireLabels,omitempty"`
+
+	// RequireResourceLimits fails the inflation if any container of the
+	// inflated workloads lacks a CPU or memory limit, once DefaultResources
+	// have been applied.
+	RequireResourceLimits bool `json:"requireResourceLimits,omitempty" yaml:"requireResourceLimits,omitempty"`
+
+	// ForbidLatestTag fails the inflation if any container of the inflated
+	// workloads uses an image tagged 'latest', or not tagged at all, rather
+	// than pinned to a version or digest.
+	ForbidLatestTag bool `json:"forbidLatestTag,omitempty" yaml:"forbidLatestTag,omitempty"`
+
+	// CommonAnnotations are annotations to add to all inflated resources.
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty" yaml:"commonAnnotations,omitempty"`
+
+	// AnnotationsFile is a file path, relative to the kustomization root,
+	// to a YAML map of annotations to add to all inflated resources, as
+	// with CommonAnnotations, e.g. when generated by another tool.
+	// CommonAnnotations take precedence over the file's annotations.
+	AnnotationsFile string `json:"annotationsFile,omitempty" yaml:"annotationsFile,omitempty"`
+
+	// PriorityClassName is set as the priorityClassName of the pods of
+	// every inflated workload that doesn't specify one.
+	PriorityClassName string `json:"priorityClassName,omitempty" yaml:"priorityClassName,omitempty"`
+
+	// HardenServiceAccounts sets 'automountServiceAccountToken: false' on
+	// the inflated ServiceAccounts and workload pods that don't set it, so
+	// that API credentials are only mounted where the chart asks for them.
+	HardenServiceAccounts bool `json:"hardenServiceAccounts,omitempty" yaml:"hardenServiceAccounts,omitempty"`
+
+	// DefaultSecurityContext is merged into the security contexts of the
+	// pods and containers of every inflated workload.  Settings made by
+	// the chart are never overwritten.
+	DefaultSecurityContext *HelmSecurityContext `json:"defaultSecurityContext,omitempty" yaml:"defaultSecurityContext,omitempty"`
+
+	// DefaultResources is merged into the resource requests and limits of
+	// every container of the inflated workloads.  Requests and limits set
+	// by the chart are never overwritten.
+	DefaultResources *HelmResources `json:"defaultResources,omitempty" yaml:"defaultResources,omitempty"`
+
+	// DefaultNodeSelector is merged into the node selector of workload
+	// pods, without overwriting the labels selected by the chart.
+	DefaultNodeSelector map[string]string `json:"defaultNodeSelector,omitempty" yaml:"defaultNodeSelector,omitempty"`
+
+	// DefaultTolerations are added to the tolerations of workload pods,
+	// except for those tolerating a taint, by key and effect, that the
+	// chart already tolerates.
+	DefaultTolerations []map[string]interface{} `json:"defaultTolerations,omitempty" yaml:"defaultTolerations,omitempty"`
+
+	// DefaultTopologySpread are the topologySpreadConstraints given to
+	// the pods of workloads that have none; constraints set by the chart
+	// are left alone.  A constraint without a labelSelector selects the
+	// pods of the workload it's given to, by their labels.
+	DefaultTopologySpread []map[string]interface{} `json:"defaultTopologySpread,omitempty" yaml:"defaultTopologySpread,omitempty"`
+
+	// MeshInjectionAnnotations are set on the pod templates of workloads,
+	// e.g. 'sidecar.istio.io/inject: "true"' to onboard them to a service
+	// mesh.  An annotation the chart already sets on a pod template, such
+	// as an explicit opt-out, is left alone.
+	MeshInjectionAnnotations map[string]string `json:"meshInjectionAnnotations,omitempty" yaml:"meshInjectionAnnotations,omitempty"`
+
+	// CommonEnv are environment variables added to every container of the
+	// inflated workloads, e.g. 'TZ' or 'LANG'.  A variable a container
+	// already defines is left alone.
+	CommonEnv map[string]string `json:"commonEnv,omitempty" yaml:"commonEnv,omitempty"`
+
+	// CanonicalizeImages rewrites the images of workload containers to
+	// their fully qualified form, e.g. 'nginx' to
+	// 'docker.io/library/nginx:latest'.
+	CanonicalizeImages bool `json:"canonicalizeImages,omitempty" yaml:"canonicalizeImages,omitempty"`
+
+	// CheckReferences verifies that the ConfigMaps and Secrets referenced
+	// by inflated workloads (through envFrom, env or volumes) are
+	// inflated as well.  Legal values: 'warn', 'error'.
+	// Omit to skip the check.
+	CheckReferences string `json:"checkReferences,omitempty" yaml:"checkReferences,omitempty"`
+
+	// CheckServiceSelectors verifies that the selector of every inflated
+	// Service matches the pod labels of an inflated workload in its
+	// namespace.  Legal values: 'warn', 'error'.
+	// Omit to skip the check.
+	CheckServiceSelectors string `json:"checkServiceSelectors,omitempty" yaml:"checkServiceSelectors,omitempty"`
+
+	// CheckPDBs verifies that every inflated PodDisruptionBudget allows
+	// evicting a pod of the inflated workloads it selects, by their
+	// replicas, e.g. that minAvailable is less than the replicas.  Only
+	// the matchLabels of a PodDisruptionBudget's selector are considered.
+	// Legal values: 'warn', 'error'.  Omit to skip the check.
+	CheckPDBs string `json:"checkPDBs,omitempty" yaml:"checkPDBs,omitempty"` //nolint: tagliatelle
+
+	// Kubeconform validates the inflated resources against kubernetes
+	// schemas with kubeconform, failing on invalid resources.
+	// Requires --enable-exec.
+	Kubeconform *HelmKubeconform `json:"kubeconform,omitempty" yaml:"kubeconform,omitempty"`
+
+	// OpenAPISchema is the path to an OpenAPI v2 schema, as downloaded
+	// from an API server's /openapi/v2 endpoint, to validate the inflated
+	// resources against, in-process and without a cluster.  Resources
+	// whose kind the schema doesn't define are not validated, and fields
+	// the schema doesn't declare are rejected, as by the API server.
+	OpenAPISchema string `json:"openAPISchema,omitempty" yaml:"openAPISchema,omitempty"` //nolint:tagliatelle
+
+	// DisallowClusterScoped fails the build if the chart renders any
+	// cluster-scoped resource, e.g. a ClusterRole or a
+	// CustomResourceDefinition.  Useful for namespaced tenants.
+	DisallowClusterScoped bool `json:"disallowClusterScoped,omitempty" yaml:"disallowClusterScoped,omitempty"`
+
+	// AllowedNamespaces fails the build if any inflated resource is in a
+	// namespace not listed, or is a Namespace not listed.  Resources
+	// without a namespace pass, as they end up in the one kustomize or
+	// the cluster gives them.  Useful for namespaced tenants.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty" yaml:"allowedNamespaces,omitempty"`
+
+	// RequireSingleNamespace fails the build if the inflated resources
+	// that have a namespace are in more than one, naming each namespace
+	// and a resource in it.  Useful for charts
+	// meant to be deployed into a single namespace.
+	RequireSingleNamespace bool `json:"requireSingleNamespace,omitempty" yaml:"requireSingleNamespace,omitempty"`
+
+	// CaptureChartMetadata adds a ConfigMap named
+	// '{ReleaseName}-chart-metadata' to the inflated resources, holding
+	// the chart's Chart.yaml and README.md, to keep the chart's
+	// documentation with the build output.
+	CaptureChartMetadata bool `json:"captureChartMetadata,omitempty" yaml:"captureChartMetadata,omitempty"`
+
+	// DependencyReport adds a ConfigMap named '{ReleaseName}-dependencies'
+	// listing the chart's dependencies, with their version, repository
+	// and status, as reported by 'helm dependency list'.
+	DependencyReport bool `json:"dependencyReport,omitempty" yaml:"dependencyReport,omitempty"`
+
+	// PhaseAnnotations annotates CustomResourceDefinitions with
+	// 'phase: crd' and all other inflated resources with
+	// 'phase: resources', so that an apply tool can apply the CRDs
+	// in a first pass, before the resources that may depend on them.
+	PhaseAnnotations bool `json:"phaseAnnotations,omitempty" yaml:"phaseAnnotations,omitempty"`
+
+	// HookWeightOrder carries the ordering of helm's 'helm.sh/hook-weight'
+	// into the output.  Legal values: 'annotate', which sets
+	// 'kustomize.helm/hook-order' on weighted resources to a value that
+	// sorts as the weights do, and 'sort', which also reorders the
+	// resources by weight, taking a missing weight to be 0.
+	HookWeightOrder string `json:"hookWeightOrder,omitempty" yaml:"hookWeightOrder,omitempty"`
+
+	// ConfigChecksums annotates the pod template of every inflated
+	// workload with 'checksum/config', the sha256 checksum of the inflated
+	// ConfigMaps and Secrets that the workload references, so that a
+	// change in them rolls out exactly the workloads using them.
+	ConfigChecksums bool `json:"configChecksums,omitempty" yaml:"configChecksums,omitempty"`
+
+	// StampChecksum adds a ConfigMap named '{ReleaseName}-checksum' whose
+	// 'kustomize.config.k8s.io/render-checksum' annotation holds the
+	// sha256 checksum of the inflated resources, so that changes in the
+	// rendering can be detected without comparing it in full.
+	StampChecksum bool `json:"stampChecksum,omitempty" yaml:"stampChecksum,omitempty"`
+
+	// StampTimestamp annotates every inflated resource with the time of
+	// inflation, in RFC3339 format, as 'kustomize.helm/generated-at'.
+	// This makes the output differ on every build, so it's opt-in.
+	StampTimestamp bool `json:"stampTimestamp,omitempty" yaml:"stampTimestamp,omitempty"`
+
+	// StampKubeVersion annotates every inflated resource with the
+	// Kubernetes version constraint declared as 'kubeVersion' in the
+	// chart's Chart.yaml, e.g. '>= 1.25.0-0', as
+	// 'kustomize.helm/kube-version', so that downstream tooling can check
+	// the chart's compatibility with the target cluster.  Charts that
+	// declare no constraint leave the resources unannotated.
+	StampKubeVersion bool `json:"stampKubeVersion,omitempty" yaml:"stampKubeVersion,omitempty"`
+
+	// SortMetadataKeys sorts the keys of the labels and annotations of
+	// every inflated resource, after all of them are set, so that their
+	// order in the output doesn't depend on the chart's templates or on
+	// the order in which kustomize adds them, minimizing diff noise.
+	SortMetadataKeys bool `json:"sortMetadataKeys,omitempty" yaml:"sortMetadataKeys,omitempty"`
+
+	// MergeConfigMaps merges ConfigMaps rendered more than once with the
+	// same name and namespace, e.g. by shared subcharts, into one holding
+	// the union of their data.  Conflicting values for a key are an error.
+	MergeConfigMaps bool `json:"mergeConfigMaps,omitempty" yaml:"mergeConfigMaps,omitempty"`
+
+	// MergeWithExisting merges an inflated resource with a resource of the
+	// same id that is already in the build, e.g. one listed in resources,
+	// rather than fail on the conflict.  The existing resource is applied
+	// to the inflated one as a strategic merge patch.
+	MergeWithExisting bool `json:"mergeWithExisting,omitempty" yaml:"mergeWithExisting,omitempty"`
+
+	// DuplicateResources specifies how to handle a resource that helm
+	// renders in more than one document, e.g. because a chart splits it
+	// across templates.  Legal values: 'error', which fails naming the
+	// resource, and 'merge', which merges the documents in order, later
+	// fields overriding earlier ones.  Omit to fail as kustomize does for
+	// any duplicate resource.
+	DuplicateResources string `json:"duplicateResources,omitempty" yaml:"duplicateResources,omitempty"`
+
+	// LocalConfigResources selects inflated resources to annotate with
+	// 'config.kubernetes.io/local-config', so that kustomize neither
+	// transforms nor emits them.
+	LocalConfigResources []Selector `json:"localConfigResources,omitempty" yaml:"localConfigResources,omitempty"`
+
+	// ResourceTransforms maps 'Kind/name' of inflated resources, e.g.
+	// 'Deployment/web', to patches applied to the resources of that kind
+	// and name only.  A patch is given with Patch or Path, and is either
+	// a strategic merge patch, which may leave out apiVersion, kind and
+	// metadata, or a JSON patch.  The Target and Options of the patches
+	// are not used.
+	ResourceTransforms map[string][]Patch `json:"resourceTransforms,omitempty" yaml:"resourceTransforms,omitempty"`
+}
+
+// HelmSecurityContext holds default security settings for workloads.
+type HelmSecurityContext struct {
+	// Pod is merged into each pod's securityContext,
+	// e.g. {runAsNonRoot: true}.
+	Pod map[string]interface{} `json:"pod,omitempty" yaml:"pod,omitempty"`
+
+	// Container is merged into each container's securityContext,
+	// e.g. {readOnlyRootFilesystem: true}.
+	Container map[string]interface{} `json:"container,omitempty" yaml:"container,omitempty"`
+}
+
+// SplitSetFileValue splits a SetValues entry of the form 'key=@path'
+// into its key and path.  It returns false for any other entry.
+func SplitSetFileValue(value string) (key string, path string, isFile bool) {
+	key, v, found := strings.Cut(value, "=")
+	if !found || !strings.HasPrefix(v, "@") {
+		return "", "", false
+	}
+	return key, strings.TrimPrefix(v, "@"), true
+}
+
+// HelmKubeconform configures kubeconform.
+type HelmKubeconform struct {
+	// Command is the kubeconform executable.  Defaults to 'kubeconform'.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+
+	// SchemaLocations are the locations of the schemas, passed to
+	// kubeconform's '-schema-location' flag.  Defaults to kubeconform's
+	// default location.
+	SchemaLocations []string `json:"schemaLocations,omitempty" yaml:"schemaLocations,omitempty"`
+}
+
+// Args returns the arguments to kubeconform.
+func (k *HelmKubeconform) Args() []string {
+	args := []string{"-summary"}
+	for _, location := range k.SchemaLocations {
+		args = append(args, "-schema-location", location)
+	}
+	return args
+}
+
+// HelmCosignVerify configures the verification of chart signatures.
+type HelmCosignVerify struct {
+	// Command is the cosign executable.  Defaults to 'cosign'.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+
+	// Key is a local file path to the public key to verify the
+	// signature with.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// HelmCommonValues holds overrides for values commonly found in charts.
+// Each field is mapped to a values key, which defaults to the key used
+// by `helm create` and may be changed with KeyMapping.
+type HelmCommonValues struct {
+	// ImageRepository maps to 'image.repository'.
+	ImageRepository string `json:"imageRepository,omitempty" yaml:"imageRepository,omitempty"`
+
+	// ImageTag maps to 'image.tag'.
+	ImageTag string `json:"imageTag,omitempty" yaml:"imageTag,omitempty"`
+
+	// Replicas maps to 'replicaCount'.
+	Replicas *int `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+
+	// Resources maps to 'resources'.
+	Resources *HelmResources `json:"resources,omitempty" yaml:"resources,omitempty"`
+
+	// KeyMapping maps field names (e.g. 'imageTag') to the values key
+	// to set instead of the default one (e.g. 'app.image.version').
+	KeyMapping map[string]string `json:"keyMapping,omitempty" yaml:"keyMapping,omitempty"`
+}
+
+// HelmResources holds container resource requests and limits,
+// keyed by resource name, e.g. 'cpu' or 'memory'.
+type HelmResources struct {
+	Requests map[string]string `json:"requests,omitempty" yaml:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty" yaml:"limits,omitempty"`
+}
+
+var helmCommonValuesDefaultKeys = map[string]string{ //nolint:gochecknoglobals
+	"imageRepository": "image.repository",
+	"imageTag":        "image.tag",
+	"replicas":        "replicaCount",
+	"resources":       "resources",
+}
+
+func (v *HelmCommonValues) key(field string) string {
+	if k, ok := v.KeyMapping[field]; ok {
+		return k
+	}
+	return helmCommonValuesDefaultKeys[field]
+}
+
+// AsSetArgs returns the --set flags corresponding to the fields set.
+func (v *HelmCommonValues) AsSetArgs() []string {
+	var args []string
+	set := func(key, value string) {
+		args = append(args, "--set", key+"="+value)
+	}
+	if v.ImageRepository != "" {
+		set(v.key("imageRepository"), v.ImageRepository)
+	}
+	if v.ImageTag != "" {
+		set(v.key("imageTag"), v.ImageTag)
+	}
+	if v.Replicas != nil {
+		set(v.key("replicas"), strconv.Itoa(*v.Replicas))
+	}
+	if v.Resources != nil {
+		for _, kind := range []struct {
+			name   string
+			values map[string]string
+		}{
+			{"requests", v.Resources.Requests},
+			{"limits", v.Resources.Limits},
+		} {
+			names := make([]string, 0, len(kind.values))
+			for name := range kind.values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				set(v.key("resources")+"."+kind.name+"."+name, kind.values[name])
+			}
+		}
+	}
+	return args
 }
 
 // HelmChartArgs contains arguments to helm.
@@ -134,6 +962,13 @@ func SplitHelmParameters(
 	return charts, globals
 }
 
+// usesDefaultRepo returns true if the chart relies on the default
+// 'stable' repository.
+func (h *HelmChartArgs) usesDefaultRepo() bool {
+	return h.ChartRepoURL == "" &&
+		(h.ChartRepoName == "" || h.ChartRepoName == HelmDefaultRepoName)
+}
+
 func makeHelmChartFromHca(old *HelmChartArgs) (c HelmChart) {
 	c.Name = old.ChartName
 	c.Version = old.ChartVersion
@@ -188,5 +1023,38 @@ func (h HelmChart) AsHelmArgs(absChartHome string) []string {
 	if h.SkipHooks {
 		args = append(args, "--no-hooks")
 	}
+	if h.CommonValues != nil {
+		args = append(args, h.CommonValues.AsSetArgs()...)
+	}
+	tags := make([]string, 0, len(h.Tags))
+	for tag := range h.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		args = append(args, "--set", "tags."+tag+"="+strconv.FormatBool(h.Tags[tag]))
+	}
+	for _, value := range h.SetValues {
+		if key, file, isFile := SplitSetFileValue(value); isFile {
+			args = append(args, "--set-file", key+"="+file)
+		} else {
+			args = append(args, "--set", value)
+		}
+	}
+	if h.HookTimeout != "" {
+		args = append(args, "--timeout", h.HookTimeout)
+	}
+	if h.LookupMode == HelmLookupModeCluster {
+		args = append(args, "--dry-run=server")
+	}
+	if h.Validate {
+		args = append(args, "--validate")
+		if h.KubeContext != "" {
+			args = append(args, "--kube-context", h.KubeContext)
+		}
+		if h.DisableOpenAPIValidation {
+			args = append(args, "--disable-openapi-validation")
+		}
+	}
 	return args
 }
@@ -61,3 +61,169 @@ func TestAsHelmArgs(t *testing.T) {
 				"--api-versions", "foo", "--api-versions", "bar"})
 	})
 }
+
+func TestAsHelmArgsValidate(t *testing.T) {
+	t.Run("kube context passed with validation", func(t *testing.T) {
+		p := types.HelmChart{
+			Name:        "chart-name",
+			ReleaseName: "test",
+			Validate:    true,
+			KubeContext: "prod-cluster",
+		}
+		require.Equal(t, []string{"template", "test", "/home/charts/chart-name",
+			"--validate",
+			"--kube-context", "prod-cluster"},
+			p.AsHelmArgs("/home/charts"))
+	})
+
+	t.Run("openapi validation disabled with validation", func(t *testing.T) {
+		p := types.HelmChart{
+			Name:                     "chart-name",
+			ReleaseName:              "test",
+			Validate:                 true,
+			DisableOpenAPIValidation: true,
+		}
+		require.Equal(t, []string{"template", "test", "/home/charts/chart-name",
+			"--validate",
+			"--disable-openapi-validation"},
+			p.AsHelmArgs("/home/charts"))
+	})
+
+	t.Run("validation flags ignored without validation", func(t *testing.T) {
+		p := types.HelmChart{
+			Name:                     "chart-name",
+			ReleaseName:              "test",
+			KubeContext:              "prod-cluster",
+			DisableOpenAPIValidation: true,
+		}
+		require.Equal(t, []string{"template", "test", "/home/charts/chart-name"},
+			p.AsHelmArgs("/home/charts"))
+	})
+}
+
+func TestHelmCommonValuesAsSetArgs(t *testing.T) {
+	replicas := 3
+	t.Run("default keys", func(t *testing.T) {
+		v := types.HelmCommonValues{
+			ImageRepository: "nginx",
+			ImageTag:        "1.25",
+			Replicas:        &replicas,
+			Resources: &types.HelmResources{
+				Requests: map[string]string{"memory": "64Mi", "cpu": "100m"},
+				Limits:   map[string]string{"memory": "128Mi"},
+			},
+		}
+		require.Equal(t, []string{
+			"--set", "image.repository=nginx",
+			"--set", "image.tag=1.25",
+			"--set", "replicaCount=3",
+			"--set", "resources.requests.cpu=100m",
+			"--set", "resources.requests.memory=64Mi",
+			"--set", "resources.limits.memory=128Mi"},
+			v.AsSetArgs())
+	})
+
+	t.Run("mapped keys", func(t *testing.T) {
+		v := types.HelmCommonValues{
+			ImageTag: "1.25",
+			Replicas: &replicas,
+			KeyMapping: map[string]string{
+				"imageTag": "app.image.version",
+				"replicas": "app.replicas",
+			},
+		}
+		require.Equal(t, []string{
+			"--set", "app.image.version=1.25",
+			"--set", "app.replicas=3"},
+			v.AsSetArgs())
+	})
+
+	t.Run("passed to helm template", func(t *testing.T) {
+		p := types.HelmChart{
+			Name:         "chart-name",
+			ReleaseName:  "test",
+			CommonValues: &types.HelmCommonValues{ImageTag: "1.25"},
+		}
+		require.Equal(t, []string{"template", "test", "/home/charts/chart-name",
+			"--set", "image.tag=1.25"},
+			p.AsHelmArgs("/home/charts"))
+	})
+}
+
+func TestHelmKubeconformArgs(t *testing.T) {
+	k := &types.HelmKubeconform{}
+	require.Equal(t, []string{"-summary"}, k.Args())
+
+	k.SchemaLocations = []string{
+		"default",
+		"https://example.com/{{.ResourceKind}}.json",
+	}
+	require.Equal(t, []string{
+		"-summary",
+		"-schema-location", "default",
+		"-schema-location", "https://example.com/{{.ResourceKind}}.json",
+	}, k.Args())
+}
+
+func TestAsHelmArgsSetValues(t *testing.T) {
+	p := types.HelmChart{
+		Name:        "chart-name",
+		ReleaseName: "myRelease",
+		SetValues: []string{
+			"replicas=3",
+			"config=@/kust/files/app.conf",
+			"banner=not@a-file",
+		},
+	}
+	require.Equal(t, []string{
+		"template", "myRelease", "/chart/home/chart-name",
+		"--set", "replicas=3",
+		"--set-file", "config=/kust/files/app.conf",
+		"--set", "banner=not@a-file",
+	}, p.AsHelmArgs("/chart/home"))
+}
+
+func TestAsHelmArgsHookTimeout(t *testing.T) {
+	p := types.HelmChart{
+		Name:        "chart-name",
+		ReleaseName: "myRelease",
+		HookTimeout: "2m",
+	}
+	require.Equal(t, []string{
+		"template", "myRelease", "/chart/home/chart-name",
+		"--timeout", "2m",
+	}, p.AsHelmArgs("/chart/home"))
+}
+
+func TestAsHelmArgsTags(t *testing.T) {
+	p := types.HelmChart{
+		Name:        "chart-name",
+		ReleaseName: "myRelease",
+		Tags: map[string]bool{
+			"monitoring": false,
+			"backend":    true,
+		},
+	}
+	require.Equal(t, []string{
+		"template", "myRelease", "/chart/home/chart-name",
+		"--set", "tags.backend=true",
+		"--set", "tags.monitoring=false",
+	}, p.AsHelmArgs("/chart/home"))
+}
+
+func TestAsHelmArgsLookupMode(t *testing.T) {
+	p := types.HelmChart{
+		Name:        "chart-name",
+		ReleaseName: "myRelease",
+		LookupMode:  types.HelmLookupModeOffline,
+	}
+	require.Equal(t, []string{
+		"template", "myRelease", "/chart/home/chart-name",
+	}, p.AsHelmArgs("/chart/home"))
+
+	p.LookupMode = types.HelmLookupModeCluster
+	require.Equal(t, []string{
+		"template", "myRelease", "/chart/home/chart-name",
+		"--dry-run=server",
+	}, p.AsHelmArgs("/chart/home"))
+}
@@ -189,6 +189,7 @@ const (
 	deprecatedPatchesStrategicMergeMessage     = "# Warning: 'patchesStrategicMerge' is deprecated. Please use 'patches' instead." + " " + deprecatedWarningToRunEditFix
 	deprecatedVarsMessage                      = "# Warning: 'vars' is deprecated. Please use 'replacements' instead." + " " + deprecatedWarningToRunEditFixExperimential
 	deprecatedCommonLabelsWarningMessage       = "# Warning: 'commonLabels' is deprecated. Please use 'labels' instead." + " " + deprecatedWarningToRunEditFix
+	deprecatedStableRepoMessage                = "# Warning: 'helmChartInflationGenerator' pulls charts without a 'chartRepoUrl' that aren't in 'chartHome' from the 'stable' chart repository, which no longer exists. Unless these charts are vendored in 'chartHome', please set 'chartRepoUrl', or 'helmGlobals.defaultRepoURL' to substitute for it."
 )
 
 // CheckDeprecatedFields check deprecated field is used or not.
@@ -212,6 +213,14 @@ func (k *Kustomization) CheckDeprecatedFields() *[]string {
 	if k.Vars != nil {
 		warningMessages = append(warningMessages, deprecatedVarsMessage)
 	}
+	if k.HelmGlobals == nil || k.HelmGlobals.DefaultRepoURL == "" {
+		for i := range k.HelmChartInflationGenerator {
+			if k.HelmChartInflationGenerator[i].usesDefaultRepo() {
+				warningMessages = append(warningMessages, deprecatedStableRepoMessage)
+				break
+			}
+		}
+	}
 	return &warningMessages
 }
 
@@ -259,6 +268,13 @@ func (k *Kustomization) FixKustomization() {
 			k.HelmGlobals = &globals
 		}
 	}
+	if k.HelmGlobals != nil && k.HelmGlobals.DefaultRepoURL != "" {
+		for i := range k.HelmChartInflationGenerator {
+			if k.HelmChartInflationGenerator[i].usesDefaultRepo() {
+				charts[i].Repo = k.HelmGlobals.DefaultRepoURL
+			}
+		}
+	}
 	k.HelmCharts = append(k.HelmCharts, charts...)
 	// Wipe it for the fix command.
 	k.HelmChartInflationGenerator = nil
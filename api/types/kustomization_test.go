@@ -64,6 +64,21 @@ func TestKustomization_CheckDeprecatedFields(t *testing.T) {
 			},
 			want: &[]string{deprecatedVarsMessage},
 		},
+		{
+			name: "usingStableRepo",
+			k: Kustomization{
+				HelmChartInflationGenerator: []HelmChartArgs{{ChartName: "minecraft"}},
+			},
+			want: &[]string{deprecatedStableRepoMessage},
+		},
+		{
+			name: "usingStableRepoWithDefaultRepoURL",
+			k: Kustomization{
+				HelmGlobals:                 &HelmGlobals{DefaultRepoURL: "https://charts.example.com"},
+				HelmChartInflationGenerator: []HelmChartArgs{{ChartName: "minecraft"}},
+			},
+			want: new([]string),
+		},
 		{
 			name: "usingAll",
 			k: Kustomization{
@@ -131,6 +146,27 @@ func TestFixKustomizationPostUnmarshalling(t *testing.T) {
 	}
 }
 
+func TestFixKustomizationPostUnmarshalling_DefaultRepoURL(t *testing.T) {
+	k := Kustomization{
+		HelmGlobals: &HelmGlobals{DefaultRepoURL: "https://charts.example.com"},
+		HelmChartInflationGenerator: []HelmChartArgs{
+			{ChartName: "minecraft", ChartRepoName: "stable"},
+			{ChartName: "redis", ChartRepoURL: "https://redis.example.com"},
+			{ChartName: "local", ChartRepoName: "vendored"},
+		},
+	}
+	k.FixKustomization()
+
+	var repos []string
+	for _, chart := range k.HelmCharts {
+		repos = append(repos, chart.Repo)
+	}
+	expected := []string{"https://charts.example.com", "https://redis.example.com", ""}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Fatalf("unexpected repos: %v", repos)
+	}
+}
+
 func TestFixKustomizationPostUnmarshalling_2(t *testing.T) {
 	k := Kustomization{
 		TypeMeta: TypeMeta{
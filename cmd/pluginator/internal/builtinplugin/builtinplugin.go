@@ -26,13 +26,33 @@ const (
 )
 
 // ConvertToBuiltInPlugin converts the input plugin file to
-// kustomize builtin plugin and writes it to proper directory
-func ConvertToBuiltInPlugin() (retErr error) {
+// kustomize builtin plugin and writes it to proper directory.
+// A plugin too large for one file may continue in files named
+// after it, e.g. FooGenerator_output.go, which are converted
+// to files of the same names.
+func ConvertToBuiltInPlugin() error {
 	root, err := inputFileRoot()
 	if err != nil {
 		return err
 	}
-	file, err := os.Open(root + ".go")
+	continuations, err := continuationFileRoots(root)
+	if err != nil {
+		return err
+	}
+	for _, c := range continuations {
+		if err = convertFile(root, c, false); err != nil {
+			return err
+		}
+	}
+	return convertFile(root, root, true)
+}
+
+// convertFile converts the file fileRoot.go of the plugin
+// root.  Only the main file of the plugin may declare its
+// Transform or Generate method, and is followed by the
+// constructor of the plugin.
+func convertFile(root, fileRoot string, isMain bool) (retErr error) {
+	file, err := os.Open(fileRoot + ".go")
 	if err != nil {
 		return err
 	}
@@ -43,7 +63,7 @@ func ConvertToBuiltInPlugin() (retErr error) {
 		return err
 	}
 
-	w, err := newWriter(root)
+	w, err := newWriter(root, fileRoot)
 	if err != nil {
 		return err
 	}
@@ -77,12 +97,12 @@ func ConvertToBuiltInPlugin() (retErr error) {
 			continue
 		}
 		if strings.Contains(l, " Transform(") {
-			if pType != unknown {
+			if pType != unknown || !isMain {
 				return fmt.Errorf("unexpected Transform(")
 			}
 			pType = Transformer
 		} else if strings.Contains(l, " Generate(") {
-			if pType != unknown {
+			if pType != unknown || !isMain {
 				return fmt.Errorf("unexpected Generate(")
 			}
 			pType = Generator
@@ -92,6 +112,9 @@ func ConvertToBuiltInPlugin() (retErr error) {
 	if err := scanner.Err(); err != nil {
 		return err
 	}
+	if !isMain {
+		return nil
+	}
 	w.write("")
 	w.write("func New" + root + "Plugin() resmap." + pType.String() + "Plugin {")
 	w.write("	return &" + root + "Plugin{}")
@@ -100,6 +123,22 @@ func ConvertToBuiltInPlugin() (retErr error) {
 	return nil
 }
 
+// continuationFileRoots returns the roots of the files,
+// other than tests, that continue the plugin root.
+func continuationFileRoots(root string) ([]string, error) {
+	files, err := filepath.Glob(root + "_*.go")
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, "_test.go") {
+			roots = append(roots, strings.TrimSuffix(f, ".go"))
+		}
+	}
+	return roots, nil
+}
+
 func inputFileRoot() (string, error) {
 	n := os.Getenv("GOFILE")
 	if !strings.HasSuffix(n, ".go") {
@@ -124,8 +163,8 @@ type writer struct {
 	f    *os.File
 }
 
-func newWriter(r string) (*writer, error) {
-	n := makeOutputFileName(r)
+func newWriter(r, fileRoot string) (*writer, error) {
+	n := makeOutputFileName(fileRoot)
 	f, err := os.Create(n)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create `%s`; %v", n, err)
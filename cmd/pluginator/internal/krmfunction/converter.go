@@ -70,6 +70,30 @@ func (c *Converter) Convert() error {
 		return err
 	}
 
+	files := map[string]string{
+		c.wrapperFileName: wrapper,
+		c.pluginFileName:  pluginCode,
+		c.goModFileName:   goMod,
+		c.dockerFileName:  c.getDockerfile(),
+	}
+
+	// read the files continuing the plugin code, if any
+	continuations, err := filepath.Glob(
+		strings.TrimSuffix(c.inputFile, ".go") + "_*.go")
+	if err != nil {
+		return err
+	}
+	for _, f := range continuations {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		code, err := c.readDiskFile(f)
+		if err != nil {
+			return err
+		}
+		files[filepath.Base(f)] = code
+	}
+
 	// prepare destination directory
 	err = c.mkDstDir()
 	if err != nil {
@@ -77,12 +101,7 @@ func (c *Converter) Convert() error {
 	}
 
 	// write
-	return c.write(map[string]string{
-		c.wrapperFileName: wrapper,
-		c.pluginFileName:  pluginCode,
-		c.goModFileName:   goMod,
-		c.dockerFileName:  c.getDockerfile(),
-	})
+	return c.write(files)
 }
 
 func (c *Converter) getDockerfile() string {
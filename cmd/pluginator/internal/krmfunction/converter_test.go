@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -248,3 +249,29 @@ functionConfig:
       name: staging
 `, string(output))
 }
+
+func TestConverterWithContinuationFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	code := string(getGeneratorCode())
+	i := strings.Index(code, "func (p *plugin) Generate()")
+	files := map[string]string{
+		"Plugin.go":          code[:i],
+		"Plugin_generate.go": "package main\n\n" + code[i:],
+		"Plugin_test.go":     "package main_test\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	c := NewConverter(filepath.Join(dir, "output"),
+		filepath.Join(dir, "Plugin.go"))
+	require.NoError(t, c.Convert())
+
+	for _, name := range []string{"Plugin.go", "Plugin_generate.go"} {
+		b, err := os.ReadFile(filepath.Join(dir, "output", name))
+		require.NoError(t, err)
+		assert.Equal(t, files[name], string(b))
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "output", "Plugin_test.go"))
+}
@@ -9,14 +9,23 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"sigs.k8s.io/kustomize/api/ifc"
 	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
 	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/kio"
@@ -31,6 +40,39 @@ type plugin struct {
 	types.HelmGlobals
 	types.HelmChart
 	tmpDir string
+
+	// resolvedVersion is the chart version actually inflated.
+	resolvedVersion string
+
+	// pullTimeout is the parsed PullTimeout.
+	pullTimeout time.Duration
+
+	// chartTarball is the decoded ChartTarballData.
+	chartTarball []byte
+
+	// metrics records the durations of the phases of Generate.
+	metrics helmMetrics
+
+	// fixedNow is the parsed FixedNow.
+	fixedNow time.Time
+
+	// valuesProvider supplies values underlying ValuesInline.
+	valuesProvider ifc.ValuesProvider
+
+	// resourceFilter, if set, selects the inflated resources to keep.
+	resourceFilter func(*resource.Resource) bool
+
+	// chartDigest, if set, is the manifest digest of the 'oci://' chart
+	// that CosignVerify verified, and that is pulled.
+	chartDigest string
+
+	// repositoryCache, if set, is the directory that helm caches the
+	// repository indexes in instead of the default one.
+	repositoryCache string
+
+	// defaultValuesFile is true if ValuesFile wasn't configured and
+	// defaults to the values file packaged in the chart.
+	defaultValuesFile bool
 }
 
 var KustomizePlugin plugin //nolint:gochecknoglobals
@@ -41,6 +83,65 @@ const (
 	valuesMergeOptionReplace  = "replace"
 )
 
+const helmHookAnnotation = "helm.sh/hook"
+
+const helmHookWeightAnnotation = "helm.sh/hook-weight"
+
+const hookOrderAnnotation = "kustomize.helm/hook-order"
+
+const defaultValuesLayerPattern = "values-{layer}.yaml"
+
+const deprecatedAPIAnnotation = "kustomize.config.k8s.io/deprecated-api"
+
+const renderChecksumAnnotation = "kustomize.config.k8s.io/render-checksum"
+
+const generatedAtAnnotation = "kustomize.helm/generated-at"
+
+const kubeVersionAnnotation = "kustomize.helm/kube-version"
+
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+const instanceLabel = "app.kubernetes.io/instance"
+
+const configChecksumAnnotation = "checksum/config"
+
+// Values of the phaseAnnotation set by PhaseAnnotations.
+const (
+	phaseAnnotation = "phase"
+	phaseCRD        = "crd"
+	phaseResources  = "resources"
+)
+
+const (
+	checkModeWarn  = "warn"
+	checkModeError = "error"
+)
+
+var legalCheckModes = []string{
+	checkModeWarn,
+	checkModeError,
+}
+
+const (
+	duplicateModeError = "error"
+	duplicateModeMerge = "merge"
+)
+
+var legalDuplicateModes = []string{
+	duplicateModeError,
+	duplicateModeMerge,
+}
+
+const (
+	hookWeightOrderAnnotate = "annotate"
+	hookWeightOrderSort     = "sort"
+)
+
+var legalHookWeightOrders = []string{
+	hookWeightOrderAnnotate,
+	hookWeightOrderSort,
+}
+
 var legalMergeOptions = []string{
 	valuesMergeOptionMerge,
 	valuesMergeOptionOverride,
@@ -70,6 +171,9 @@ func (p *plugin) Config(
 	}
 
 	p.h = h
+	if p.valuesProvider == nil {
+		p.valuesProvider = noValuesProvider{}
+	}
 	if err = yaml.Unmarshal(config, p); err != nil {
 		return
 	}
@@ -103,11 +207,55 @@ func (p *plugin) validateArgs() (err error) {
 		p.ChartHome = types.HelmDefaultHome
 	}
 
+	if p.ReleaseNamePattern != "" {
+		if err = p.errIfIllegalReleaseName(); err != nil {
+			return err
+		}
+	}
+	if p.FixedNow != "" {
+		if p.fixedNow, err = time.Parse(time.RFC3339, p.FixedNow); err != nil {
+			return errors.WrapPrefixf(err, "invalid fixedNow")
+		}
+	}
+
+	if p.ChartTarballData != "" {
+		if p.ChartTarball != "" {
+			return fmt.Errorf("only one of chartTarball and chartTarballData may be set")
+		}
+		if p.chartTarball, err = base64.StdEncoding.DecodeString(
+			p.ChartTarballData); err != nil {
+			return errors.WrapPrefixf(err, "invalid chartTarballData")
+		}
+	}
+
+	// A chart tarball is extracted into the tmp dir, and a
+	// bounded chart is pulled into it before extraction.
+	if p.isVendored() || p.MaxChartBytes > 0 {
+		if err = p.establishTmpDir(); err != nil {
+			return errors.WrapPrefixf(
+				err, "unable to create tmp dir for chart tarball")
+		}
+	}
+	if p.ProvenanceFile != "" && (p.ChartTarball == "" || p.Keyring == "") {
+		return fmt.Errorf("provenanceFile requires chartTarball and keyring")
+	}
+
 	// The ValuesFile(s) may be consulted by the plugin, so it must
 	// be under the loader root (unless root restrictions are
 	// disabled).
+	if p.ChartValuesFile != "" {
+		if p.ValuesFile != "" {
+			return fmt.Errorf("only one of valuesFile and chartValuesFile may be set")
+		}
+		if !filepath.IsLocal(p.ChartValuesFile) {
+			return fmt.Errorf(
+				"chartValuesFile '%s' must be a path within the chart", p.ChartValuesFile)
+		}
+		p.ValuesFile = filepath.Join(p.absChartHome(), p.Name, p.ChartValuesFile)
+	}
 	if p.ValuesFile == "" {
 		p.ValuesFile = filepath.Join(p.absChartHome(), p.Name, "values.yaml")
+		p.defaultValuesFile = true
 	}
 	for i, file := range p.AdditionalValuesFiles {
 		// use Load() to enforce root restrictions
@@ -117,10 +265,156 @@ func (p *plugin) validateArgs() (err error) {
 		// the additional values filepaths must be relative to the kust root
 		p.AdditionalValuesFiles[i] = filepath.Join(p.h.Loader().Root(), file)
 	}
+	// Values layers follow the additional values files, so that
+	// the last layer takes precedence over everything else.
+	for _, layer := range p.ValuesLayers {
+		file := p.valuesLayerFile(layer)
+		if _, err := p.h.Loader().Load(file); err != nil {
+			return errors.WrapPrefixf(err, "could not load values layer '%s'", layer)
+		}
+		p.AdditionalValuesFiles = append(
+			p.AdditionalValuesFiles, filepath.Join(p.h.Loader().Root(), file))
+	}
+
+	// Files referenced by SetValues are passed to helm, so
+	// they must be under the loader root as well.
+	for i, value := range p.SetValues {
+		key, file, isFile := types.SplitSetFileValue(value)
+		if !isFile {
+			continue
+		}
+		if _, err := p.h.Loader().Load(file); err != nil {
+			return errors.WrapPrefixf(err, "could not load file for setValues key '%s'", key)
+		}
+		p.SetValues[i] = key + "=@" + filepath.Join(p.h.Loader().Root(), file)
+	}
 
 	if err = p.errIfIllegalValuesMerge(); err != nil {
 		return err
 	}
+	for _, key := range p.RemoveValuesKeys {
+		if key == "" || strings.Contains("."+key+".", "..") {
+			return fmt.Errorf("invalid removeValuesKeys entry '%s'", key)
+		}
+	}
+	if err = p.errIfIllegalCreateNamespace(); err != nil {
+		return err
+	}
+	switch p.LookupMode {
+	case "", types.HelmLookupModeOffline:
+	case types.HelmLookupModeCluster:
+		if p.Kubeconfig == "" {
+			return fmt.Errorf("lookupMode '%s' requires kubeconfig", p.LookupMode)
+		}
+	default:
+		return fmt.Errorf("lookupMode must be one of %v", []string{
+			types.HelmLookupModeOffline, types.HelmLookupModeCluster})
+	}
+	if len(p.ValuesVars) > 0 {
+		if err = p.resolveValuesVars(); err != nil {
+			return err
+		}
+	}
+	if p.AnnotationsFile != "" {
+		if err = p.loadAnnotationsFile(); err != nil {
+			return err
+		}
+	}
+	if err = p.errIfIllegalDuplicateResources(); err != nil {
+		return err
+	}
+	if err = p.errIfIllegalHookWeightOrder(); err != nil {
+		return err
+	}
+	if err = errIfIllegalCheckMode("checkReferences", p.CheckReferences); err != nil {
+		return err
+	}
+	if err = errIfIllegalCheckMode(
+		"checkServiceSelectors", p.CheckServiceSelectors); err != nil {
+		return err
+	}
+	if err = errIfIllegalCheckMode("checkPDBs", p.CheckPDBs); err != nil {
+		return err
+	}
+	if err = errIfIllegalCheckMode(
+		"reportUnusedValues", p.ReportUnusedValues); err != nil {
+		return err
+	}
+	if err = errIfIllegalCheckMode(
+		"failOnDeprecatedChart", p.FailOnDeprecatedChart); err != nil {
+		return err
+	}
+	if err = errIfIllegalCheckMode("compatV2", p.CompatV2); err != nil {
+		return err
+	}
+	if err = p.errIfIllegalResourceTransforms(); err != nil {
+		return err
+	}
+	if kind, name, _ := strings.Cut(p.FocusWorkload, "/"); p.FocusWorkload != "" &&
+		(podSpecPath(kind) == nil || name == "") {
+		return fmt.Errorf(
+			"focusWorkload '%s' is not of the form 'Kind/name' of a workload", p.FocusWorkload)
+	}
+	if err = p.errIfIllegalPostCommands(); err != nil {
+		return err
+	}
+	if p.EnforceInstanceLabel && p.ReleaseName == "" {
+		return fmt.Errorf("enforceInstanceLabel requires releaseName")
+	}
+	if p.OutputComponent && p.OutputDir == "" {
+		return fmt.Errorf("outputComponent requires outputDir")
+	}
+	if p.EmitKustomization && p.OutputDir == "" {
+		return fmt.Errorf("emitKustomization requires outputDir")
+	}
+	if p.EmitKustomization && p.OutputComponent {
+		return fmt.Errorf("only one of emitKustomization and outputComponent may be set")
+	}
+	if p.Kubeconform != nil && !p.h.GeneralConfig().FnpLoadingOptions.EnableExec {
+		return fmt.Errorf("kubeconform requires --enable-exec")
+	}
+	if p.CosignVerify != nil {
+		if err = p.errIfIllegalCosignVerify(); err != nil {
+			return err
+		}
+	}
+	if p.HelmBin != "" {
+		if !p.h.GeneralConfig().FnpLoadingOptions.EnableExec {
+			return fmt.Errorf("helmBin requires --enable-exec")
+		}
+		if strings.ContainsRune(p.HelmBin, filepath.Separator) {
+			p.HelmBin = p.absPath(p.HelmBin)
+		}
+	}
+	if p.FallbackVersion != "" && (p.Version == "" || p.Repo == "") {
+		return fmt.Errorf("fallbackVersion requires version and repo")
+	}
+	if p.RegistryCAFile != "" {
+		if !strings.HasPrefix(p.Repo, "oci://") {
+			return fmt.Errorf("registryCAFile requires an oci:// repo")
+		}
+		if _, err = p.h.Loader().Load(p.RegistryCAFile); err != nil {
+			return errors.WrapPrefixf(err, "could not load registryCAFile")
+		}
+	}
+	if p.PullTimeout != "" {
+		if p.pullTimeout, err = time.ParseDuration(p.PullTimeout); err != nil {
+			return errors.WrapPrefixf(err, "invalid pullTimeout")
+		}
+	}
+	if p.ReleaseRevision < 0 {
+		return fmt.Errorf("releaseRevision must not be negative")
+	}
+	if p.HookTimeout != "" {
+		if _, err = time.ParseDuration(p.HookTimeout); err != nil {
+			return errors.WrapPrefixf(err, "invalid hookTimeout")
+		}
+	}
+	if p.WarnDeprecatedAPIs && p.KubeVersion != "" {
+		if _, _, err = parseKubeVersion(p.KubeVersion); err != nil {
+			return err
+		}
+	}
 
 	// ConfigHome is not loaded by the plugin, and can be located anywhere.
 	if p.ConfigHome == "" {
@@ -147,35 +441,205 @@ func (p *plugin) errIfIllegalValuesMerge() error {
 	return fmt.Errorf("valuesMerge must be one of %v", legalMergeOptions)
 }
 
-func (p *plugin) absChartHome() string {
-	var chartHome string
-	if filepath.IsAbs(p.ChartHome) {
-		chartHome = p.ChartHome
-	} else {
-		chartHome = filepath.Join(p.h.Loader().Root(), p.ChartHome)
+// loadAnnotationsFile adds the annotations of AnnotationsFile
+// to CommonAnnotations, unless already set there.
+func (p *plugin) loadAnnotationsFile() error {
+	b, err := p.h.Loader().Load(p.AnnotationsFile)
+	if err != nil {
+		return errors.WrapPrefixf(err, "could not load annotationsFile")
+	}
+	var annotations map[string]string
+	if err = yaml.Unmarshal(b, &annotations); err != nil {
+		return errors.WrapPrefixf(err, "could not parse annotationsFile")
+	}
+	if p.CommonAnnotations == nil {
+		p.CommonAnnotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		if _, found := p.CommonAnnotations[k]; !found {
+			p.CommonAnnotations[k] = v
+		}
+	}
+	return nil
+}
+
+// errIfIllegalReleaseName returns an error if ReleaseName
+// doesn't match ReleaseNamePattern.
+func (p *plugin) errIfIllegalReleaseName() error {
+	pattern, err := regexp.Compile(p.ReleaseNamePattern)
+	if err != nil {
+		return errors.WrapPrefixf(err, "invalid releaseNamePattern")
+	}
+	if !pattern.MatchString(p.ReleaseName) {
+		return fmt.Errorf("releaseName '%s' does not match releaseNamePattern '%s'",
+			p.ReleaseName, p.ReleaseNamePattern)
+	}
+	return nil
+}
+
+func (p *plugin) errIfIllegalDuplicateResources() error {
+	if p.DuplicateResources == "" {
+		return nil
+	}
+	for _, opt := range legalDuplicateModes {
+		if p.DuplicateResources == opt {
+			return nil
+		}
+	}
+	return fmt.Errorf("duplicateResources must be one of %v", legalDuplicateModes)
+}
+
+func (p *plugin) errIfIllegalResourceTransforms() error {
+	for _, key := range sortedKeys(p.ResourceTransforms) {
+		if kind, name, _ := strings.Cut(key, "/"); kind == "" || name == "" {
+			return fmt.Errorf("resourceTransforms key '%s' is not of the form 'Kind/name'", key)
+		}
+		for _, patch := range p.ResourceTransforms[key] {
+			if (patch.Patch == "") == (patch.Path == "") {
+				return fmt.Errorf(
+					"resourceTransforms of '%s' must each set one of patch and path", key)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *plugin) errIfIllegalCosignVerify() error {
+	if !p.h.GeneralConfig().FnpLoadingOptions.EnableExec {
+		return fmt.Errorf("cosignVerify requires --enable-exec")
+	}
+	if !strings.HasPrefix(p.Repo, "oci://") {
+		return fmt.Errorf("cosignVerify requires an oci:// repo")
+	}
+	if p.CosignVerify.Key == "" {
+		return fmt.Errorf("cosignVerify requires a key")
+	}
+	if _, err := p.h.Loader().Load(p.CosignVerify.Key); err != nil {
+		return errors.WrapPrefixf(err, "could not load cosignVerify key")
+	}
+	return nil
+}
+
+func (p *plugin) errIfIllegalHookWeightOrder() error {
+	if p.HookWeightOrder == "" {
+		return nil
+	}
+	for _, opt := range legalHookWeightOrders {
+		if p.HookWeightOrder == opt {
+			return nil
+		}
+	}
+	return fmt.Errorf("hookWeightOrder must be one of %v", legalHookWeightOrders)
+}
+
+// errIfIllegalCreateNamespace returns an error if the namespace options are inconsistent.
+func (p *plugin) errIfIllegalCreateNamespace() error {
+	if p.CreateNamespace && p.Namespace == "" {
+		return fmt.Errorf("createNamespace requires a namespace")
+	}
+	if !p.CreateNamespace &&
+		(len(p.NamespaceLabels) > 0 || len(p.NamespaceAnnotations) > 0) {
+		return fmt.Errorf(
+			"namespaceLabels and namespaceAnnotations require createNamespace")
 	}
+	return nil
+}
+
+// errIfIllegalPostCommands returns an error if PostCommands are
+// specified but exec is not enabled, or if an entry is empty.
+func (p *plugin) errIfIllegalPostCommands() error {
+	if len(p.PostCommands) == 0 {
+		return nil
+	}
+	if !p.h.GeneralConfig().FnpLoadingOptions.EnableExec {
+		return fmt.Errorf("postCommands requires --enable-exec")
+	}
+	for _, command := range p.PostCommands {
+		if len(command) == 0 {
+			return fmt.Errorf("postCommands entries cannot be empty")
+		}
+	}
+	return nil
+}
+
+// errIfIllegalCheckMode returns an error if mode is neither empty
+// nor one of the legal check modes.
+func errIfIllegalCheckMode(option, mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, opt := range legalCheckModes {
+		if mode == opt {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %v", option, legalCheckModes)
+}
 
+func (p *plugin) absChartHome() string {
+	if p.isVendored() {
+		return filepath.Join(p.tmpDir, "charts")
+	}
+	chartHome := p.absChartHomeRoot()
 	if p.Version != "" && p.Repo != "" {
 		return filepath.Join(chartHome, fmt.Sprintf("%s-%s", p.Name, p.Version))
 	}
 	return chartHome
 }
 
+// absChartHomeRoot returns the absolute path to ChartHome.
+func (p *plugin) absChartHomeRoot() string {
+	if filepath.IsAbs(p.ChartHome) {
+		return p.ChartHome
+	}
+	return filepath.Join(p.h.Loader().Root(), p.ChartHome)
+}
+
 func (p *plugin) runHelmCommand(
 	args []string) ([]byte, error) {
+	return p.runHelmCommandWithTimeout(args, 0)
+}
+
+// helmCommand returns the helm executable to run, HelmBin if set.
+func (p *plugin) helmCommand() string {
+	if p.HelmBin != "" {
+		return p.HelmBin
+	}
+	return p.h.GeneralConfig().HelmConfig.Command
+}
+
+// runHelmCommandWithTimeout runs helm, killing it after the
+// timeout.  A timeout of zero means no timeout.
+func (p *plugin) runHelmCommandWithTimeout(
+	args []string, timeout time.Duration) ([]byte, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
-	cmd := exec.Command(p.h.GeneralConfig().HelmConfig.Command, args...)
+	cmd := exec.CommandContext(ctx, p.helmCommand(), args...)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	env := []string{
 		fmt.Sprintf("HELM_CONFIG_HOME=%s", p.ConfigHome),
 		fmt.Sprintf("HELM_CACHE_HOME=%s/.cache", p.ConfigHome),
 		fmt.Sprintf("HELM_DATA_HOME=%s/.data", p.ConfigHome)}
+	if p.Kubeconfig != "" {
+		env = append(env, fmt.Sprintf("KUBECONFIG=%s", p.absPath(p.Kubeconfig)))
+	}
+	if p.PluginsHome != "" {
+		env = append(env, fmt.Sprintf("HELM_PLUGINS=%s", p.absPath(p.PluginsHome)))
+	}
 	cmd.Env = append(os.Environ(), env...)
 	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
 	if err != nil {
-		helm := p.h.GeneralConfig().HelmConfig.Command
+		helm := p.helmCommand()
 		err = errors.WrapPrefixf(
 			fmt.Errorf(
 				"unable to run: '%s %s' with env=%s (is '%s' installed?): %w",
@@ -189,58 +653,22 @@ func (p *plugin) runHelmCommand(
 // createNewMergedValuesFile replaces/merges original values file with ValuesInline.
 func (p *plugin) createNewMergedValuesFile() (
 	path string, err error) {
+	var b []byte
 	if p.ValuesMerge == valuesMergeOptionMerge ||
 		p.ValuesMerge == valuesMergeOptionOverride {
-		if err = p.replaceValuesInline(); err != nil {
-			return "", err
-		}
+		b, err = p.mergeValuesInline()
+	} else {
+		b, err = yaml.Marshal(p.ValuesInline)
 	}
-	var b []byte
-	b, err = yaml.Marshal(p.ValuesInline)
 	if err != nil {
 		return "", err
 	}
 	return p.writeValuesBytes(b)
 }
 
-func (p *plugin) replaceValuesInline() error {
-	pValues, err := p.h.Loader().Load(p.ValuesFile)
-	if err != nil {
-		return err
-	}
-	chValues, err := kyaml.Parse(string(pValues))
-	if err != nil {
-		return errors.WrapPrefixf(err, "could not parse values file into rnode")
-	}
-	inlineValues, err := kyaml.FromMap(p.ValuesInline)
-	if err != nil {
-		return errors.WrapPrefixf(err, "could not parse values inline into rnode")
-	}
-	var outValues *kyaml.RNode
-	switch p.ValuesMerge {
-	// Function `merge2.Merge` overrides values in dest with values from src.
-	// To achieve override or merge behavior, we pass parameters in different order.
-	// Object passed as dest will be modified, so we copy it just in case someone
-	// decides to use it after this is called.
-	case valuesMergeOptionOverride:
-		outValues, err = merge2.Merge(inlineValues, chValues.Copy(), kyaml.MergeOptions{})
-	case valuesMergeOptionMerge:
-		outValues, err = merge2.Merge(chValues, inlineValues.Copy(), kyaml.MergeOptions{})
-	}
-	if err != nil {
-		return errors.WrapPrefixf(err, "could not merge values")
-	}
-	mapValues, err := outValues.Map()
-	if err != nil {
-		return errors.WrapPrefixf(err, "could not parse merged values into map")
-	}
-	p.ValuesInline = mapValues
-	return err
-}
-
 // copyValuesFile to avoid branching.  TODO: get rid of this.
 func (p *plugin) copyValuesFile() (string, error) {
-	b, err := p.h.Loader().Load(p.ValuesFile)
+	b, err := p.loadValuesFile()
 	if err != nil {
 		return "", err
 	}
@@ -250,6 +678,12 @@ func (p *plugin) copyValuesFile() (string, error) {
 // Write a absolute path file in the tmp file system.
 func (p *plugin) writeValuesBytes(
 	b []byte) (string, error) {
+	if len(p.RemoveValuesKeys) > 0 {
+		var err error
+		if b, err = removeValuesKeys(b, p.RemoveValuesKeys); err != nil {
+			return "", err
+		}
+	}
 	if err := p.establishTmpDir(); err != nil {
 		return "", fmt.Errorf("cannot create tmp dir to write helm values")
 	}
@@ -266,32 +700,284 @@ func (p *plugin) cleanup() {
 // Generate implements generator
 func (p *plugin) Generate() (rm resmap.ResMap, err error) {
 	defer p.cleanup()
+	rm, err = p.generate()
+	return rm, p.redacted(err)
+}
+
+// GenerateMatrix inflates the chart once for each entry of
+// ValuesMatrix, which is merged into ValuesInline, e.g. to test
+// the chart against a number of configurations.
+func (p *plugin) GenerateMatrix() ([]resmap.ResMap, error) {
+	defer p.cleanup()
+	base := p.HelmChart
+	defer func() { p.HelmChart = base }()
+	result := make([]resmap.ResMap, 0, len(base.ValuesMatrix))
+	for i, values := range base.ValuesMatrix {
+		p.HelmChart = base
+		p.ValuesInline = copyValues(base.ValuesInline)
+		if err := mergeValues(p.ValuesInline, copyValues(values), "", false); err != nil {
+			return nil, err
+		}
+		rm, err := p.generate()
+		if err != nil {
+			return nil, errors.WrapPrefixf(p.redacted(err), "valuesMatrix entry %d", i)
+		}
+		result = append(result, rm)
+	}
+	return result, nil
+}
+
+// SetValuesProvider sets the source of the values underlying
+// ValuesInline, fetched for ValuesEnvironment.
+func (p *plugin) SetValuesProvider(vp ifc.ValuesProvider) {
+	p.valuesProvider = vp
+}
+
+// SetResourceFilter sets a predicate selecting the inflated resources
+// to keep; those it returns false for are dropped before any other
+// post-processing.
+func (p *plugin) SetResourceFilter(keep func(*resource.Resource) bool) {
+	p.resourceFilter = keep
+}
+
+// noValuesProvider is the default ValuesProvider, providing no values.
+type noValuesProvider struct{}
+
+func (noValuesProvider) Values(string, string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (p *plugin) generate() (rm resmap.ResMap, err error) {
 	if err = p.checkHelmVersion(); err != nil {
 		return nil, err
 	}
-	if path, exists := p.chartExistsLocally(); !exists {
+	if p.isVendored() {
+		// GenerateMatrix extracts the chart only once.
+		if _, extracted := p.chartExistsLocally(); !extracted {
+			if err = p.extractChartTarball(); err != nil {
+				return nil, err
+			}
+		}
+	} else if path, exists := p.chartExistsLocally(); !exists {
 		if p.Repo == "" {
 			return nil, fmt.Errorf(
 				"no repo specified for pull, no chart found at '%s'", path)
 		}
-		if _, err := p.runHelmCommand(p.pullCommand()); err != nil {
+		start := time.Now()
+		if err = p.pullChartOrFallback(); err != nil {
+			return nil, err
+		}
+		p.metrics.PullSeconds = time.Since(start).Seconds()
+	}
+	if p.PinLatest && p.Version == "" {
+		if err = p.pinLatestVersion(); err != nil {
+			return nil, err
+		}
+	}
+	if p.FailOnDeprecatedChart != "" {
+		if err = p.checkChartNotDeprecated(); err != nil {
 			return nil, err
 		}
 	}
-	if len(p.ValuesInline) > 0 {
+	if p.ExpectedAppVersion != "" {
+		if err = p.checkAppVersion(); err != nil {
+			return nil, err
+		}
+	}
+	if p.CompatV2 != "" {
+		if err = p.checkV2Constructs(); err != nil {
+			return nil, err
+		}
+	}
+	if p.FetchDependencies {
+		start := time.Now()
+		if err = p.fetchDependencies(); err != nil {
+			return nil, err
+		}
+		p.metrics.DependenciesSeconds = time.Since(start).Seconds()
+	}
+	if len(p.Tags) > 0 {
+		if err = p.errIfUndeclaredTags(); err != nil {
+			return nil, err
+		}
+	}
+	if p.ChartValuesFile != "" {
+		if _, err = os.Stat(p.ValuesFile); err != nil {
+			return nil, fmt.Errorf(
+				"chartValuesFile '%s' not found in chart '%s'", p.ChartValuesFile, p.Name)
+		}
+	}
+	if err = p.mergeProvidedValues(); err != nil {
+		return nil, err
+	}
+	if err = p.mergeSharedValues(); err != nil {
+		return nil, err
+	}
+	if p.ReportUnusedValues != "" {
+		if err = p.reportUnusedValues(); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case len(p.ValuesInline) > 0:
 		p.ValuesFile, err = p.createNewMergedValuesFile()
-	} else {
+	case p.usesPackagedValues():
+		// helm renders the chart with its packaged values anyway,
+		// which the chart may well not have.
+		p.ValuesFile = ""
+	default:
 		p.ValuesFile, err = p.copyValuesFile()
 	}
 	if err != nil {
 		return nil, err
 	}
+	if p.DumpValuesPath != "" {
+		if err = p.dumpValues(); err != nil {
+			return nil, err
+		}
+	}
+	if p.ValuesDiffPath != "" {
+		if err = p.writeValuesDiff(); err != nil {
+			return nil, err
+		}
+	}
+	if p.StrictValuesMerge {
+		if _, _, err = p.effectiveValues(true); err != nil {
+			return nil, err
+		}
+	}
+	if p.PrecheckRequired {
+		if err = p.checkRequiredValues(); err != nil {
+			return nil, err
+		}
+	}
+	if p.ValidateValuesSchema {
+		if err = p.checkValuesSchema(); err != nil {
+			return nil, err
+		}
+	}
+	chartHome := p.absChartHome()
+	if p.ReleaseRevision > 0 {
+		if chartHome, err = p.copyChartWithRevision(); err != nil {
+			return nil, err
+		}
+	}
+	limiter := concurrencyLimiterFor("template", p.MaxTemplateConcurrency)
+	limiter.acquire()
+	start := time.Now()
 	var stdout []byte
-	stdout, err = p.runHelmCommand(p.AsHelmArgs(p.absChartHome()))
+	stdout, err = p.runHelmCommand(p.AsHelmArgs(chartHome))
+	p.metrics.TemplateSeconds = time.Since(start).Seconds()
+	limiter.release()
+	if err != nil {
+		return nil, err
+	}
+	if p.RawOutputPath != "" {
+		if err = p.writeRawOutput(stdout); err != nil {
+			return nil, err
+		}
+	}
+	if p.normalizesLineEndings() {
+		stdout = bytes.ReplaceAll(stdout, []byte("\r\n"), []byte("\n"))
+	}
+	if stdout, err = p.runPostCommands(stdout); err != nil {
+		return nil, err
+	}
+	rm, err = p.parseHelmOutput(stdout)
 	if err != nil {
+		return nil, p.parseError(stdout, err)
+	}
+	if err = p.postProcess(rm); err != nil {
 		return nil, err
 	}
+	if p.MetricsPath != "" {
+		if err = p.writeMetrics(); err != nil {
+			return nil, err
+		}
+	}
+	if p.MergeWithExisting {
+		// Marked only now, so that outputs don't carry the mark.
+		for _, r := range rm.Resources() {
+			r.EnableMergeWithExisting()
+		}
+	}
+	return rm, nil
+}
 
+// normalizesLineEndings returns true if CRLF line endings in the
+// output of helm template are to be converted to LF.
+func (p *plugin) normalizesLineEndings() bool {
+	if p.NormalizeLineEndings == nil {
+		return runtime.GOOS == "windows"
+	}
+	return *p.NormalizeLineEndings
+}
+
+// runPostCommands pipes the output of helm template through each of
+// PostCommands in turn.
+func (p *plugin) runPostCommands(in []byte) ([]byte, error) {
+	for _, command := range p.PostCommands {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Dir = p.h.Loader().Root()
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return nil, errors.WrapPrefixf(
+				fmt.Errorf("post command '%s' failed: %w",
+					strings.Join(command, " "), err),
+				stderr.String())
+		}
+		in = stdout.Bytes()
+	}
+	return in, nil
+}
+
+// releaseRevisionRe matches the references to .Release.Revision
+// in chart templates.
+var releaseRevisionRe = regexp.MustCompile(`\$?\.Release\.Revision\b`) //nolint:gochecknoglobals
+
+// copyChartWithRevision copies the chart to the tmp dir, replacing
+// .Release.Revision by ReleaseRevision in its templates, and returns
+// the chart home of the copy.
+func (p *plugin) copyChartWithRevision() (string, error) {
+	if err := p.establishTmpDir(); err != nil {
+		return "", err
+	}
+	home := filepath.Join(p.tmpDir, "revised")
+	src := filepath.Join(p.absChartHome(), p.Name)
+	revision := []byte(strconv.Itoa(p.ReleaseRevision))
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(home, p.Name, rel)
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains("/"+filepath.ToSlash(rel), "/templates/") {
+			b = releaseRevisionRe.ReplaceAll(b, revision)
+		}
+		return os.WriteFile(dst, b, 0644)
+	})
+	return home, errors.WrapPrefixf(err, "unable to copy chart to set its revision")
+}
+
+// parseHelmOutput converts the output of helm template into a ResMap.
+func (p *plugin) parseHelmOutput(stdout []byte) (resmap.ResMap, error) {
+	if p.MergeConfigMaps || p.DuplicateResources != "" {
+		return p.parseMergingDocuments(stdout)
+	}
 	rm, resMapErr := p.h.ResmapFactory().NewResMapFromBytes(stdout)
 	if resMapErr == nil {
 		return rm, nil
@@ -303,6 +989,9 @@ func (p *plugin) Generate() (rm resmap.ResMap, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("error reading helm output: %w", err)
 	}
+	if nodes, err = expandLists(nodes); err != nil {
+		return nil, err
+	}
 
 	if len(nodes) != 0 {
 		rm, err = p.h.ResmapFactory().NewResMapFromRNodeSlice(nodes)
@@ -314,16 +1003,289 @@ func (p *plugin) Generate() (rm resmap.ResMap, err error) {
 	return nil, fmt.Errorf("could not parse bytes into resource map: %w", resMapErr)
 }
 
+// parseError puts an error parsing the helm output into context:
+// which chart rendered it, how large it is and where to inspect it.
+func (p *plugin) parseError(stdout []byte, err error) error {
+	hint := "set rawOutputPath to inspect it"
+	if p.RawOutputPath != "" {
+		hint = fmt.Sprintf("see '%s'", p.RawOutputPath)
+	}
+	return fmt.Errorf("unable to parse the %d bytes rendered from chart '%s' (%s): %w",
+		len(stdout), p.Name, hint, err)
+}
+
+// parseMergingDocuments parses the helm output, merging documents
+// holding the same resource, which would otherwise collide, as
+// configured by MergeConfigMaps and DuplicateResources.
+func (p *plugin) parseMergingDocuments(stdout []byte) (resmap.ResMap, error) {
+	r := &kio.ByteReader{Reader: bytes.NewReader(stdout), OmitReaderAnnotations: true}
+	nodes, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading helm output: %w", err)
+	}
+	if nodes, err = expandLists(nodes); err != nil {
+		return nil, err
+	}
+	if p.MergeConfigMaps {
+		if nodes, err = mergeConfigMaps(nodes); err != nil {
+			return nil, err
+		}
+	}
+	if p.DuplicateResources != "" {
+		if nodes, err = p.mergeDuplicates(nodes); err != nil {
+			return nil, err
+		}
+	}
+	rm, err := p.h.ResmapFactory().NewResMapFromRNodeSlice(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse rnode slice into resource map: %w", err)
+	}
+	return rm, nil
+}
+
+// expandLists replaces the lists among nodes, i.e. the resources of
+// kind List or FooList holding their items in a sequence, by their
+// items, as NewResMapFromBytes does.
+func expandLists(nodes []*kyaml.RNode) ([]*kyaml.RNode, error) {
+	var result []*kyaml.RNode
+	for _, n := range nodes {
+		items := n.Field("items")
+		if !strings.HasSuffix(n.GetKind(), "List") || items == nil ||
+			items.Value.YNode().Kind != kyaml.SequenceNode {
+			result = append(result, n)
+			continue
+		}
+		elements, err := items.Value.Elements()
+		if err != nil {
+			return nil, err
+		}
+		if elements, err = expandLists(elements); err != nil {
+			return nil, err
+		}
+		result = append(result, elements...)
+	}
+	return result, nil
+}
+
+// mergeConfigMaps merges the data of each ConfigMap into the first
+// ConfigMap of the same name and namespace.
+func mergeConfigMaps(nodes []*kyaml.RNode) ([]*kyaml.RNode, error) {
+	var result []*kyaml.RNode
+	seen := map[string]*kyaml.RNode{}
+	for _, n := range nodes {
+		if n.GetKind() != "ConfigMap" {
+			result = append(result, n)
+			continue
+		}
+		id := n.GetNamespace() + "/" + n.GetName()
+		first, found := seen[id]
+		if !found {
+			seen[id] = n
+			result = append(result, n)
+			continue
+		}
+		data, err := mergeData(id, first.GetDataMap(), n.GetDataMap())
+		if err != nil {
+			return nil, err
+		}
+		first.SetDataMap(data)
+		data, err = mergeData(id, first.GetBinaryDataMap(), n.GetBinaryDataMap())
+		if err != nil {
+			return nil, err
+		}
+		first.SetBinaryDataMap(data)
+	}
+	return result, nil
+}
+
+// mergeDuplicates merges documents holding the same resource into
+// the first of them, or returns an error naming the resource.
+func (p *plugin) mergeDuplicates(nodes []*kyaml.RNode) ([]*kyaml.RNode, error) {
+	var result []*kyaml.RNode
+	seen := map[string]int{}
+	for _, n := range nodes {
+		id := strings.Join([]string{
+			n.GetApiVersion(), n.GetKind(), n.GetNamespace(), n.GetName()}, "/")
+		i, found := seen[id]
+		if !found {
+			seen[id] = len(result)
+			result = append(result, n)
+			continue
+		}
+		if p.DuplicateResources == duplicateModeError {
+			return nil, fmt.Errorf(
+				"helm rendered %s %s in more than one document", n.GetKind(), n.GetName())
+		}
+		merged, err := merge2.Merge(n, result[i], kyaml.MergeOptions{})
+		if err != nil {
+			return nil, errors.WrapPrefixf(err,
+				"could not merge documents of %s %s", n.GetKind(), n.GetName())
+		}
+		result[i] = merged
+	}
+	return result, nil
+}
+
+func mergeData(id string, dst, src map[string]string) (map[string]string, error) {
+	for k, v := range src {
+		if existing, found := dst[k]; found && existing != v {
+			return nil, fmt.Errorf(
+				"conflicting values for key '%s' in ConfigMap '%s'",
+				k, strings.TrimPrefix(id, "/"))
+		}
+		dst[k] = v
+	}
+	return dst, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// absPath interprets a relative path as relative to the kustomization root.
+func (p *plugin) absPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(p.h.Loader().Root(), path)
+}
+
+// chartMetadata holds the fields of Chart.yaml consulted by the plugin.
+type chartMetadata struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	AppVersion   string            `json:"appVersion,omitempty"`
+	KubeVersion  string            `json:"kubeVersion,omitempty"`
+	Deprecated   bool              `json:"deprecated,omitempty"`
+	Dependencies []chartDependency `json:"dependencies,omitempty"`
+}
+
+type chartDependency struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// checkChartNotDeprecated reports the chart if its Chart.yaml
+// declares it deprecated.
+func (p *plugin) checkChartNotDeprecated() error {
+	m, err := p.readChartMetadata()
+	if err != nil {
+		return err
+	}
+	if !m.Deprecated {
+		return nil
+	}
+	return reportFindings(p.FailOnDeprecatedChart, "deprecated charts", []string{
+		fmt.Sprintf("chart '%s' version '%s' is deprecated", m.Name, m.Version)})
+}
+
+// checkAppVersion errors if the appVersion in the chart's Chart.yaml
+// isn't the expected one.
+func (p *plugin) checkAppVersion() error {
+	m, err := p.readChartMetadata()
+	if err != nil {
+		return err
+	}
+	if m.AppVersion != p.ExpectedAppVersion {
+		return fmt.Errorf(
+			"chart '%s' version '%s' has appVersion '%s', expected '%s'",
+			m.Name, m.Version, m.AppVersion, p.ExpectedAppVersion)
+	}
+	return nil
+}
+
+// v2TemplateConstructs are the template objects of helm v2 that helm 3
+// removed, with what to use instead.
+var v2TemplateConstructs = []struct { //nolint:gochecknoglobals
+	re          *regexp.Regexp
+	name, usage string
+}{
+	{regexp.MustCompile(`\.Release\.Time\b`), ".Release.Time", "'now'"},
+	{regexp.MustCompile(`\.Capabilities\.TillerVersion\b`),
+		".Capabilities.TillerVersion", ".Capabilities.HelmVersion"},
+}
+
+// checkV2Constructs reports the helm v2 constructs in the chart.
+func (p *plugin) checkV2Constructs() error {
+	dir := filepath.Join(p.absChartHome(), p.Name)
+	var findings []string
+	if _, err := os.Stat(filepath.Join(dir, "requirements.yaml")); err == nil {
+		findings = append(findings, fmt.Sprintf("chart '%s' declares its dependencies "+
+			"in requirements.yaml; move them to Chart.yaml and set apiVersion: v2", p.Name))
+	}
+	err := filepath.WalkDir(filepath.Join(dir, "templates"),
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			for _, c := range v2TemplateConstructs {
+				if c.re.Match(b) {
+					findings = append(findings, fmt.Sprintf(
+						"template '%s' uses %s, which helm 3 removed; use %s instead",
+						filepath.ToSlash(rel), c.name, c.usage))
+				}
+			}
+			return nil
+		})
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WrapPrefixf(err, "unable to read chart templates")
+	}
+	return reportFindings(p.CompatV2, "helm v2 constructs", findings)
+}
+
+// readChartMetadata reads Chart.yaml of the chart in chart home.
+func (p *plugin) readChartMetadata() (*chartMetadata, error) {
+	path := filepath.Join(p.absChartHome(), p.Name, "Chart.yaml")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "unable to read chart metadata")
+	}
+	var m chartMetadata
+	if err = yaml.Unmarshal(b, &m); err != nil {
+		return nil, errors.WrapPrefixf(err, "unable to parse %s", path)
+	}
+	return &m, nil
+}
+
 func (p *plugin) pullCommand() []string {
 	args := []string{
 		"pull",
 		"--untar",
 		"--untardir", p.absChartHome(),
 	}
+	if p.MaxChartBytes > 0 {
+		args = []string{"pull", "--destination", p.pullDir()}
+	}
 
 	switch {
 	case strings.HasPrefix(p.Repo, "oci://"):
-		args = append(args, strings.TrimSuffix(p.Repo, "/")+"/"+p.Name)
+		if p.RegistryCAFile != "" {
+			args = append(args, "--ca-file", p.absPath(p.RegistryCAFile))
+		}
+		if p.chartDigest != "" {
+			// The verified manifest, whatever the tag points to now.
+			return append(args, p.mirrored(p.ociChartRef())+"@"+p.chartDigest)
+		}
+		args = append(args, p.mirrored(p.ociChartRef()))
+	case strings.HasSuffix(p.Repo, ".tgz"):
+		// The chart's URL, with whatever protocol helm or
+		// its downloader plugins support, e.g. 's3://'.
+		return append(args, p.Repo)
 	case p.Repo != "":
 		args = append(args, "--repo", p.Repo)
 		fallthrough
@@ -334,6 +1296,9 @@ func (p *plugin) pullCommand() []string {
 	if p.Version != "" {
 		args = append(args, "--version", p.Version)
 	}
+	if p.repositoryCache != "" {
+		args = append(args, "--repository-cache", p.repositoryCache)
+	}
 	return args
 }
 
@@ -348,26 +1313,61 @@ func (p *plugin) chartExistsLocally() (string, bool) {
 	return path, s.IsDir()
 }
 
-// checkHelmVersion will return an error if the helm version is not V3
+// clusterLookupMinHelmMinor is the minor version of the first helm
+// V3 release whose 'helm template' takes --dry-run=server, on which
+// LookupMode 'cluster' relies.
+const clusterLookupMinHelmMinor = 13
+
+// checkHelmVersion will return an error if the helm version is not V3,
+// or too old for the options of the chart.
 func (p *plugin) checkHelmVersion() error {
 	stdout, err := p.runHelmCommand([]string{"version", "-c", "--short"})
 	if err != nil {
 		return err
 	}
-	r, err := regexp.Compile(`v?\d+(\.\d+)+`)
+	v, err := findHelmVersion(string(stdout))
 	if err != nil {
 		return err
 	}
-	v := r.FindString(string(stdout))
-	if v == "" {
-		return fmt.Errorf("cannot find version string in %s", string(stdout))
-	}
-	if v[0] == 'v' {
-		v = v[1:]
-	}
-	majorVersion := strings.Split(v, ".")[0]
-	if majorVersion != "3" {
+	parts := strings.Split(v, ".")
+	if parts[0] != "3" {
 		return fmt.Errorf("this plugin requires helm V3 but got v%s", v)
 	}
+	if p.LookupMode == types.HelmLookupModeCluster {
+		if minor, err := strconv.Atoi(parts[1]); err != nil || minor < clusterLookupMinHelmMinor {
+			return fmt.Errorf(
+				"lookupMode '%s' requires helm v3.%d or newer, for --dry-run=server, but got v%s",
+				p.LookupMode, clusterLookupMinHelmMinor, v)
+		}
+	}
 	return nil
 }
+
+// findHelmVersion extracts the version from the output of
+// 'helm version --short'.  Wrapper scripts may print banner lines
+// around it, so a line holding nothing but a version is preferred
+// over a version found elsewhere in the output.
+func findHelmVersion(output string) (string, error) {
+	r, err := regexp.Compile(`v?\d+(\.\d+)+`)
+	if err != nil {
+		return "", err
+	}
+	line, err := regexp.Compile(`^v?\d+(\.\d+)+(\+\S+)?$`)
+	if err != nil {
+		return "", err
+	}
+	v := ""
+	for _, l := range strings.Split(output, "\n") {
+		if l = strings.TrimSpace(l); line.MatchString(l) {
+			v = r.FindString(l)
+			break
+		}
+	}
+	if v == "" {
+		v = r.FindString(output)
+	}
+	if v == "" {
+		return "", fmt.Errorf("cannot find version string in %s", output)
+	}
+	return strings.TrimPrefix(v, "v"), nil
+}
@@ -0,0 +1,508 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// checkMetadataEntries returns an error if a resource has more
+// labels or annotations than MaxMetadataEntries.
+func (p *plugin) checkMetadataEntries(rm resmap.ResMap) error {
+	var offenders []string
+	for _, r := range rm.Resources() {
+		if n := len(r.GetLabels()); n > p.MaxMetadataEntries {
+			offenders = append(offenders, fmt.Sprintf("%s has %d labels", describe(r), n))
+		}
+		if n := len(r.GetAnnotations()); n > p.MaxMetadataEntries {
+			offenders = append(offenders, fmt.Sprintf("%s has %d annotations", describe(r), n))
+		}
+	}
+	if len(offenders) > 0 {
+		return fmt.Errorf("resources exceed maxMetadataEntries %d: %s",
+			p.MaxMetadataEntries, strings.Join(offenders, "; "))
+	}
+	return nil
+}
+
+// checkRequiredLabels returns an error if a resource lacks
+// any of RequireLabels.
+func (p *plugin) checkRequiredLabels(rm resmap.ResMap) error {
+	var offenders []string
+	for _, r := range rm.Resources() {
+		labels := r.GetLabels()
+		var missing []string
+		for _, key := range p.RequireLabels {
+			if _, found := labels[key]; !found {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			offenders = append(offenders, fmt.Sprintf(
+				"%s lacks %s", describe(r), strings.Join(missing, ", ")))
+		}
+	}
+	if len(offenders) > 0 {
+		return fmt.Errorf("resources lack required labels: %s",
+			strings.Join(offenders, "; "))
+	}
+	return nil
+}
+
+// checkResourceLimits returns an error listing the containers
+// of workloads that lack a CPU or memory limit.
+func checkResourceLimits(rm resmap.ResMap) error {
+	var offenders []string
+	for _, r := range rm.Resources() {
+		cs, err := containers(r)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			var missing []string
+			for _, res := range []string{"cpu", "memory"} {
+				limit, err := c.Pipe(kyaml.Lookup("resources", "limits", res))
+				if err != nil {
+					return err
+				}
+				if limit == nil {
+					missing = append(missing, res)
+				}
+			}
+			if len(missing) > 0 {
+				name, _ := c.GetString("name")
+				offenders = append(offenders, fmt.Sprintf("container '%s' of %s lacks %s",
+					name, describe(r), strings.Join(missing, ", ")))
+			}
+		}
+	}
+	if len(offenders) > 0 {
+		return fmt.Errorf("containers lack resource limits: %s",
+			strings.Join(offenders, "; "))
+	}
+	return nil
+}
+
+// checkNoLatestTag returns an error listing the containers of
+// workloads whose image is tagged 'latest', explicitly or not.
+func checkNoLatestTag(rm resmap.ResMap) error {
+	var offenders []string
+	for _, r := range rm.Resources() {
+		cs, err := containers(r)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			image, _ := c.GetString("image")
+			if image == "" || !strings.HasSuffix(canonicalImage(image), ":latest") {
+				continue
+			}
+			name, _ := c.GetString("name")
+			offenders = append(offenders, fmt.Sprintf(
+				"container '%s' of %s uses image '%s'", name, describe(r), image))
+		}
+	}
+	if len(offenders) > 0 {
+		return fmt.Errorf("images are not pinned to a tag other than latest: %s",
+			strings.Join(offenders, "; "))
+	}
+	return nil
+}
+
+// checkNoClusterScoped returns an error listing the cluster-scoped
+// resources among the inflated resources, if any.
+func checkNoClusterScoped(rm resmap.ResMap) error {
+	var offenders []string
+	for _, r := range rm.Resources() {
+		if r.GetGvk().IsClusterScoped() {
+			offenders = append(offenders, describe(r))
+		}
+	}
+	if len(offenders) > 0 {
+		return fmt.Errorf(
+			"chart renders cluster-scoped resources: %s", strings.Join(offenders, ", "))
+	}
+	return nil
+}
+
+// checkAllowedNamespaces returns an error listing the resources
+// in, or creating, a namespace not in AllowedNamespaces.
+func (p *plugin) checkAllowedNamespaces(rm resmap.ResMap) error {
+	allowed := map[string]bool{}
+	for _, ns := range p.AllowedNamespaces {
+		allowed[ns] = true
+	}
+	var offenders []string
+	for _, r := range rm.Resources() {
+		ns := r.GetNamespace()
+		if r.GetKind() == "Namespace" {
+			ns = r.GetName()
+		}
+		if ns != "" && !allowed[ns] {
+			offenders = append(offenders, describe(r))
+		}
+	}
+	if len(offenders) > 0 {
+		return fmt.Errorf("chart renders resources outside of allowedNamespaces %v: %s",
+			p.AllowedNamespaces, strings.Join(offenders, ", "))
+	}
+	return nil
+}
+
+// checkSingleNamespace fails if the resources are in more than one
+// namespace.
+func checkSingleNamespace(rm resmap.ResMap) error {
+	first := map[string]string{}
+	for _, r := range rm.Resources() {
+		ns := r.GetNamespace()
+		if _, found := first[ns]; ns != "" && !found {
+			first[ns] = describe(r)
+		}
+	}
+	if len(first) < 2 {
+		return nil
+	}
+	var namespaces []string
+	for _, ns := range sortedKeys(first) {
+		namespaces = append(namespaces, fmt.Sprintf("%s (%s)", ns, first[ns]))
+	}
+	return fmt.Errorf("chart renders resources in more than one namespace: %s",
+		strings.Join(namespaces, ", "))
+}
+
+// checkReferences reports ConfigMaps and Secrets that are referenced
+// by workloads but are not among the inflated resources.
+func (p *plugin) checkReferences(rm resmap.ResMap) error {
+	present := map[string]bool{}
+	for _, r := range rm.Resources() {
+		present[r.GetKind()+"/"+r.GetNamespace()+"/"+r.GetName()] = true
+	}
+	var dangling []string
+	for _, r := range rm.Resources() {
+		spec, err := podSpec(r)
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			continue
+		}
+		refs, err := configReferences(spec)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if !ref.optional && !present[ref.kind+"/"+r.GetNamespace()+"/"+ref.name] {
+				dangling = append(dangling, fmt.Sprintf(
+					"%s references missing %s %s", describe(r), ref.kind, ref.name))
+			}
+		}
+	}
+	return reportFindings(p.CheckReferences, "dangling references", dangling)
+}
+
+// checkServiceSelectors finds Services whose selector matches
+// the pods of no workload in their namespace.
+func (p *plugin) checkServiceSelectors(rm resmap.ResMap) error {
+	pods := map[string][]map[string]string{}
+	for _, r := range rm.Resources() {
+		labels, err := podLabels(r)
+		if err != nil {
+			return err
+		}
+		if labels != nil {
+			pods[r.GetNamespace()] = append(pods[r.GetNamespace()], labels)
+		}
+	}
+	var orphans []string
+	for _, r := range rm.Resources() {
+		if r.GetKind() != "Service" {
+			continue
+		}
+		selector, err := serviceSelector(r)
+		if err != nil {
+			return err
+		}
+		if len(selector) == 0 {
+			// Services without a selector are backed by
+			// manually managed endpoints.
+			continue
+		}
+		if !anySelected(selector, pods[r.GetNamespace()]) {
+			orphans = append(orphans, fmt.Sprintf(
+				"%s selects no pods", describe(r)))
+		}
+	}
+	return reportFindings(p.CheckServiceSelectors, "orphan services", orphans)
+}
+
+// checkPDBs finds PodDisruptionBudgets that allow no eviction of the
+// pods of a workload they select, given its replicas.
+func (p *plugin) checkPDBs(rm resmap.ResMap) error {
+	var findings []string
+	for _, pdb := range rm.Resources() {
+		if pdb.GetKind() != "PodDisruptionBudget" {
+			continue
+		}
+		selector, err := pdbSelector(pdb)
+		if err != nil {
+			return err
+		}
+		if selector == nil {
+			continue
+		}
+		for _, r := range rm.Resources() {
+			if r.GetNamespace() != pdb.GetNamespace() {
+				continue
+			}
+			replicas, err := workloadReplicas(r)
+			if err != nil {
+				return err
+			}
+			if replicas <= 0 {
+				continue
+			}
+			labels, err := podLabels(r)
+			if err != nil {
+				return err
+			}
+			if !anySelected(selector, []map[string]string{labels}) {
+				continue
+			}
+			reason, err := pdbBlocksEvictions(pdb, replicas)
+			if err != nil {
+				return errors.WrapPrefixf(err, "%s", describe(pdb))
+			}
+			if reason != "" {
+				findings = append(findings, fmt.Sprintf(
+					"%s allows no eviction from %s (replicas: %d, %s)",
+					describe(pdb), describe(r), replicas, reason))
+			}
+		}
+	}
+	return reportFindings(p.CheckPDBs, "unsatisfiable disruption budgets", findings)
+}
+
+// pdbSelector returns the matchLabels of a PodDisruptionBudget's
+// selector, or nil if it has matchExpressions, which aren't evaluated.
+func pdbSelector(r *resource.Resource) (map[string]string, error) {
+	expressions, err := r.Pipe(kyaml.Lookup("spec", "selector", "matchExpressions"))
+	if err != nil {
+		return nil, err
+	}
+	if expressions != nil && len(expressions.Content()) > 0 {
+		return nil, nil
+	}
+	selector := map[string]string{}
+	node, err := r.Pipe(kyaml.Lookup("spec", "selector", "matchLabels"))
+	if err != nil || node == nil {
+		return selector, err
+	}
+	err = node.VisitFields(func(f *kyaml.MapNode) error {
+		selector[f.Key.YNode().Value] = f.Value.YNode().Value
+		return nil
+	})
+	return selector, err
+}
+
+// workloadReplicas returns the replicas of a replicated workload,
+// which default to 1, or zero if the resource isn't one.
+func workloadReplicas(r *resource.Resource) (int, error) {
+	switch r.GetKind() {
+	case "Deployment", "StatefulSet", "ReplicaSet", "ReplicationController":
+	default:
+		return 0, nil
+	}
+	node, err := r.Pipe(kyaml.Lookup("spec", "replicas"))
+	if err != nil || node == nil {
+		return 1, err
+	}
+	replicas, err := strconv.Atoi(kyaml.GetValue(node))
+	if err != nil {
+		return 0, errors.WrapPrefixf(err, "invalid replicas of %s", describe(r))
+	}
+	return replicas, nil
+}
+
+// pdbBlocksEvictions returns why a PodDisruptionBudget allows no
+// eviction of the given number of pods, or "" if it allows some.
+// Percentages are rounded up, as kubernetes does.
+func pdbBlocksEvictions(r *resource.Resource, replicas int) (string, error) {
+	for _, field := range []string{"minAvailable", "maxUnavailable"} {
+		node, err := r.Pipe(kyaml.Lookup("spec", field))
+		if err != nil {
+			return "", err
+		}
+		if node == nil {
+			continue
+		}
+		value := kyaml.GetValue(node)
+		n, err := scaledIntOrPercent(value, replicas)
+		if err != nil {
+			return "", errors.WrapPrefixf(err, "invalid %s", field)
+		}
+		if (field == "minAvailable" && n >= replicas) ||
+			(field == "maxUnavailable" && n <= 0) {
+			return field + ": " + value, nil
+		}
+	}
+	return "", nil
+}
+
+// scaledIntOrPercent returns the number given by an int or a
+// percentage of total, rounded up.
+func scaledIntOrPercent(value string, total int) (int, error) {
+	if percent, isPercent := strings.CutSuffix(value, "%"); isPercent {
+		n, err := strconv.Atoi(percent)
+		if err != nil {
+			return 0, err
+		}
+		return (n*total + 99) / 100, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// serviceSelector returns the pod selector of a Service.
+func serviceSelector(r *resource.Resource) (map[string]string, error) {
+	node, err := r.Pipe(kyaml.Lookup("spec", "selector"))
+	if err != nil || node == nil {
+		return nil, err
+	}
+	selector := map[string]string{}
+	err = node.VisitFields(func(f *kyaml.MapNode) error {
+		selector[f.Key.YNode().Value] = f.Value.YNode().Value
+		return nil
+	})
+	return selector, err
+}
+
+// podLabels returns the labels of the pods of a workload,
+// or nil if the resource is not a workload.
+func podLabels(r *resource.Resource) (map[string]string, error) {
+	path := podSpecPath(r.GetKind())
+	if path == nil {
+		return nil, nil
+	}
+	template, err := r.Pipe(kyaml.Lookup(path[:len(path)-1]...))
+	if err != nil || template == nil {
+		return map[string]string{}, err
+	}
+	return template.GetLabels(), nil
+}
+
+// anySelected returns true if the selector matches any of the labels.
+func anySelected(selector map[string]string, labels []map[string]string) bool {
+	for _, l := range labels {
+		matches := true
+		for k, v := range selector {
+			if l[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// configReference is a reference from a pod to a ConfigMap or Secret.
+type configReference struct {
+	kind     string
+	name     string
+	optional bool
+}
+
+// configReferences returns the ConfigMaps and Secrets referenced by
+// the containers and volumes of a pod spec.
+func configReferences(spec *kyaml.RNode) ([]configReference, error) {
+	var refs []configReference
+	add := func(node *kyaml.RNode, kind string, path ...string) error {
+		ref, err := node.Pipe(kyaml.Lookup(path[:len(path)-1]...))
+		if err != nil || ref == nil {
+			return err
+		}
+		optional, _ := ref.GetFieldValue("optional")
+		name, err := ref.Pipe(kyaml.Lookup(path[len(path)-1]))
+		if err != nil {
+			return err
+		}
+		if v := kyaml.GetValue(name); v != "" {
+			refs = append(refs, configReference{
+				kind: kind, name: v, optional: optional == true})
+		}
+		return nil
+	}
+	cs, err := podContainers(spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cs {
+		err = visitElements(c, "envFrom", func(e *kyaml.RNode) error {
+			if err := add(e, "ConfigMap", "configMapRef", "name"); err != nil {
+				return err
+			}
+			return add(e, "Secret", "secretRef", "name")
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = visitElements(c, "env", func(e *kyaml.RNode) error {
+			if err := add(e, "ConfigMap", "valueFrom", "configMapKeyRef", "name"); err != nil {
+				return err
+			}
+			return add(e, "Secret", "valueFrom", "secretKeyRef", "name")
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = visitElements(spec, "volumes", func(v *kyaml.RNode) error {
+		if err := add(v, "ConfigMap", "configMap", "name"); err != nil {
+			return err
+		}
+		return add(v, "Secret", "secret", "secretName")
+	})
+	return refs, err
+}
+
+// visitElements calls fn with each element of the list field of node.
+func visitElements(node *kyaml.RNode, field string, fn func(*kyaml.RNode) error) error {
+	list, err := node.Pipe(kyaml.Lookup(field))
+	if err != nil || list == nil {
+		return err
+	}
+	return list.VisitElements(fn)
+}
+
+// reportFindings logs the findings of a check as warnings, or returns
+// them as an error, depending on mode.
+func reportFindings(mode, what string, findings []string) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	if mode == checkModeError {
+		return fmt.Errorf("found %s: %s", what, strings.Join(findings, "; "))
+	}
+	for _, finding := range findings {
+		log.Printf("Warning: %s", finding)
+	}
+	return nil
+}
+
+// describe returns a short human-readable identifier of a resource.
+func describe(r *resource.Resource) string {
+	if ns := r.GetNamespace(); ns != "" {
+		return fmt.Sprintf("%s %s/%s", r.GetKind(), ns, r.GetName())
+	}
+	return fmt.Sprintf("%s %s", r.GetKind(), r.GetName())
+}
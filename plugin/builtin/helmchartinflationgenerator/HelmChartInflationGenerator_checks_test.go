@@ -0,0 +1,429 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/resmap"
+	kusttest_test "sigs.k8s.io/kustomize/api/testutils/kusttest"
+)
+
+func TestHelmChartInflationGeneratorChecks(t *testing.T) {
+	serviceSelectorsHelm := fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  template:
+    metadata:
+      labels:
+        app: api
+        tier: backend
+    spec:
+      containers:
+      - name: api
+        image: api
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: backend
+spec:
+  selector:
+    tier: backend
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+spec:
+  selector:
+    app: apii
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: external
+`)
+	resourceLimitsHelm := fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        resources:
+          limits:
+            cpu: 500m
+            memory: 128Mi
+      - name: sidecar
+        image: envoy
+        resources:
+          limits:
+            cpu: 100m
+`)
+	namespacesHelm := fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: apps
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unscoped
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: escalate
+  namespace: kube-system
+`)
+	pdbsHelm := fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+  template:
+    metadata:
+      labels:
+        app: web
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: web
+spec:
+  minAvailable: 2
+  selector:
+    matchLabels:
+      app: web
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    metadata:
+      labels:
+        app: db
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: db
+spec:
+  maxUnavailable: 0%
+  selector:
+    matchLabels:
+      app: db
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        app: worker
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: worker
+spec:
+  minAvailable: 50%
+  selector:
+    matchLabels:
+      app: worker
+`)
+	annotatedHelm := fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  annotations:
+    owner: team-a
+`)
+	danglingConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: dangling
+name: dangling
+releaseName: test
+chartHome: ./charts
+`
+	labeledConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: labeled
+name: labeled
+releaseName: test
+chartHome: ./charts
+`
+
+	runGeneratorCases(t, []generatorCase{
+		{
+			name:     "disallowClusterScoped with a ClusterRole",
+			realHelm: true,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: clusterscoped
+name: clusterscoped
+releaseName: test
+chartHome: ./charts
+disallowClusterScoped: true
+`,
+			err:         "chart renders cluster-scoped resources: ClusterRole reader",
+			errExcludes: []string{"ServiceAccount"},
+		},
+		{
+			name:     "disallowClusterScoped with namespaced resources",
+			realHelm: true,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: workloads
+name: workloads
+releaseName: test
+chartHome: ./charts
+disallowClusterScoped: true
+`,
+			check: generates(4),
+		},
+		{
+			name:     "requireLabels with the labels",
+			realHelm: true,
+			config: labeledConfig + `
+requireLabels:
+- app
+- team
+`,
+		},
+		{
+			name:     "requireLabels without the labels",
+			realHelm: true,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: workloads
+name: workloads
+chartHome: ./charts
+requireLabels:
+- app
+- team
+`)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "resources lack required labels: ")
+				assert.Contains(t, err.Error(), "ConfigMap apps/web-config lacks app, team")
+				assert.Contains(t, err.Error(), "Deployment apps/web lacks team")
+				assert.Contains(t, err.Error(), "CronJob jobs/cleanup lacks app, team")
+			},
+		},
+		{
+			// The 'api' Service has a typo in its selector, and
+			// the 'external' Service has no selector.
+			name:   "checkServiceSelectors warn",
+			helm:   serviceSelectorsHelm,
+			config: testChartConfig + "checkServiceSelectors: warn\n",
+			check:  generates(4),
+		},
+		{
+			name:        "checkServiceSelectors error",
+			helm:        serviceSelectorsHelm,
+			config:      testChartConfig + "checkServiceSelectors: error\n",
+			err:         "found orphan services: Service api selects no pods",
+			errExcludes: []string{"backend", "external"},
+		},
+		{
+			name:   "requireResourceLimits",
+			helm:   resourceLimitsHelm,
+			config: testChartConfig + "requireResourceLimits: true\n",
+			err: "containers lack resource limits: " +
+				"container 'sidecar' of Deployment web lacks memory",
+		},
+		{
+			name: "requireResourceLimits after defaultResources",
+			helm: resourceLimitsHelm,
+			config: testChartConfig + `
+requireResourceLimits: true
+defaultResources:
+  limits:
+    memory: 64Mi
+`,
+			check: generates(1),
+		},
+		{
+			name: "allowedNamespaces",
+			helm: namespacesHelm,
+			config: testChartConfig + `
+allowedNamespaces:
+- apps
+`,
+			err: "chart renders resources outside of " +
+				"allowedNamespaces [apps]: Role kube-system/escalate",
+		},
+		{
+			name: "allowedNamespaces allowing all",
+			helm: namespacesHelm,
+			config: testChartConfig + `
+allowedNamespaces:
+- apps
+- kube-system
+`,
+			check: generates(3),
+		},
+		{
+			name: "forbidLatestTag",
+			helm: fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com:5000/migrate
+      containers:
+      - name: web
+        image: nginx:1.25
+      - name: sidecar
+        image: envoyproxy/envoy:latest
+      - name: pinned
+        image: busybox@sha256:3fbc632167424a6d997e74f52b878d7cc478225cffac6bc977eedfe51c7f4e79
+`),
+			config: testChartConfig + "forbidLatestTag: true\n",
+			err: "images are not pinned to a tag other than latest: " +
+				"container 'migrate' of Deployment web uses image 'registry.example.com:5000/migrate'; " +
+				"container 'sidecar' of Deployment web uses image 'envoyproxy/envoy:latest'",
+			errExcludes: []string{"nginx", "busybox"},
+		},
+		{
+			name: "requireSingleNamespace",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: team-a
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: team-a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: metrics
+  namespace: monitoring
+`),
+			config: testChartConfig + "requireSingleNamespace: true\n",
+			err: "chart renders resources in more than one namespace: " +
+				"monitoring (ConfigMap monitoring/metrics), team-a (ConfigMap team-a/settings)",
+		},
+		{
+			name:   "checkPDBs error",
+			helm:   pdbsHelm,
+			config: testChartConfig + "checkPDBs: error\n",
+			err: "found unsatisfiable disruption budgets: " +
+				"PodDisruptionBudget web allows no eviction from Deployment web " +
+				"(replicas: 2, minAvailable: 2); " +
+				"PodDisruptionBudget db allows no eviction from StatefulSet db " +
+				"(replicas: 1, maxUnavailable: 0%)",
+			errExcludes: []string{"worker"},
+		},
+		{
+			name:   "checkPDBs warn",
+			helm:   pdbsHelm,
+			config: testChartConfig + "checkPDBs: warn\n",
+			logs:   "Warning: PodDisruptionBudget web allows no eviction",
+		},
+		{
+			name:   "checkPDBs unknown",
+			helm:   pdbsHelm,
+			config: testChartConfig + "checkPDBs: fail\n",
+			err:    "checkPDBs must be one of",
+		},
+		{
+			name:     "checkReferences warn",
+			realHelm: true,
+			config:   danglingConfig + "checkReferences: warn\n",
+			check:    generates(2),
+		},
+		{
+			name:        "checkReferences error",
+			realHelm:    true,
+			config:      danglingConfig + "checkReferences: error\n",
+			err:         "found dangling references: Deployment app references missing ConfigMap missing",
+			errExcludes: []string{"present", "optional-secret"},
+		},
+		{
+			name:     "checkReferences unknown",
+			realHelm: true,
+			config:   danglingConfig + "checkReferences: ignore\n",
+			err:      "checkReferences must be one of [warn error]",
+		},
+		{
+			name:     "maxMetadataEntries",
+			realHelm: true,
+			config:   labeledConfig + "maxMetadataEntries: 3\n",
+			check:    generates(1),
+		},
+		{
+			name:     "maxMetadataEntries exceeded",
+			realHelm: true,
+			config:   labeledConfig + "maxMetadataEntries: 2\n",
+			err:      "ConfigMap labeled has 3 labels",
+		},
+		{
+			name: "maxMetadataEntries with stampTimestamp",
+			helm: annotatedHelm,
+			config: testChartConfig + `
+maxMetadataEntries: 2
+stampTimestamp: true
+`,
+		},
+		{
+			// The annotations set after rendering count as well.
+			name: "maxMetadataEntries exceeded after stamping",
+			helm: annotatedHelm,
+			config: testChartConfig + `
+maxMetadataEntries: 2
+stampTimestamp: true
+phaseAnnotations: true
+`,
+			err: "resources exceed maxMetadataEntries 2: ConfigMap settings has 3 annotations",
+		},
+	})
+}
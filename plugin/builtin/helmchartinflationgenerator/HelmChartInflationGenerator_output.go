@@ -0,0 +1,496 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// helmMetrics records how long the phases of an inflation took,
+// in seconds.  Phases that were skipped, e.g. the pull of a chart
+// found in ChartHome, took zero seconds.
+type helmMetrics struct {
+	PullSeconds         float64 `json:"pullSeconds"`
+	DependenciesSeconds float64 `json:"dependenciesSeconds"`
+	TemplateSeconds     float64 `json:"templateSeconds"`
+}
+
+// writeMetrics writes the recorded metrics to MetricsPath.
+func (p *plugin) writeMetrics() error {
+	b, err := yaml.Marshal(p.metrics)
+	if err != nil {
+		return err
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.MetricsPath, b), "failed to write metrics")
+}
+
+// writeRawOutput writes the output of helm template, comments
+// included, to RawOutputPath.
+func (p *plugin) writeRawOutput(stdout []byte) error {
+	if p.RawOutputProvenance {
+		var err error
+		if stdout, err = p.withProvenance(stdout); err != nil {
+			return err
+		}
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.RawOutputPath, stdout),
+		"failed to write raw helm output")
+}
+
+var (
+	documentSeparatorRegexp = regexp.MustCompile(`(?m)^---[ \t]*$`)      //nolint:gochecknoglobals
+	sourceCommentRegexp     = regexp.MustCompile(`(?m)^# Source: (.+)$`) //nolint:gochecknoglobals
+)
+
+// withProvenance prepends each document of the output of helm
+// template with a comment naming the chart, its version and the
+// template, taken from the '# Source:' comment helm adds.
+func (p *plugin) withProvenance(stdout []byte) ([]byte, error) {
+	version := p.chartVersion()
+	if version == "" {
+		m, err := p.readChartMetadata()
+		if err != nil {
+			return nil, err
+		}
+		version = m.Version
+	}
+	var b strings.Builder
+	for _, doc := range documentSeparatorRegexp.Split(string(stdout), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		template := "unknown"
+		if m := sourceCommentRegexp.FindStringSubmatch(doc); m != nil {
+			template = m[1]
+		}
+		fmt.Fprintf(&b, "---\n# Chart: %s %s, template: %s\n%s",
+			p.Name, version, template, strings.TrimPrefix(doc, "\n"))
+	}
+	return []byte(b.String()), nil
+}
+
+// compareGoldenFile errors with the differing lines if the inflated
+// resources don't match the ones in GoldenFile.
+func (p *plugin) compareGoldenFile(rm resmap.ResMap) error {
+	b, err := p.h.Loader().Load(p.GoldenFile)
+	if err != nil {
+		return errors.WrapPrefixf(err, "could not load goldenFile")
+	}
+	golden, err := p.h.ResmapFactory().NewResMapFromBytes(b)
+	if err != nil {
+		return errors.WrapPrefixf(err, "could not parse goldenFile '%s'", p.GoldenFile)
+	}
+	want, err := golden.AsYaml()
+	if err != nil {
+		return err
+	}
+	got, err := rm.AsYaml()
+	if err != nil {
+		return err
+	}
+	diff := lineDiff(
+		strings.Split(string(canonicalYaml(want)), "\n"),
+		strings.Split(string(canonicalYaml(got)), "\n"))
+	if len(diff) == 0 {
+		return nil
+	}
+	return fmt.Errorf("chart '%s' doesn't match goldenFile '%s':\n%s",
+		p.Name, p.GoldenFile, strings.Join(diff, "\n"))
+}
+
+// maxLineDiffCells bounds the size of the table lineDiff compares
+// the differing lines with, i.e. its memory use.
+const maxLineDiffCells = 1 << 22
+
+// lineDiff returns the lines removed from a ('-') and added to it ('+')
+// to get b, with up to two unchanged lines around them for context.
+// If too many lines differ to compare them all, only the first
+// differing lines are returned.
+func lineDiff(a, b []string) []string {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var lines []string
+	var changed []bool
+	add := func(line string, isChange bool) {
+		lines = append(lines, line)
+		changed = append(changed, isChange)
+	}
+	for _, line := range a[:prefix] {
+		add("  "+line, false)
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	truncated := len(ma)*len(mb) > maxLineDiffCells
+	if truncated {
+		add("- "+ma[0], true)
+		add("+ "+mb[0], true)
+	} else {
+		diffLines(ma, mb, add)
+		for _, line := range a[len(a)-suffix:] {
+			add("  "+line, false)
+		}
+	}
+	const context = 2
+	var diff []string
+	last := -1
+	for k := range lines {
+		near := false
+		for d := k - context; d <= k+context; d++ {
+			near = near || (d >= 0 && d < len(lines) && changed[d])
+		}
+		if !near {
+			continue
+		}
+		if last >= 0 && k > last+1 {
+			diff = append(diff, "...")
+		}
+		diff = append(diff, lines[k])
+		last = k
+	}
+	if truncated {
+		diff = append(diff, fmt.Sprintf(
+			"... %d removed and %d added lines, too many to compare", len(ma), len(mb)))
+	}
+	return diff
+}
+
+// diffLines adds the lines of a longest common subsequence of a and b
+// as unchanged, and the others as removed from a or added from b.
+func diffLines(a, b []string, add func(line string, isChange bool)) {
+	// lcs[i][j] is the length of the longest common
+	// subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] > lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			add("  "+a[i], false)
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			add("+ "+b[j], true)
+			j++
+		default:
+			add("- "+a[i], true)
+			i++
+		}
+	}
+}
+
+// writeOutputFile writes the inflated resources to OutputFile as a
+// single canonical YAML stream.
+func (p *plugin) writeOutputFile(rm resmap.ResMap) error {
+	var b []byte
+	var err error
+	if p.GroupOutputByKind {
+		b, err = groupedByKind(rm)
+	} else {
+		b, err = rm.AsYaml()
+	}
+	if err != nil {
+		return err
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.OutputFile, canonicalYaml(b)),
+		"failed to write output file")
+}
+
+// writeOutputDir writes each inflated resource to its own file in
+// OutputDir, adding a kustomization listing them if EmitKustomization,
+// or a Component one if OutputComponent.  YAML files left in OutputDir
+// by an earlier inflation are removed, so that the directory holds
+// only the current resources.
+func (p *plugin) writeOutputDir(rm resmap.ResMap) error {
+	dir, err := p.outputPath(p.OutputDir)
+	if err != nil {
+		return err
+	}
+	if err = p.h.FileSystem().MkdirAll(dir); err != nil {
+		return errors.WrapPrefixf(err, "failed to create output dir")
+	}
+	files := make([]string, 0, rm.Size())
+	written := map[string]bool{}
+	for _, r := range rm.Resources() {
+		b, err := r.AsYAML()
+		if err != nil {
+			return err
+		}
+		file := outputFileName(r)
+		if written[file] {
+			return fmt.Errorf(
+				"resource '%s' maps to output file '%s', already written for another resource",
+				r.CurId(), file)
+		}
+		if err = p.writeOutput(filepath.Join(dir, file), canonicalYaml(b)); err != nil {
+			return errors.WrapPrefixf(err, "failed to write output file '%s'", file)
+		}
+		files = append(files, file)
+		written[file] = true
+	}
+	meta := types.TypeMeta{
+		APIVersion: types.KustomizationVersion,
+		Kind:       types.KustomizationKind,
+	}
+	switch {
+	case p.OutputComponent:
+		meta = types.TypeMeta{
+			APIVersion: types.ComponentVersion,
+			Kind:       types.ComponentKind,
+		}
+	case !p.EmitKustomization:
+		return p.removeStaleOutput(dir, written)
+	}
+	b, err := yaml.Marshal(types.Kustomization{TypeMeta: meta, Resources: files})
+	if err != nil {
+		return err
+	}
+	file := konfig.DefaultKustomizationFileName()
+	if err = p.writeOutput(filepath.Join(dir, file), b); err != nil {
+		return errors.WrapPrefixf(err, "failed to write %s", strings.ToLower(meta.Kind))
+	}
+	written[file] = true
+	return p.removeStaleOutput(dir, written)
+}
+
+// removeStaleOutput removes the YAML files in the output dir that
+// weren't written by this inflation.
+func (p *plugin) removeStaleOutput(dir string, written map[string]bool) error {
+	fSys := p.h.FileSystem()
+	entries, err := fSys.ReadDir(dir)
+	if err != nil {
+		return errors.WrapPrefixf(err, "failed to read output dir")
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e)
+		if written[e] || fSys.IsDir(path) ||
+			(filepath.Ext(e) != ".yaml" && filepath.Ext(e) != ".yml") {
+			continue
+		}
+		if err = fSys.RemoveAll(path); err != nil {
+			return errors.WrapPrefixf(err, "failed to remove stale output file '%s'", e)
+		}
+	}
+	return nil
+}
+
+// writeOutputTarball writes the inflated resources to OutputTarball,
+// a file per kind.  The entries are sorted and carry no timestamps,
+// so that the same resources always make the same tarball.
+func (p *plugin) writeOutputTarball(rm resmap.ResMap) error {
+	byKind := map[string][]string{}
+	for _, r := range rm.Resources() {
+		b, err := r.AsYAML()
+		if err != nil {
+			return err
+		}
+		file := strings.ToLower(r.GetKind()) + ".yaml"
+		byKind[file] = append(byKind[file], string(b))
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range sortedKeys(byKind) {
+		b := canonicalYaml([]byte(strings.Join(byKind[file], "---\n")))
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    file,
+			Mode:    0644,
+			Size:    int64(len(b)),
+			ModTime: time.Unix(0, 0),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.OutputTarball, buf.Bytes()),
+		"failed to write output tarball")
+}
+
+// outputFileName returns the name of the file in OutputDir
+// holding the resource.  The kind is qualified by its API group, if
+// any, so that kinds of the same name in different groups don't
+// share a file.
+func outputFileName(r *resource.Resource) string {
+	kind := r.GetKind()
+	if g := r.GetGvk().Group; g != "" {
+		kind += "." + g
+	}
+	name := kind + "_" + r.GetName() + ".yaml"
+	if r.GetNamespace() != "" {
+		name = r.GetNamespace() + "_" + name
+	}
+	return strings.ToLower(name)
+}
+
+// groupedByKind renders the resources sorted by kind, each kind
+// headed by a comment naming it.
+func groupedByKind(rm resmap.ResMap) ([]byte, error) {
+	byKind := map[string][]*resource.Resource{}
+	for _, r := range rm.Resources() {
+		byKind[r.GetKind()] = append(byKind[r.GetKind()], r)
+	}
+	var docs []string
+	for _, kind := range sortedKeys(byKind) {
+		for i, r := range byKind[kind] {
+			b, err := r.AsYAML()
+			if err != nil {
+				return nil, err
+			}
+			doc := string(b)
+			if i == 0 {
+				doc = "# " + kind + "\n" + doc
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+// canonicalYaml strips trailing whitespace from every line and
+// normalizes document separators to a bare "---".
+func canonicalYaml(b []byte) []byte {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "---" {
+			line = "---"
+		}
+		lines[i] = line
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// helmReport summarizes the resources inflated from a chart.
+type helmReport struct {
+	Chart      string         `json:"chart"`
+	Version    string         `json:"version,omitempty"`
+	Resources  int            `json:"resources"`
+	Kinds      map[string]int `json:"kinds"`
+	Namespaces []string       `json:"namespaces,omitempty"`
+	Images     []string       `json:"images,omitempty"`
+}
+
+// writeReport writes a summary of the inflated resources to ReportPath.
+func (p *plugin) writeReport(rm resmap.ResMap) error {
+	report := helmReport{
+		Chart:     p.Name,
+		Version:   p.chartVersion(),
+		Resources: rm.Size(),
+		Kinds:     map[string]int{},
+	}
+	namespaces := map[string]bool{}
+	images := map[string]bool{}
+	for _, r := range rm.Resources() {
+		report.Kinds[r.GetKind()]++
+		if ns := r.GetNamespace(); ns != "" {
+			namespaces[ns] = true
+		}
+		cs, err := containers(r)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			image, err := c.Pipe(kyaml.Lookup("image"))
+			if err != nil {
+				return err
+			}
+			if v := kyaml.GetValue(image); v != "" {
+				images[v] = true
+			}
+		}
+	}
+	report.Namespaces = sortedKeys(namespaces)
+	report.Images = sortedKeys(images)
+	b, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.ReportPath, b), "failed to write report")
+}
+
+// outputPath returns the absolute path of an output file or
+// directory, which must lie within the kustomization root, also
+// once the symlinks along it are followed.
+func (p *plugin) outputPath(path string) (string, error) {
+	fSys := p.h.FileSystem()
+	root, err := filesys.ConfirmDir(fSys, p.h.Loader().Root())
+	if err != nil {
+		return "", err
+	}
+	abs := p.absPath(path)
+	existing := abs
+	for !fSys.Exists(existing) && filepath.Dir(existing) != existing {
+		existing = filepath.Dir(existing)
+	}
+	d, _, err := fSys.CleanedAbs(existing)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(p.h.Loader().Root(), abs) || !d.HasPrefix(root) {
+		return "", fmt.Errorf(
+			"security; output '%s' is not in or below '%s'", path, root)
+	}
+	return abs, nil
+}
+
+// writeOutput writes an output file through the kustomization's
+// file system, creating its directory.
+func (p *plugin) writeOutput(path string, b []byte) error {
+	abs, err := p.outputPath(path)
+	if err != nil {
+		return err
+	}
+	if err = p.h.FileSystem().MkdirAll(filepath.Dir(abs)); err != nil {
+		return err
+	}
+	return p.h.FileSystem().WriteFile(abs, b)
+}
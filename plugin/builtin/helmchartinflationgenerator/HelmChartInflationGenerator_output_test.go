@@ -0,0 +1,613 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/resmap"
+	kusttest_test "sigs.k8s.io/kustomize/api/testutils/kusttest"
+	"sigs.k8s.io/yaml"
+)
+
+func TestHelmChartInflationGeneratorOutputs(t *testing.T) {
+	// The harness roots are made in a directory private to this test,
+	// so that outputs escaping them would land there.
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	t.Setenv("TMPDIR", tmp)
+
+	outputDirResources := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: apps
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: apps
+---
+apiVersion: example.com/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: apps
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+`
+	goldenResources := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+  - port: 80
+`
+
+	runGeneratorCases(t, []generatorCase{
+		{
+			name:     "outputFile",
+			realHelm: true,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: workloads
+name: workloads
+releaseName: test
+chartHome: ./charts
+outputFile: all.yaml
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				output, err := th.GetFSys().ReadFile(filepath.Join(th.GetRoot(), "all.yaml"))
+				require.NoError(t, err)
+				docs := strings.Split(string(output), "\n---\n")
+				assert.Len(t, docs, rm.Size())
+				assert.False(t, strings.HasPrefix(string(output), "---"))
+				assert.True(t, strings.HasSuffix(string(output), "\n"))
+				for _, line := range strings.Split(string(output), "\n") {
+					assert.Equal(t, strings.TrimRight(line, " \t"), line)
+				}
+				assert.Contains(t, docs[0], "name: web-config")
+			},
+		},
+		{
+			name: "outputFile in a new directory",
+			config: testChartConfig + `
+outputFile: out/inflated.yaml
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				assert.FileExists(t, filepath.Join(th.GetRoot(), "out", "inflated.yaml"))
+			},
+		},
+		{
+			name: "groupOutputByKind",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: web
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+`),
+			config: testChartConfig + `
+outputFile: out.yaml
+groupOutputByKind: true
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "out.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `# ConfigMap
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+---
+# Endpoints
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: web
+---
+# NetworkPolicy
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny
+---
+# Service
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`, string(b))
+			},
+		},
+		{
+			name:     "testHooksOutputFile",
+			realHelm: true,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: hooks
+name: hooks
+releaseName: test
+chartHome: ./charts
+testHooksOutputFile: tests.yaml
+`,
+			expected: `
+apiVersion: v1
+data:
+  key: value
+kind: ConfigMap
+metadata:
+  name: app
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				tests, err := th.GetFSys().ReadFile(filepath.Join(th.GetRoot(), "tests.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    helm.sh/hook: test
+  name: app-test-connection
+spec:
+  containers:
+  - command:
+    - wget
+    - app:80
+    image: busybox:1.36
+    name: wget
+  restartPolicy: Never
+`, string(tests))
+			},
+		},
+		{
+			name: "rawOutputPath",
+			helm: fakeHelmRendering(`
+---
+# Source: test-chart/templates/configmap.yaml
+# The mode is read by the app at startup.
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: bar
+data:
+  mode: fast # or slow
+`),
+			config: testChartConfig + `
+rawOutputPath: raw.yaml
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				assert.Equal(t, 1, rm.Size())
+				raw, err := th.GetFSys().ReadFile(filepath.Join(th.GetRoot(), "raw.yaml"))
+				require.NoError(t, err)
+				assert.Contains(t, string(raw), "# Source: test-chart/templates/configmap.yaml\n")
+				assert.Contains(t, string(raw), "# The mode is read by the app at startup.\n")
+				assert.Contains(t, string(raw), "mode: fast # or slow\n")
+			},
+		},
+		{
+			name: "rawOutputProvenance",
+			helm: fakeHelmRendering(`
+---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`),
+			files: map[string]string{
+				"charts/app/Chart.yaml": "apiVersion: v2\nname: app\nversion: 1.2.3\n",
+			},
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+releaseName: test
+chartHome: ./charts
+rawOutputPath: raw.yaml
+rawOutputProvenance: true
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				assert.Equal(t, 2, rm.Size())
+				raw, err := os.ReadFile(filepath.Join(th.GetRoot(), "raw.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `---
+# Chart: app 1.2.3, template: app/templates/configmap.yaml
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+# Chart: app 1.2.3, template: app/templates/service.yaml
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`, string(raw))
+			},
+		},
+		{
+			name: "outputDir with emitKustomization",
+			helm: fakeHelmRendering(outputDirResources),
+			files: map[string]string{
+				"base/apps_configmap_removed.yaml": "stale",
+				"base/README.md":                   "kept",
+			},
+			config: testChartConfig + `
+outputDir: base
+emitKustomization: true
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				dir := filepath.Join(th.GetRoot(), "base")
+				b, err := os.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- apps_configmap_settings.yaml
+- apps_deployment.apps_web.yaml
+- apps_deployment.example.com_web.yaml
+- clusterrole.rbac.authorization.k8s.io_reader.yaml
+`, string(b))
+				entries, err := os.ReadDir(dir)
+				require.NoError(t, err)
+				names := make([]string, 0, len(entries))
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				assert.Equal(t, []string{
+					"README.md",
+					"apps_configmap_settings.yaml",
+					"apps_deployment.apps_web.yaml",
+					"apps_deployment.example.com_web.yaml",
+					"clusterrole.rbac.authorization.k8s.io_reader.yaml",
+					"kustomization.yaml",
+				}, names)
+			},
+		},
+		{
+			name: "outputDir with outputComponent",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: apps
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+`),
+			config: testChartConfig + `
+outputDir: component
+outputComponent: true
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				dir := filepath.Join(th.GetRoot(), "component")
+				b, err := os.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+resources:
+- apps_configmap_settings.yaml
+- clusterrole.rbac.authorization.k8s.io_reader.yaml
+`, string(b))
+				b, err = os.ReadFile(filepath.Join(dir, "clusterrole.rbac.authorization.k8s.io_reader.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+`, string(b))
+			},
+		},
+		{
+			name: "outputComponent without outputDir",
+			config: testChartConfig + `
+outputComponent: true
+`,
+			err: "outputComponent requires outputDir",
+		},
+		{
+			name: "both emitKustomization and outputComponent",
+			config: testChartConfig + `
+outputDir: base
+emitKustomization: true
+outputComponent: true
+`,
+			err: "only one of emitKustomization and outputComponent may be set",
+		},
+		{
+			name: "outputTarball",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: features
+`),
+			config: testChartConfig + `
+outputTarball: bundle.tgz
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				f, err := os.Open(filepath.Join(th.GetRoot(), "bundle.tgz"))
+				require.NoError(t, err)
+				defer f.Close()
+				gz, err := gzip.NewReader(f)
+				require.NoError(t, err)
+				tr := tar.NewReader(gz)
+				files := map[string]string{}
+				var names []string
+				for {
+					hdr, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(t, err)
+					var b bytes.Buffer
+					_, err = io.Copy(&b, tr) //nolint:gosec
+					require.NoError(t, err)
+					names = append(names, hdr.Name)
+					files[hdr.Name] = b.String()
+				}
+				assert.Equal(t, []string{"configmap.yaml", "deployment.yaml"}, names)
+				assert.Equal(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: features
+`, files["configmap.yaml"])
+				assert.Equal(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`, files["deployment.yaml"])
+			},
+		},
+		{
+			name:     "reportPath",
+			realHelm: true,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: workloads
+name: workloads
+releaseName: test
+chartHome: ./charts
+reportPath: report.yaml
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				report, err := th.GetFSys().ReadFile(filepath.Join(th.GetRoot(), "report.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `chart: workloads
+images:
+- busybox:1.36
+- nginx:1.25
+kinds:
+  ConfigMap: 1
+  CronJob: 1
+  Deployment: 1
+  Service: 1
+namespaces:
+- apps
+- jobs
+resources: 4
+`, string(report))
+			},
+		},
+		{
+			name: "metricsPath",
+			helm: fakeHelmPreamble + fakeHelmPullChart,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: https://example.com/charts
+version: 1.0.0
+releaseName: test
+fetchDependencies: true
+metricsPath: metrics.yaml
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "metrics.yaml"))
+				require.NoError(t, err)
+				var metrics map[string]float64
+				require.NoError(t, yaml.Unmarshal(b, &metrics))
+				for _, phase := range []string{"pullSeconds", "dependenciesSeconds", "templateSeconds"} {
+					require.Contains(t, metrics, phase)
+					assert.GreaterOrEqual(t, metrics[phase], 0.0, phase)
+				}
+				assert.Positive(t, metrics["pullSeconds"])
+				assert.Positive(t, metrics["templateSeconds"])
+			},
+		},
+		{
+			// Formatting and key order don't matter.
+			name: "goldenFile",
+			helm: fakeHelmRendering(goldenResources),
+			files: map[string]string{
+				"golden.yaml": `
+kind: Deployment
+apiVersion: apps/v1
+metadata: {name: web}
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.25
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80
+`,
+			},
+			config: testChartConfig + `
+goldenFile: golden.yaml
+`,
+		},
+		{
+			name: "stale goldenFile",
+			helm: fakeHelmRendering(goldenResources),
+			files: map[string]string{
+				"stale.yaml": strings.Replace(goldenResources, "replicas: 3", "replicas: 1", 1),
+			},
+			config: testChartConfig + `
+goldenFile: stale.yaml
+`,
+			err: `chart 'test-chart' doesn't match goldenFile 'stale.yaml':
+    name: web
+  spec:
+-   replicas: 1
++   replicas: 3
+    template:
+      spec:`,
+		},
+		{
+			// Every data line differs, too many to compare them all.
+			name: "goldenFile too different to compare",
+			helm: `
+if [ "$1" = "template" ]; then
+  printf 'apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: big\ndata:\n'
+  i=0
+  while [ $i -lt 2100 ]; do
+    echo "  k$i: new$i"
+    i=$((i+1))
+  done
+  exit 0
+fi
+` + fakeHelmPreamble,
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				var golden strings.Builder
+				golden.WriteString("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: big\ndata:\n")
+				for i := 0; i < 2100; i++ {
+					fmt.Fprintf(&golden, "  k%d: old%d\n", i, i)
+				}
+				th.WriteF(filepath.Join(th.GetRoot(), "golden.yaml"), golden.String())
+			},
+			config: testChartConfig + `
+goldenFile: golden.yaml
+`,
+			err: `chart 'test-chart' doesn't match goldenFile 'golden.yaml':
+  apiVersion: v1
+  data:
+-   k0: old0
++   k0: new0
+... 2100 removed and 2100 added lines, too many to compare`,
+		},
+		{
+			name: "outputs outside the root",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				outside := t.TempDir()
+				require.NoError(t, os.Symlink(outside, filepath.Join(th.GetRoot(), "linked")))
+				for option, path := range map[string]string{
+					"outputFile":    "../escaped.yaml",
+					"reportPath":    filepath.Join(outside, "report.yaml"),
+					"metricsPath":   "linked/metrics.yaml",
+					"outputDir":     "linked/out",
+					"outputTarball": "linked/bundle.tgz",
+				} {
+					err := th.ErrorFromLoadAndRunGenerator(testChartConfig + option + ": " + path + "\n")
+					require.Error(t, err, option)
+					assert.Contains(t, err.Error(),
+						fmt.Sprintf("security; output '%s' is not in or below", path), option)
+				}
+				entries, err := os.ReadDir(outside)
+				require.NoError(t, err)
+				assert.Empty(t, entries)
+				parent := filepath.Dir(th.GetRoot())
+				require.Equal(t, tmp, parent)
+				assert.NoFileExists(t, filepath.Join(parent, "escaped.yaml"))
+			},
+		},
+	})
+}
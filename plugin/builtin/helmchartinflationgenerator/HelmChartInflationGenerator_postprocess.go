@@ -0,0 +1,1486 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/kustomize/api/filters/patchjson6902"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// postProcess applies the optional post-rendering steps to the
+// inflated resources.  Resources are transformed first, then
+// validated, and finally written to any requested outputs.
+func (p *plugin) postProcess(rm resmap.ResMap) error {
+	if p.resourceFilter != nil {
+		if err := p.filterResources(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.DropAnnotations) > 0 {
+		if err := p.dropAnnotated(rm); err != nil {
+			return err
+		}
+	}
+	if p.FocusWorkload != "" {
+		if err := p.focusWorkload(rm); err != nil {
+			return err
+		}
+	}
+	if p.StripServerFields == nil || *p.StripServerFields {
+		if err := stripServerFields(rm); err != nil {
+			return err
+		}
+	}
+	if p.FixedNow != "" {
+		for _, r := range rm.Resources() {
+			if err := p.pinTimestamps(&r.RNode); err != nil {
+				return err
+			}
+		}
+	}
+	if p.CreateNamespace {
+		if err := p.addNamespace(rm); err != nil {
+			return err
+		}
+	}
+	if p.DefaultDenyNetworkPolicy {
+		if err := p.addDefaultDenyNetworkPolicy(rm); err != nil {
+			return err
+		}
+	}
+	if p.ReleaseService != "" {
+		if err := p.setReleaseService(rm); err != nil {
+			return err
+		}
+	}
+	if p.EnforceInstanceLabel {
+		if err := p.setInstanceLabel(rm); err != nil {
+			return err
+		}
+	}
+	for _, k := range sortedKeys(p.CommonAnnotations) {
+		if err := rm.AnnotateAll(k, p.CommonAnnotations[k]); err != nil {
+			return err
+		}
+	}
+	if p.PriorityClassName != "" {
+		if err := p.setPriorityClassName(rm); err != nil {
+			return err
+		}
+	}
+	if p.TestHooksOutputFile != "" {
+		if err := p.partitionTestHooks(rm); err != nil {
+			return err
+		}
+	}
+	if p.CaptureChartMetadata {
+		if err := p.appendChartMetadata(rm); err != nil {
+			return err
+		}
+	}
+	if p.HardenServiceAccounts {
+		if err := hardenServiceAccounts(rm); err != nil {
+			return err
+		}
+	}
+	if p.DefaultSecurityContext != nil {
+		if err := p.setDefaultSecurityContext(rm); err != nil {
+			return err
+		}
+	}
+	if p.DefaultResources != nil {
+		if err := p.setDefaultResources(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.DefaultNodeSelector) > 0 || len(p.DefaultTolerations) > 0 {
+		if err := p.setDefaultScheduling(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.DefaultTopologySpread) > 0 {
+		if err := p.setDefaultTopologySpread(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.MeshInjectionAnnotations) > 0 {
+		if err := p.setMeshInjectionAnnotations(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.CommonEnv) > 0 {
+		if err := p.setCommonEnv(rm); err != nil {
+			return err
+		}
+	}
+	if p.CanonicalizeImages {
+		if err := canonicalizeImages(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.LocalConfigResources) > 0 {
+		if err := p.markLocalConfig(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.ResourceTransforms) > 0 {
+		if err := p.applyResourceTransforms(rm); err != nil {
+			return err
+		}
+	}
+	if p.RequireResourceLimits {
+		if err := checkResourceLimits(rm); err != nil {
+			return err
+		}
+	}
+	if p.ForbidLatestTag {
+		if err := checkNoLatestTag(rm); err != nil {
+			return err
+		}
+	}
+	if p.DisallowClusterScoped {
+		if err := checkNoClusterScoped(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.AllowedNamespaces) > 0 {
+		if err := p.checkAllowedNamespaces(rm); err != nil {
+			return err
+		}
+	}
+	if p.RequireSingleNamespace {
+		if err := checkSingleNamespace(rm); err != nil {
+			return err
+		}
+	}
+	if p.CheckReferences != "" {
+		if err := p.checkReferences(rm); err != nil {
+			return err
+		}
+	}
+	if p.CheckServiceSelectors != "" {
+		if err := p.checkServiceSelectors(rm); err != nil {
+			return err
+		}
+	}
+	if p.CheckPDBs != "" {
+		if err := p.checkPDBs(rm); err != nil {
+			return err
+		}
+	}
+	if p.WarnDeprecatedAPIs {
+		if err := p.annotateDeprecatedAPIs(rm); err != nil {
+			return err
+		}
+	}
+	if p.DependencyReport {
+		if err := p.appendDependencyReport(rm); err != nil {
+			return err
+		}
+	}
+	if p.ConfigChecksums {
+		if err := stampConfigChecksums(rm); err != nil {
+			return err
+		}
+	}
+	if p.PhaseAnnotations {
+		if err := annotatePhases(rm); err != nil {
+			return err
+		}
+	}
+	if p.HookWeightOrder != "" {
+		if err := p.orderByHookWeight(rm); err != nil {
+			return err
+		}
+	}
+	if p.StampChecksum {
+		if err := p.appendChecksum(rm); err != nil {
+			return err
+		}
+	}
+	if p.StampTimestamp {
+		if err := rm.AnnotateAll(
+			generatedAtAnnotation, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	if p.StampKubeVersion {
+		if err := p.stampKubeVersion(rm); err != nil {
+			return err
+		}
+	}
+	if p.SortMetadataKeys {
+		if err := sortMetadataKeys(rm); err != nil {
+			return err
+		}
+	}
+	// The metadata is checked once all of the above have set
+	// their labels and annotations, and added their resources.
+	if p.MaxMetadataEntries > 0 {
+		if err := p.checkMetadataEntries(rm); err != nil {
+			return err
+		}
+	}
+	if len(p.RequireLabels) > 0 {
+		if err := p.checkRequiredLabels(rm); err != nil {
+			return err
+		}
+	}
+	if p.Kubeconform != nil {
+		if err := p.runKubeconform(rm); err != nil {
+			return err
+		}
+	}
+	if p.OpenAPISchema != "" {
+		if err := p.validateOpenAPISchema(rm); err != nil {
+			return err
+		}
+	}
+	if p.ReportPath != "" {
+		if err := p.writeReport(rm); err != nil {
+			return err
+		}
+	}
+	if p.GoldenFile != "" {
+		if err := p.compareGoldenFile(rm); err != nil {
+			return err
+		}
+	}
+	if p.OutputFile != "" {
+		if err := p.writeOutputFile(rm); err != nil {
+			return err
+		}
+	}
+	if p.OutputDir != "" {
+		if err := p.writeOutputDir(rm); err != nil {
+			return err
+		}
+	}
+	if p.OutputTarball != "" {
+		if err := p.writeOutputTarball(rm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyResourceTransforms applies the ResourceTransforms to the
+// resources they're keyed by.
+func (p *plugin) applyResourceTransforms(rm resmap.ResMap) error {
+	for _, key := range sortedKeys(p.ResourceTransforms) {
+		kind, name, _ := strings.Cut(key, "/")
+		var targets []*resource.Resource
+		for _, r := range rm.Resources() {
+			if r.GetKind() == kind && r.GetName() == name {
+				targets = append(targets, r)
+			}
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("no resource matches resourceTransforms key '%s'", key)
+		}
+		for i, patch := range p.ResourceTransforms[key] {
+			text := patch.Patch
+			if patch.Path != "" {
+				b, err := p.h.Loader().Load(patch.Path)
+				if err != nil {
+					return errors.WrapPrefixf(err, "could not load resourceTransforms patch")
+				}
+				text = string(b)
+			}
+			for _, r := range targets {
+				if err := p.applyPatch(r, text); err != nil {
+					return errors.WrapPrefixf(err,
+						"resourceTransforms of '%s', patch %d", key, i)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applyPatch applies a JSON patch, or a strategic merge patch
+// that may leave out the resource's apiVersion, kind and metadata.
+func (p *plugin) applyPatch(r *resource.Resource, text string) error {
+	var ops []interface{}
+	if err := yaml.Unmarshal([]byte(text), &ops); err == nil {
+		return r.ApplyFilter(patchjson6902.Filter{Patch: text})
+	}
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(text), &m); err != nil {
+		return errors.WrapPrefixf(err, "unable to parse patch")
+	}
+	m["apiVersion"] = r.GetApiVersion()
+	m["kind"] = r.GetKind()
+	meta, _ := m["metadata"].(map[string]interface{})
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	meta["name"] = r.GetName()
+	if r.GetNamespace() != "" {
+		meta["namespace"] = r.GetNamespace()
+	}
+	m["metadata"] = meta
+	patch, err := p.h.ResmapFactory().RF().FromMapAndOption(m, nil)
+	if err != nil {
+		return err
+	}
+	return r.ApplySmPatch(patch)
+}
+
+// serverManagedFields are the metadata fields set by the API server,
+// which have no place in a manifest.
+var serverManagedFields = []string{ //nolint:gochecknoglobals
+	"creationTimestamp", "generation", "managedFields",
+	"resourceVersion", "selfLink", "uid",
+}
+
+// stripServerFields removes the status, the server managed metadata,
+// also of pod templates, and empty annotations from the resources.
+func stripServerFields(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		if err := r.PipeE(kyaml.Clear("status")); err != nil {
+			return err
+		}
+		paths := [][]string{{"metadata"}}
+		if path := podSpecPath(r.GetKind()); path != nil {
+			paths = append(paths, append(path[:len(path)-1:len(path)-1], "metadata"))
+		}
+		for _, path := range paths {
+			metadata, err := r.Pipe(kyaml.Lookup(path...))
+			if err != nil {
+				return err
+			}
+			if metadata == nil {
+				continue
+			}
+			for _, field := range serverManagedFields {
+				if err = metadata.PipeE(kyaml.Clear(field)); err != nil {
+					return err
+				}
+			}
+			if f := metadata.Field(kyaml.AnnotationsField); f != nil &&
+				len(f.Value.YNode().Content) == 0 {
+				if err = metadata.PipeE(kyaml.Clear(kyaml.AnnotationsField)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// timestampLayouts are the layouts of the timestamps pinned by
+// FixedNow: RFC3339, with or without fractional seconds, and the
+// format in which helm renders 'now' unless told otherwise.
+var timestampLayouts = []string{ //nolint:gochecknoglobals
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+}
+
+// timestampedMetadata are the paths to the metadata, of a resource
+// and of the pods it templates, whose annotation and label values
+// are pinned by FixedNow.
+var timestampedMetadata = [][]string{ //nolint:gochecknoglobals
+	{kyaml.MetadataField},
+	{"spec", "template", kyaml.MetadataField},
+	{"spec", "jobTemplate", "spec", "template", kyaml.MetadataField},
+}
+
+// pinTimestamps replaces every annotation and label value in the
+// timestampedMetadata of node that is a timestamp in one of
+// timestampLayouts by fixedNow, in that layout.  Keys, and values
+// elsewhere, e.g. the data of a ConfigMap, are left alone.
+func (p *plugin) pinTimestamps(node *kyaml.RNode) error {
+	for _, path := range timestampedMetadata {
+		for _, field := range []string{kyaml.AnnotationsField, kyaml.LabelsField} {
+			m, err := node.Pipe(kyaml.Lookup(append(path, field)...))
+			if err != nil {
+				return err
+			}
+			if m == nil || m.YNode().Kind != kyaml.MappingNode {
+				continue
+			}
+			content := m.YNode().Content
+			for i := 1; i < len(content); i += 2 {
+				p.pinTimestamp(content[i])
+			}
+		}
+	}
+	return nil
+}
+
+// pinTimestamp replaces the value of node by fixedNow if it is a
+// timestamp in one of timestampLayouts, keeping the layout.
+func (p *plugin) pinTimestamp(node *kyaml.Node) {
+	if node.Kind != kyaml.ScalarNode {
+		return
+	}
+	for _, layout := range timestampLayouts {
+		if _, err := time.Parse(layout, node.Value); err == nil {
+			node.Value = p.fixedNow.UTC().Format(layout)
+			return
+		}
+	}
+}
+
+// addDefaultDenyNetworkPolicy adds a NetworkPolicy selecting all pods
+// of Namespace without allowing any traffic, unless one exists.
+func (p *plugin) addDefaultDenyNetworkPolicy(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		// Charts usually leave the namespace of their
+		// resources to the release namespace.
+		ns := r.GetNamespace()
+		if ns == "" {
+			ns = p.Namespace
+		}
+		if r.GetKind() != "NetworkPolicy" || ns != p.Namespace {
+			continue
+		}
+		selector, err := r.Pipe(kyaml.Lookup("spec", "podSelector"))
+		if err != nil {
+			return err
+		}
+		if selector == nil || len(selector.YNode().Content) == 0 {
+			return nil
+		}
+	}
+	metadata := map[string]interface{}{
+		"name": p.instanceName() + "-default-deny",
+	}
+	if p.Namespace != "" {
+		metadata["namespace"] = p.Namespace
+	}
+	return rm.Append(p.h.ResmapFactory().RF().FromMap(map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{},
+			"policyTypes": []interface{}{"Ingress", "Egress"},
+		},
+	}))
+}
+
+// setReleaseService replaces the managed-by label value that helm
+// derives from .Release.Service with ReleaseService.
+func (p *plugin) setReleaseService(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		labels := r.GetLabels()
+		if _, found := labels[managedByLabel]; !found {
+			continue
+		}
+		labels[managedByLabel] = p.ReleaseService
+		if err := r.SetLabels(labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setInstanceLabel sets the instance label of every resource
+// to ReleaseName.
+func (p *plugin) setInstanceLabel(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		labels := r.GetLabels()
+		labels[instanceLabel] = p.ReleaseName
+		if err := r.SetLabels(labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterResources removes the resources that the resourceFilter
+// rejects.
+func (p *plugin) filterResources(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		if p.resourceFilter(r) {
+			continue
+		}
+		if err := rm.Remove(r.CurId()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// focusWorkload removes the resources but FocusWorkload and the
+// ConfigMaps, Secrets, ServiceAccounts and Services it depends on.
+func (p *plugin) focusWorkload(rm resmap.ResMap) error {
+	kind, name, _ := strings.Cut(p.FocusWorkload, "/")
+	var workload *resource.Resource
+	for _, r := range rm.Resources() {
+		if r.GetKind() == kind && r.GetName() == name {
+			workload = r
+			break
+		}
+	}
+	if workload == nil {
+		return fmt.Errorf("no resource matches focusWorkload '%s'", p.FocusWorkload)
+	}
+	spec, err := podSpec(workload)
+	if err != nil {
+		return err
+	}
+	if spec == nil {
+		return fmt.Errorf("focusWorkload '%s' has no pod spec", p.FocusWorkload)
+	}
+	refs, err := configReferences(spec)
+	if err != nil {
+		return err
+	}
+	if sa, _ := spec.GetString("serviceAccountName"); sa != "" {
+		refs = append(refs, configReference{kind: "ServiceAccount", name: sa})
+	}
+	err = visitElements(spec, "imagePullSecrets", func(e *kyaml.RNode) error {
+		if secret, _ := e.GetString("name"); secret != "" {
+			refs = append(refs, configReference{kind: "Secret", name: secret})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{kind + "/" + name: true}
+	for _, ref := range refs {
+		keep[ref.kind+"/"+ref.name] = true
+	}
+	labels, err := podLabels(workload)
+	if err != nil {
+		return err
+	}
+	for _, r := range rm.Resources() {
+		if r.GetKind() != "Service" || r.GetNamespace() != workload.GetNamespace() {
+			continue
+		}
+		selector, err := serviceSelector(r)
+		if err != nil {
+			return err
+		}
+		if len(selector) > 0 && anySelected(selector, []map[string]string{labels}) {
+			keep["Service/"+r.GetName()] = true
+		}
+	}
+	for _, r := range rm.Resources() {
+		if r.GetNamespace() == workload.GetNamespace() && keep[r.GetKind()+"/"+r.GetName()] {
+			continue
+		}
+		if err = rm.Remove(r.CurId()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropAnnotated removes the resources carrying any of DropAnnotations.
+func (p *plugin) dropAnnotated(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		annotations := r.GetAnnotations()
+		for _, key := range p.DropAnnotations {
+			if _, found := annotations[key]; !found {
+				continue
+			}
+			if err := rm.Remove(r.CurId()); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// partitionTestHooks moves helm test hooks out of the inflated
+// resources and into TestHooksOutputFile.
+func (p *plugin) partitionTestHooks(rm resmap.ResMap) error {
+	tests := resmap.New()
+	for _, r := range rm.Resources() {
+		if !isTestHook(r) {
+			continue
+		}
+		if err := tests.Append(r); err != nil {
+			return err
+		}
+		if err := rm.Remove(r.CurId()); err != nil {
+			return err
+		}
+	}
+	b, err := tests.AsYaml()
+	if err != nil {
+		return err
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.TestHooksOutputFile, canonicalYaml(b)),
+		"failed to write test hooks")
+}
+
+// appendChartMetadata adds a ConfigMap holding the chart's Chart.yaml
+// and README.md to the inflated resources.
+func (p *plugin) appendChartMetadata(rm resmap.ResMap) error {
+	data := map[string]interface{}{}
+	for _, file := range []string{"Chart.yaml", "README.md"} {
+		b, err := os.ReadFile(filepath.Join(p.absChartHome(), p.Name, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return errors.WrapPrefixf(err, "unable to read chart %s", file)
+		}
+		data[file] = string(b)
+	}
+	metadata := map[string]interface{}{
+		"name": p.instanceName() + "-chart-metadata",
+	}
+	if p.Namespace != "" {
+		metadata["namespace"] = p.Namespace
+	}
+	return rm.Append(p.h.ResmapFactory().RF().FromMap(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   metadata,
+		"data":       data,
+	}))
+}
+
+// addNamespace adds the release Namespace, carrying NamespaceLabels
+// and NamespaceAnnotations, to the inflated resources.  If the chart
+// renders the Namespace itself, the labels and annotations are added
+// to that one instead.
+func (p *plugin) addNamespace(rm resmap.ResMap) error {
+	ns, err := rm.GetById(resid.NewResId(
+		resid.NewGvk("", "v1", "Namespace"), p.Namespace))
+	if err != nil {
+		ns = p.h.ResmapFactory().RF().FromMap(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata": map[string]interface{}{
+				"name": p.Namespace,
+			},
+		})
+		if err = rm.Append(ns); err != nil {
+			return err
+		}
+	}
+	labels := ns.GetLabels()
+	for k, v := range p.NamespaceLabels {
+		labels[k] = v
+	}
+	if err = ns.SetLabels(labels); err != nil {
+		return err
+	}
+	annotations := ns.GetAnnotations()
+	for k, v := range p.NamespaceAnnotations {
+		annotations[k] = v
+	}
+	return ns.SetAnnotations(annotations)
+}
+
+// listedDependency is a dependency as listed by 'helm dependency list'.
+type listedDependency struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository"`
+	Status     string `json:"status"`
+}
+
+// appendDependencyReport adds a ConfigMap listing the
+// chart's dependencies to the inflated resources.
+func (p *plugin) appendDependencyReport(rm resmap.ResMap) error {
+	stdout, err := p.runHelmCommand([]string{
+		"dependency", "list", filepath.Join(p.absChartHome(), p.Name)})
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(parseDependencyList(stdout))
+	if err != nil {
+		return err
+	}
+	metadata := map[string]interface{}{
+		"name": p.instanceName() + "-dependencies",
+	}
+	if p.Namespace != "" {
+		metadata["namespace"] = p.Namespace
+	}
+	return rm.Append(p.h.ResmapFactory().RF().FromMap(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   metadata,
+		"data": map[string]interface{}{
+			"dependencies.yaml": string(b),
+		},
+	}))
+}
+
+// parseDependencyList parses the table printed by 'helm dependency
+// list', ignoring anything before its header, such as warnings.
+func parseDependencyList(stdout []byte) []listedDependency {
+	deps := []listedDependency{}
+	inTable := false
+	for _, line := range strings.Split(string(stdout), "\n") {
+		fields := strings.Fields(line)
+		if !inTable {
+			inTable = len(fields) > 0 && fields[0] == "NAME"
+			continue
+		}
+		if len(fields) < 4 { //nolint:gomnd
+			continue
+		}
+		deps = append(deps, listedDependency{
+			Name:       fields[0],
+			Version:    fields[1],
+			Repository: fields[2],
+			Status:     strings.Join(fields[3:], " "),
+		})
+	}
+	return deps
+}
+
+// stampKubeVersion annotates the resources with the chart's
+// kubeVersion constraint, if it declares one.
+func (p *plugin) stampKubeVersion(rm resmap.ResMap) error {
+	m, err := p.readChartMetadata()
+	if err != nil {
+		return err
+	}
+	if m.KubeVersion == "" {
+		return nil
+	}
+	return rm.AnnotateAll(kubeVersionAnnotation, m.KubeVersion)
+}
+
+// sortMetadataKeys sorts the labels and annotations of the
+// resources by key.
+func sortMetadataKeys(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		for _, field := range []string{"labels", "annotations"} {
+			m, err := r.Pipe(kyaml.Lookup("metadata", field))
+			if err != nil {
+				return err
+			}
+			if m == nil || m.YNode().Kind != kyaml.MappingNode {
+				continue
+			}
+			content := m.YNode().Content
+			pairs := make([][2]*kyaml.Node, 0, len(content)/2)
+			for i := 0; i+1 < len(content); i += 2 {
+				pairs = append(pairs, [2]*kyaml.Node{content[i], content[i+1]})
+			}
+			sort.SliceStable(pairs, func(i, j int) bool {
+				return pairs[i][0].Value < pairs[j][0].Value
+			})
+			for i, pair := range pairs {
+				content[2*i], content[2*i+1] = pair[0], pair[1]
+			}
+		}
+	}
+	return nil
+}
+
+// appendChecksum adds a ConfigMap annotated with the checksum
+// of the inflated resources.
+func (p *plugin) appendChecksum(rm resmap.ResMap) error {
+	b, err := rm.AsYaml()
+	if err != nil {
+		return err
+	}
+	metadata := map[string]interface{}{
+		"name": p.instanceName() + "-checksum",
+		"annotations": map[string]interface{}{
+			renderChecksumAnnotation: fmt.Sprintf("sha256:%x", sha256.Sum256(b)),
+		},
+	}
+	if p.Namespace != "" {
+		metadata["namespace"] = p.Namespace
+	}
+	return rm.Append(p.h.ResmapFactory().RF().FromMap(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   metadata,
+	}))
+}
+
+// stampConfigChecksums annotates the pod template of every workload
+// with the checksum of the ConfigMaps and Secrets it references.
+// References to config that isn't inflated are left out.
+func stampConfigChecksums(rm resmap.ResMap) error {
+	configs := map[string]*resource.Resource{}
+	for _, r := range rm.Resources() {
+		if r.GetKind() == "ConfigMap" || r.GetKind() == "Secret" {
+			configs[r.GetKind()+"/"+r.GetNamespace()+"/"+r.GetName()] = r
+		}
+	}
+	for _, r := range rm.Resources() {
+		path := podSpecPath(r.GetKind())
+		if path == nil {
+			continue
+		}
+		spec, err := r.Pipe(kyaml.Lookup(path...))
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			continue
+		}
+		refs, err := configReferences(spec)
+		if err != nil {
+			return err
+		}
+		referenced := map[string]*resource.Resource{}
+		for _, ref := range refs {
+			key := ref.kind + "/" + r.GetNamespace() + "/" + ref.name
+			if config, found := configs[key]; found && !ref.optional {
+				referenced[key] = config
+			}
+		}
+		if len(referenced) == 0 {
+			continue
+		}
+		sum := sha256.New()
+		for _, key := range sortedKeys(referenced) {
+			b, err := referenced[key].AsYAML()
+			if err != nil {
+				return err
+			}
+			sum.Write(b)
+		}
+		template, err := r.Pipe(kyaml.Lookup(path[:len(path)-1]...))
+		if err != nil {
+			return err
+		}
+		if err = template.PipeE(kyaml.SetAnnotation(
+			configChecksumAnnotation, fmt.Sprintf("%x", sum.Sum(nil)))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMeshInjectionAnnotations sets the MeshInjectionAnnotations that
+// the pod template of a workload lacks.
+func (p *plugin) setMeshInjectionAnnotations(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		path := podSpecPath(r.GetKind())
+		if path == nil {
+			continue
+		}
+		template, err := r.Pipe(kyaml.Lookup(path[:len(path)-1]...))
+		if err != nil {
+			return err
+		}
+		if template == nil {
+			continue
+		}
+		annotations := template.GetAnnotations()
+		for _, k := range sortedKeys(p.MeshInjectionAnnotations) {
+			if _, found := annotations[k]; found {
+				continue
+			}
+			if err = template.PipeE(kyaml.SetAnnotation(
+				k, p.MeshInjectionAnnotations[k])); err != nil {
+				return errors.WrapPrefixf(err, "%s", describe(r))
+			}
+		}
+	}
+	return nil
+}
+
+// instanceName returns the release name, or the chart name if the
+// release name is generated by helm.
+func (p *plugin) instanceName() string {
+	if p.ReleaseName != "" {
+		return p.ReleaseName
+	}
+	return p.Name
+}
+
+// isTestHook returns true if the resource is a helm test hook.
+func isTestHook(r *resource.Resource) bool {
+	for _, hook := range strings.Split(r.GetAnnotations()[helmHookAnnotation], ",") {
+		switch strings.TrimSpace(hook) {
+		case "test", "test-success", "test-failure":
+			return true
+		}
+	}
+	return false
+}
+
+// setDefaultScheduling merges DefaultNodeSelector and
+// DefaultTolerations into the scheduling constraints of workload pods.
+func (p *plugin) setDefaultScheduling(rm resmap.ResMap) error {
+	nodeSelector := map[string]interface{}{}
+	for k, v := range p.DefaultNodeSelector {
+		nodeSelector[k] = v
+	}
+	nodeSelectorDefaults, err := kyaml.FromMap(nodeSelector)
+	if err != nil {
+		return err
+	}
+	var tolerations []*kyaml.RNode
+	for _, t := range p.DefaultTolerations {
+		toleration, err := kyaml.FromMap(t)
+		if err != nil {
+			return err
+		}
+		tolerations = append(tolerations, toleration)
+	}
+	return forEachPodSpec(rm, func(spec *kyaml.RNode) error {
+		if err := setDefaults(spec, "nodeSelector", nodeSelectorDefaults); err != nil {
+			return err
+		}
+		return addTolerations(spec, tolerations)
+	})
+}
+
+// setDefaultTopologySpread sets DefaultTopologySpread as the
+// topologySpreadConstraints of workload pods that have none.
+func (p *plugin) setDefaultTopologySpread(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		spec, err := podSpec(r)
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			continue
+		}
+		if f := spec.Field("topologySpreadConstraints"); f != nil &&
+			len(f.Value.YNode().Content) > 0 {
+			continue
+		}
+		labels, err := podLabels(r)
+		if err != nil {
+			return err
+		}
+		matchLabels := map[string]interface{}{}
+		for k, v := range labels {
+			matchLabels[k] = v
+		}
+		var constraints []*kyaml.RNode
+		for _, c := range p.DefaultTopologySpread {
+			constraint, err := kyaml.FromMap(c)
+			if err != nil {
+				return err
+			}
+			if _, found := c["labelSelector"]; !found && len(matchLabels) > 0 {
+				selector, err := kyaml.FromMap(
+					map[string]interface{}{"matchLabels": matchLabels})
+				if err != nil {
+					return err
+				}
+				if err = constraint.PipeE(kyaml.SetField("labelSelector", selector)); err != nil {
+					return err
+				}
+			}
+			constraints = append(constraints, constraint)
+		}
+		list := kyaml.NewRNode(&kyaml.Node{Kind: kyaml.SequenceNode, Content: nodes(constraints)})
+		if err = spec.PipeE(kyaml.SetField("topologySpreadConstraints", list)); err != nil {
+			return errors.WrapPrefixf(err, "%s", describe(r))
+		}
+	}
+	return nil
+}
+
+// addTolerations appends the tolerations to the pod spec,
+// skipping those whose taint is already tolerated.
+func addTolerations(spec *kyaml.RNode, tolerations []*kyaml.RNode) error {
+	if len(tolerations) == 0 {
+		return nil
+	}
+	tolerated := map[string]bool{}
+	err := visitElements(spec, "tolerations", func(t *kyaml.RNode) error {
+		tolerated[taint(t)] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var missing []*kyaml.RNode
+	for _, t := range tolerations {
+		if !tolerated[taint(t)] {
+			missing = append(missing, t.Copy())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if f := spec.Field("tolerations"); f != nil && kyaml.IsMissingOrNull(f.Value) {
+		if err = spec.PipeE(kyaml.Clear("tolerations")); err != nil {
+			return err
+		}
+	}
+	list, err := spec.Pipe(kyaml.LookupCreate(kyaml.SequenceNode, "tolerations"))
+	if err != nil {
+		return err
+	}
+	return list.PipeE(kyaml.Append(nodes(missing)...))
+}
+
+// taint identifies the taint tolerated by a toleration.
+func taint(toleration *kyaml.RNode) string {
+	key, _ := toleration.GetString("key")
+	effect, _ := toleration.GetString("effect")
+	return key + ":" + effect
+}
+
+func nodes(rnodes []*kyaml.RNode) []*kyaml.Node {
+	result := make([]*kyaml.Node, 0, len(rnodes))
+	for _, rn := range rnodes {
+		result = append(result, rn.YNode())
+	}
+	return result
+}
+
+// canonicalizeImages rewrites the images of workload
+// containers to their canonical form.
+func canonicalizeImages(rm resmap.ResMap) error {
+	return forEachPodSpec(rm, func(spec *kyaml.RNode) error {
+		cs, err := podContainers(spec)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			image, err := c.GetString("image")
+			if err != nil || image == "" {
+				continue
+			}
+			if err = c.PipeE(kyaml.SetField(
+				"image", kyaml.NewStringRNode(canonicalImage(image)))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// canonicalImage returns the fully qualified form of an image
+// reference, naming the registry and a tag or digest.
+func canonicalImage(image string) string {
+	name, digest, hasDigest := strings.Cut(image, "@")
+	registry, path, hasRegistry := strings.Cut(name, "/")
+	if !hasRegistry || (!strings.ContainsAny(registry, ".:") && registry != "localhost") {
+		registry, path = "docker.io", name
+	}
+	if registry == "index.docker.io" {
+		registry = "docker.io"
+	}
+	if registry == "docker.io" && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	if hasDigest {
+		return registry + "/" + path + "@" + digest
+	}
+	if !strings.Contains(path[strings.LastIndex(path, "/")+1:], ":") {
+		path += ":latest"
+	}
+	return registry + "/" + path
+}
+
+// markLocalConfig annotates the resources selected by
+// LocalConfigResources as local configuration.
+func (p *plugin) markLocalConfig(rm resmap.ResMap) error {
+	for _, selector := range p.LocalConfigResources {
+		resources, err := rm.Select(selector)
+		if err != nil {
+			return err
+		}
+		for _, r := range resources {
+			annotations := r.GetAnnotations()
+			annotations[konfig.IgnoredByKustomizeAnnotation] = "true"
+			if err = r.SetAnnotations(annotations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setPriorityClassName sets priorityClassName on workloads lacking one.
+func (p *plugin) setPriorityClassName(rm resmap.ResMap) error {
+	return forEachPodSpec(rm, func(spec *kyaml.RNode) error {
+		return setFieldIfAbsent(spec, "priorityClassName",
+			kyaml.NewStringRNode(p.PriorityClassName))
+	})
+}
+
+// hardenServiceAccounts disables the automounting of service account
+// tokens in ServiceAccounts and workload pods that don't set it.
+func hardenServiceAccounts(rm resmap.ResMap) error {
+	disabled := func() *kyaml.RNode {
+		return kyaml.NewRNode(&kyaml.Node{
+			Kind: kyaml.ScalarNode, Tag: kyaml.NodeTagBool, Value: "false"})
+	}
+	for _, r := range rm.Resources() {
+		if r.GetKind() != "ServiceAccount" {
+			continue
+		}
+		if err := setFieldIfAbsent(
+			&r.RNode, "automountServiceAccountToken", disabled()); err != nil {
+			return errors.WrapPrefixf(err, "%s", describe(r))
+		}
+	}
+	return forEachPodSpec(rm, func(spec *kyaml.RNode) error {
+		return setFieldIfAbsent(spec, "automountServiceAccountToken", disabled())
+	})
+}
+
+// setCommonEnv adds the CommonEnv variables that a workload container
+// doesn't define to its env.
+func (p *plugin) setCommonEnv(rm resmap.ResMap) error {
+	return forEachPodSpec(rm, func(spec *kyaml.RNode) error {
+		cs, err := podContainers(spec)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			env, err := c.Pipe(kyaml.LookupCreate(kyaml.SequenceNode, "env"))
+			if err != nil {
+				return err
+			}
+			for _, name := range sortedKeys(p.CommonEnv) {
+				existing, err := env.Pipe(kyaml.MatchElement("name", name))
+				if err != nil {
+					return err
+				}
+				if existing != nil {
+					continue
+				}
+				v, err := kyaml.FromMap(map[string]interface{}{
+					"name": name, "value": p.CommonEnv[name]})
+				if err != nil {
+					return err
+				}
+				if err = env.PipeE(kyaml.Append(v.YNode())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// setDefaultSecurityContext merges DefaultSecurityContext into the
+// security contexts of workload pods and containers.
+func (p *plugin) setDefaultSecurityContext(rm resmap.ResMap) error {
+	podDefaults, err := kyaml.FromMap(p.DefaultSecurityContext.Pod)
+	if err != nil {
+		return err
+	}
+	containerDefaults, err := kyaml.FromMap(p.DefaultSecurityContext.Container)
+	if err != nil {
+		return err
+	}
+	return forEachPodSpec(rm, func(spec *kyaml.RNode) error {
+		if err := setDefaults(spec, "securityContext", podDefaults); err != nil {
+			return err
+		}
+		cs, err := podContainers(spec)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			if err := setDefaults(c, "securityContext", containerDefaults); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// setDefaultResources merges DefaultResources into the resource
+// requirements of every workload container.
+func (p *plugin) setDefaultResources(rm resmap.ResMap) error {
+	m := map[string]interface{}{}
+	if len(p.DefaultResources.Requests) > 0 {
+		m["requests"] = p.DefaultResources.Requests
+	}
+	if len(p.DefaultResources.Limits) > 0 {
+		m["limits"] = p.DefaultResources.Limits
+	}
+	defaults, err := kyaml.FromMap(m)
+	if err != nil {
+		return err
+	}
+	return forEachPodSpec(rm, func(spec *kyaml.RNode) error {
+		cs, err := podContainers(spec)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			if err := setDefaults(c, "resources", defaults); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// annotatePhases sets the phaseAnnotation of every resource,
+// separating the CustomResourceDefinitions from the rest.
+func annotatePhases(rm resmap.ResMap) error {
+	for _, r := range rm.Resources() {
+		phase := phaseResources
+		if r.GetKind() == "CustomResourceDefinition" {
+			phase = phaseCRD
+		}
+		annotations := r.GetAnnotations()
+		annotations[phaseAnnotation] = phase
+		if err := r.SetAnnotations(annotations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderByHookWeight sets the hookOrderAnnotation of every resource
+// with a helm hook weight to the weight, offset and zero-padded so
+// that the annotations sort as the weights do, and, if HookWeightOrder
+// is 'sort', stably reorders the resources by weight, taking a missing
+// weight to be 0, as helm does.
+func (p *plugin) orderByHookWeight(rm resmap.ResMap) error {
+	resources := rm.Resources()
+	weights := map[*resource.Resource]int64{}
+	for _, r := range resources {
+		annotations := r.GetAnnotations()
+		value, found := annotations[helmHookWeightAnnotation]
+		if !found {
+			continue
+		}
+		weight, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s' of %s",
+				helmHookWeightAnnotation, value, describe(r))
+		}
+		weights[r] = weight
+		annotations[hookOrderAnnotation] = fmt.Sprintf("%010d", weight-math.MinInt32)
+		if err = r.SetAnnotations(annotations); err != nil {
+			return err
+		}
+	}
+	if p.HookWeightOrder != hookWeightOrderSort {
+		return nil
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return weights[resources[i]] < weights[resources[j]]
+	})
+	rm.Clear()
+	for _, r := range resources {
+		if err := rm.Append(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removedAPI is a kubernetes API version no longer served
+// as of a kubernetes minor version.
+type removedAPI struct {
+	removedIn   int
+	replacement string
+}
+
+// removedAPIs maps 'apiVersion/kind' to the kubernetes 1.x minor
+// version in which the API version was removed.
+var removedAPIs = map[string]removedAPI{ //nolint:gochecknoglobals
+	"extensions/v1beta1/DaemonSet":                                        {16, "apps/v1"},
+	"extensions/v1beta1/Deployment":                                       {16, "apps/v1"},
+	"extensions/v1beta1/NetworkPolicy":                                    {16, "networking.k8s.io/v1"},
+	"extensions/v1beta1/PodSecurityPolicy":                                {16, "policy/v1beta1"},
+	"extensions/v1beta1/ReplicaSet":                                       {16, "apps/v1"},
+	"apps/v1beta1/Deployment":                                             {16, "apps/v1"},
+	"apps/v1beta1/StatefulSet":                                            {16, "apps/v1"},
+	"apps/v1beta2/DaemonSet":                                              {16, "apps/v1"},
+	"apps/v1beta2/Deployment":                                             {16, "apps/v1"},
+	"apps/v1beta2/ReplicaSet":                                             {16, "apps/v1"},
+	"apps/v1beta2/StatefulSet":                                            {16, "apps/v1"},
+	"extensions/v1beta1/Ingress":                                          {22, "networking.k8s.io/v1"},
+	"networking.k8s.io/v1beta1/Ingress":                                   {22, "networking.k8s.io/v1"},
+	"networking.k8s.io/v1beta1/IngressClass":                              {22, "networking.k8s.io/v1"},
+	"apiextensions.k8s.io/v1beta1/CustomResourceDefinition":               {22, "apiextensions.k8s.io/v1"},
+	"admissionregistration.k8s.io/v1beta1/MutatingWebhookConfiguration":   {22, "admissionregistration.k8s.io/v1"},
+	"admissionregistration.k8s.io/v1beta1/ValidatingWebhookConfiguration": {22, "admissionregistration.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/ClusterRole":                       {22, "rbac.authorization.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/ClusterRoleBinding":                {22, "rbac.authorization.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/Role":                              {22, "rbac.authorization.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/RoleBinding":                       {22, "rbac.authorization.k8s.io/v1"},
+	"scheduling.k8s.io/v1beta1/PriorityClass":                             {22, "scheduling.k8s.io/v1"},
+	"storage.k8s.io/v1beta1/CSIDriver":                                    {22, "storage.k8s.io/v1"},
+	"storage.k8s.io/v1beta1/StorageClass":                                 {22, "storage.k8s.io/v1"},
+	"batch/v1beta1/CronJob":                                               {25, "batch/v1"},
+	"discovery.k8s.io/v1beta1/EndpointSlice":                              {25, "discovery.k8s.io/v1"},
+	"policy/v1beta1/PodDisruptionBudget":                                  {25, "policy/v1"},
+	"policy/v1beta1/PodSecurityPolicy":                                    {25, ""},
+	"autoscaling/v2beta1/HorizontalPodAutoscaler":                         {25, "autoscaling/v2"},
+	"autoscaling/v2beta2/HorizontalPodAutoscaler":                         {26, "autoscaling/v2"},
+}
+
+// parseKubeVersion returns the major and minor version of a
+// kubernetes version such as 'v1.25.3' or '1.25'.
+func parseKubeVersion(v string) (major int, minor int, err error) {
+	m := kubeVersionRegexp.FindStringSubmatch(v)
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid kubeVersion '%s'", v)
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor, nil
+}
+
+var kubeVersionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)`) //nolint:gochecknoglobals
+
+// annotateDeprecatedAPIs marks resources using a removed API version.
+func (p *plugin) annotateDeprecatedAPIs(rm resmap.ResMap) error {
+	major, minor := 1, -1
+	if p.KubeVersion != "" {
+		var err error
+		if major, minor, err = parseKubeVersion(p.KubeVersion); err != nil {
+			return err
+		}
+	}
+	for _, r := range rm.Resources() {
+		api, found := removedAPIs[r.GetApiVersion()+"/"+r.GetKind()]
+		if !found || (major == 1 && minor >= 0 && minor < api.removedIn) {
+			continue
+		}
+		msg := fmt.Sprintf("%s %s is removed in kubernetes v1.%d",
+			r.GetApiVersion(), r.GetKind(), api.removedIn)
+		if api.replacement != "" {
+			msg += ", use " + api.replacement
+		}
+		annotations := r.GetAnnotations()
+		annotations[deprecatedAPIAnnotation] = msg
+		if err := r.SetAnnotations(annotations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// podSpecPath returns the path to the pod spec embedded in
+// resources of the given kind, or nil if there is none.
+func podSpecPath(kind string) []string {
+	switch kind {
+	case "Pod":
+		return []string{"spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet",
+		"ReplicationController", "Job":
+		return []string{"spec", "template", "spec"}
+	}
+	return nil
+}
+
+// podSpec returns the pod spec of a workload, or nil if the
+// resource is not a workload.
+func podSpec(r *resource.Resource) (*kyaml.RNode, error) {
+	path := podSpecPath(r.GetKind())
+	if path == nil {
+		return nil, nil
+	}
+	return r.Pipe(kyaml.Lookup(path...))
+}
+
+// forEachPodSpec calls fn with the pod spec of every workload.
+func forEachPodSpec(rm resmap.ResMap, fn func(spec *kyaml.RNode) error) error {
+	for _, r := range rm.Resources() {
+		spec, err := podSpec(r)
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			continue
+		}
+		if err = fn(spec); err != nil {
+			return errors.WrapPrefixf(err, "%s", describe(r))
+		}
+	}
+	return nil
+}
+
+// setFieldIfAbsent sets a field on a map node unless it's already set.
+func setFieldIfAbsent(node *kyaml.RNode, field string, value *kyaml.RNode) error {
+	if node.Field(field) != nil {
+		return nil
+	}
+	return node.PipeE(kyaml.SetField(field, value))
+}
+
+// setDefaults merges defaults into the given map field of node.
+func setDefaults(node *kyaml.RNode, field string, defaults *kyaml.RNode) error {
+	if len(defaults.Content()) == 0 {
+		return nil
+	}
+	if f := node.Field(field); f != nil && kyaml.IsMissingOrNull(f.Value) {
+		if err := node.PipeE(kyaml.Clear(field)); err != nil {
+			return err
+		}
+	}
+	target, err := node.Pipe(kyaml.LookupCreate(kyaml.MappingNode, field))
+	if err != nil {
+		return err
+	}
+	return mergeDefaults(target, defaults)
+}
+
+// mergeDefaults sets the fields of defaults on node, recursing into
+// maps, without overwriting any field that is already set.
+func mergeDefaults(node, defaults *kyaml.RNode) error {
+	return defaults.VisitFields(func(f *kyaml.MapNode) error {
+		name := f.Key.YNode().Value
+		existing := node.Field(name)
+		if existing == nil || kyaml.IsMissingOrNull(existing.Value) {
+			return node.PipeE(kyaml.SetField(name, f.Value.Copy()))
+		}
+		if existing.Value.YNode().Kind == kyaml.MappingNode &&
+			f.Value.YNode().Kind == kyaml.MappingNode {
+			return mergeDefaults(existing.Value, f.Value)
+		}
+		return nil
+	})
+}
+
+// containers returns the init containers and containers of a workload.
+func containers(r *resource.Resource) ([]*kyaml.RNode, error) {
+	spec, err := podSpec(r)
+	if err != nil || spec == nil {
+		return nil, err
+	}
+	return podContainers(spec)
+}
+
+// podContainers returns the init containers and containers of a pod spec.
+func podContainers(spec *kyaml.RNode) ([]*kyaml.RNode, error) {
+	var result []*kyaml.RNode
+	for _, field := range []string{"initContainers", "containers"} {
+		list, err := spec.Pipe(kyaml.Lookup(field))
+		if err != nil {
+			return nil, err
+		}
+		if list == nil {
+			continue
+		}
+		elements, err := list.Elements()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, elements...)
+	}
+	return result, nil
+}
@@ -0,0 +1,1593 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	kusttest_test "sigs.k8s.io/kustomize/api/testutils/kusttest"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestHelmChartInflationGeneratorPostProcessing(t *testing.T) {
+	workloadsConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: workloads
+name: workloads
+releaseName: test
+chartHome: ./charts
+`
+	pulledAppConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: https://example.com/charts
+namespace: apps
+`
+	deprecatedAPIsHelm := fakeHelmRendering(`
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`) + fakeHelmPullChart
+	deprecatedAPIsConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: web
+name: web
+repo: https://example.com/charts
+warnDeprecatedAPIs: true
+`
+	stripServerFieldsHelm := fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  creationTimestamp: null
+  annotations: {}
+spec:
+  template:
+    metadata:
+      creationTimestamp: null
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+status: {}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  annotations:
+    keep: me
+  resourceVersion: "42"
+  uid: 0b4a3c6e-3f3e-4b8e-9d5e-0f3c1a2b3c4d
+`)
+	instanceLabelHelm := fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: labeled
+  labels:
+    app.kubernetes.io/instance: RELEASE-NAME
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: unlabeled
+`)
+	// The release 'denying' renders a default deny policy of its own,
+	// and the release 'unqualified' one without a namespace.
+	denyPolicyHelm := `if [ "$1" = "template" ]; then
+  cat <<YAML
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-web
+  namespace: apps
+spec:
+  podSelector:
+    matchLabels:
+      app: web
+  ingress:
+  - {}
+YAML
+  if [ "$2" = "denying" ]; then
+    cat <<YAML
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny-all
+  namespace: apps
+spec:
+  podSelector: {}
+YAML
+  fi
+  if [ "$2" = "unqualified" ]; then
+    cat <<YAML
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny-all
+spec:
+  podSelector: {}
+YAML
+  fi
+  exit 0
+fi
+` + fakeHelmPreamble
+	denyPolicyConfig := testChartConfig + `
+namespace: apps
+defaultDenyNetworkPolicy: true
+`
+	hooksHelm := fakeHelmRendering(`
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: smoke-test
+  annotations:
+    helm.sh/hook: post-install
+    helm.sh/hook-weight: "5"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install
+    helm.sh/hook-weight: "-10"
+`)
+	stampKubeVersionConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+releaseName: test
+chartHome: ./charts
+stampKubeVersion: true
+`
+	settingsHelm := fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`)
+	resourceTransformsHelm := fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: debug
+`)
+	resourceTransformsConfig := testChartConfig + `
+resourceTransforms:
+  Deployment/web:
+  - patch: |
+      spec:
+        replicas: 3
+  ConfigMap/settings:
+  - path: settings-patch.yaml
+`
+	resourceTransformsFiles := map[string]string{
+		"settings-patch.yaml": `
+- op: replace
+  path: /data/mode
+  value: production
+`,
+	}
+	focusWorkloadHelm := fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      serviceAccountName: web
+      imagePullSecrets:
+      - name: registry
+      containers:
+      - name: web
+        image: nginx:1.25
+        envFrom:
+        - configMapRef:
+            name: web-env
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: web-credentials
+              key: password
+      volumes:
+      - name: extra
+        configMap:
+          name: web-extra
+          optional: true
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    metadata:
+      labels:
+        app: worker
+    spec:
+      serviceAccountName: worker
+      containers:
+      - name: worker
+        image: worker:1.0
+        envFrom:
+        - configMapRef:
+            name: worker-env
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-env
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-extra
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: worker-env
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-credentials
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: registry
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: worker
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: worker
+spec:
+  selector:
+    app: worker
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: empty
+`)
+
+	runGeneratorCases(t, []generatorCase{
+		{
+			name:     "captureChartMetadata",
+			realHelm: true,
+			config: workloadsConfig + `
+namespace: docs
+captureChartMetadata: true
+`,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				cm := findResource(t, rm, "ConfigMap", "test-chart-metadata")
+				assert.Equal(t, "docs", cm.GetNamespace())
+				data := cm.GetDataMap()
+				assert.Contains(t, data["Chart.yaml"], "name: workloads")
+				assert.Equal(t, "# workloads\n\nA chart with static workload templates.\n", data["README.md"])
+			},
+		},
+		{
+			name:     "defaultResources",
+			realHelm: true,
+			config: workloadsConfig + `
+defaultResources:
+  requests:
+    cpu: 100m
+    memory: 64Mi
+  limits:
+    memory: 128Mi
+`,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				deployment := findResource(t, rm, "Deployment", "web")
+				nginx, err := deployment.GetFieldValue("spec.template.spec.containers.0.resources")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]interface{}{
+					"requests": map[string]interface{}{"cpu": "250m", "memory": "64Mi"},
+					"limits":   map[string]interface{}{"memory": "128Mi"},
+				}, nginx)
+				sidecar, err := deployment.GetFieldValue("spec.template.spec.containers.1.resources")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]interface{}{
+					"requests": map[string]interface{}{"cpu": "100m", "memory": "64Mi"},
+					"limits":   map[string]interface{}{"memory": "128Mi"},
+				}, sidecar)
+			},
+		},
+		{
+			name: "createNamespace",
+			helm: fakeHelmPreamble + fakeHelmPullChart,
+			config: pulledAppConfig + `
+releaseName: app
+createNamespace: true
+namespaceLabels:
+  pod-security.kubernetes.io/enforce: restricted
+namespaceAnnotations:
+  owner: team-a
+`,
+			expected: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  annotations:
+    owner: team-a
+  labels:
+    pod-security.kubernetes.io/enforce: restricted
+  name: apps
+`,
+		},
+		{
+			name: "namespaceLabels without createNamespace",
+			helm: fakeHelmPreamble + fakeHelmPullChart,
+			config: pulledAppConfig + `
+namespaceLabels:
+  pod-security.kubernetes.io/enforce: restricted
+`,
+			err: "namespaceLabels and namespaceAnnotations require createNamespace",
+		},
+		{
+			name:   "warnDeprecatedAPIs for a removed API",
+			helm:   deprecatedAPIsHelm,
+			config: deprecatedAPIsConfig + "kubeVersion: v1.22.0\n",
+			expected: `
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  annotations:
+    kustomize.config.k8s.io/deprecated-api: extensions/v1beta1 Ingress is removed
+      in kubernetes v1.22, use networking.k8s.io/v1
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`,
+		},
+		{
+			name:   "warnDeprecatedAPIs for a served API",
+			helm:   deprecatedAPIsHelm,
+			config: deprecatedAPIsConfig + "kubeVersion: \"1.21\"\n",
+			expected: `
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`,
+		},
+		{
+			name:   "warnDeprecatedAPIs with an invalid kubeVersion",
+			helm:   deprecatedAPIsHelm,
+			config: deprecatedAPIsConfig + "kubeVersion: latest\n",
+			err:    "invalid kubeVersion 'latest'",
+		},
+		{
+			name:     "localConfigResources",
+			realHelm: true,
+			config: workloadsConfig + `
+localConfigResources:
+- kind: ConfigMap
+  name: web-config
+`,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				cm := findResource(t, rm, "ConfigMap", "web-config")
+				assert.Equal(t, "true",
+					cm.GetAnnotations()["config.kubernetes.io/local-config"])
+				svc := findResource(t, rm, "Service", "web")
+				assert.NotContains(t, svc.GetAnnotations(), "config.kubernetes.io/local-config")
+			},
+		},
+		{
+			name: "stampChecksum",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				checksum := func(releaseName string) string {
+					t.Helper()
+					rm := th.LoadAndRunGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+releaseName: ` + releaseName + `
+chartHome: ./charts
+stampChecksum: true
+`)
+					require.Equal(t, 2, rm.Size())
+					r := findResource(t, rm, "ConfigMap", releaseName+"-checksum")
+					return r.GetAnnotations()["kustomize.config.k8s.io/render-checksum"]
+				}
+				first := checksum("test")
+				assert.Regexp(t, "^sha256:[0-9a-f]{64}$", first)
+				assert.Equal(t, first, checksum("test"))
+				assert.NotEqual(t, first, checksum("other"))
+			},
+		},
+		{
+			name: "canonicalizeImages",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+spec:
+  initContainers:
+  - name: init
+    image: busybox@sha256:3fbc632167424a6d997e74f52b878d7cc478225cffac6bc977eedfe51c7f4e79
+  containers:
+  - name: nginx
+    image: nginx
+  - name: envoy
+    image: envoyproxy/envoy:v1.28.0
+  - name: app
+    image: quay.io/example/app:1.0
+  - name: local
+    image: localhost:5000/app
+`),
+			config: testChartConfig + "canonicalizeImages: true\n",
+			expected: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+spec:
+  containers:
+  - image: docker.io/library/nginx:latest
+    name: nginx
+  - image: docker.io/envoyproxy/envoy:v1.28.0
+    name: envoy
+  - image: quay.io/example/app:1.0
+    name: app
+  - image: localhost:5000/app:latest
+    name: local
+  initContainers:
+  - image: docker.io/library/busybox@sha256:3fbc632167424a6d997e74f52b878d7cc478225cffac6bc977eedfe51c7f4e79
+    name: init
+`,
+		},
+		{
+			name: "dependencyReport",
+			helm: `if [ "$1 $2" = "dependency list" ]; then
+  [ "$3" = "$root/charts/test-chart" ] || exit 1
+  echo "WARNING: dependency 'redis' is missing"
+  printf 'NAME      \tVERSION\tREPOSITORY                        \tSTATUS \n'
+  printf 'common    \t1.0.0  \thttps://example.com/charts        \tok     \n'
+  printf 'redis     \t~17.0.0\toci://registry.example.com/charts \twrong version\n'
+  echo
+  exit 0
+fi
+` + fakeHelmPreamble,
+			config: testChartConfig + "dependencyReport: true\n",
+			expected: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+---
+apiVersion: v1
+data:
+  dependencies.yaml: |
+    - name: common
+      repository: https://example.com/charts
+      status: ok
+      version: 1.0.0
+    - name: redis
+      repository: oci://registry.example.com/charts
+      status: wrong version
+      version: ~17.0.0
+kind: ConfigMap
+metadata:
+  name: test-dependencies
+`,
+		},
+		{
+			name: "defaultNodeSelector and defaultTolerations",
+			helm: fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: placed
+spec:
+  template:
+    spec:
+      nodeSelector:
+        pool: gpu
+      tolerations:
+      - key: dedicated
+        operator: Equal
+        value: gpu
+        effect: NoSchedule
+      containers:
+      - name: app
+        image: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: unplaced
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app
+`),
+			config: testChartConfig + `
+defaultNodeSelector:
+  pool: general
+  zone: eu-1
+defaultTolerations:
+- key: dedicated
+  operator: Exists
+  effect: NoSchedule
+- key: spot
+  operator: Exists
+  effect: NoExecute
+`,
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: placed
+spec:
+  template:
+    spec:
+      containers:
+      - image: app
+        name: app
+      nodeSelector:
+        pool: gpu
+        zone: eu-1
+      tolerations:
+      - effect: NoSchedule
+        key: dedicated
+        operator: Equal
+        value: gpu
+      - effect: NoExecute
+        key: spot
+        operator: Exists
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: unplaced
+spec:
+  template:
+    spec:
+      containers:
+      - image: app
+        name: app
+      nodeSelector:
+        pool: general
+        zone: eu-1
+      tolerations:
+      - effect: NoSchedule
+        key: dedicated
+        operator: Exists
+      - effect: NoExecute
+        key: spot
+        operator: Exists
+`,
+		},
+		{
+			name:   "no stampTimestamp",
+			config: testChartConfig,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				assert.NotContains(t,
+					rm.Resources()[0].GetAnnotations(), "kustomize.helm/generated-at")
+			},
+		},
+		{
+			name: "stampTimestamp",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				before := time.Now().Truncate(time.Second)
+				rm := th.LoadAndRunGenerator(testChartConfig + "stampTimestamp: true\n")
+				stamp, err := time.Parse(time.RFC3339,
+					rm.Resources()[0].GetAnnotations()["kustomize.helm/generated-at"])
+				require.NoError(t, err)
+				assert.False(t, stamp.Before(before))
+				assert.False(t, stamp.After(time.Now()))
+			},
+		},
+		{
+			name: "releaseService",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: managed
+  labels:
+    app.kubernetes.io/managed-by: Helm
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unmanaged
+`),
+			config: testChartConfig + "releaseService: Kustomize\n",
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				assert.Equal(t, "Kustomize", findResource(t, rm, "ConfigMap", "managed").
+					GetLabels()["app.kubernetes.io/managed-by"])
+				assert.NotContains(t, findResource(t, rm, "ConfigMap", "unmanaged").
+					GetLabels(), "app.kubernetes.io/managed-by")
+			},
+		},
+		{
+			name: "phaseAnnotations",
+			helm: fakeHelmRendering(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+`),
+			config: testChartConfig + "phaseAnnotations: true\n",
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				assert.Equal(t, "crd", findResource(t, rm, "CustomResourceDefinition", "widgets.example.com").
+					GetAnnotations()["phase"])
+				assert.Equal(t, "resources", findResource(t, rm, "Widget", "widget").
+					GetAnnotations()["phase"])
+			},
+		},
+		{
+			name: "dropAnnotations",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kept
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    example.com/pre-sync: "true"
+`),
+			config: testChartConfig + `
+dropAnnotations:
+- example.com/pre-sync
+`,
+			expected: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kept
+`,
+		},
+		{
+			name: "defaultTopologySpread",
+			helm: fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    metadata:
+      labels:
+        app: worker
+    spec:
+      topologySpreadConstraints:
+      - maxSkew: 2
+        topologyKey: kubernetes.io/hostname
+        whenUnsatisfiable: ScheduleAnyway
+      containers:
+      - name: worker
+        image: busybox
+`),
+			config: testChartConfig + `
+defaultTopologySpread:
+- maxSkew: 1
+  topologyKey: topology.kubernetes.io/zone
+  whenUnsatisfiable: DoNotSchedule
+`,
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - image: nginx
+        name: web
+      topologySpreadConstraints:
+      - labelSelector:
+          matchLabels:
+            app: web
+        maxSkew: 1
+        topologyKey: topology.kubernetes.io/zone
+        whenUnsatisfiable: DoNotSchedule
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    metadata:
+      labels:
+        app: worker
+    spec:
+      containers:
+      - image: busybox
+        name: worker
+      topologySpreadConstraints:
+      - maxSkew: 2
+        topologyKey: kubernetes.io/hostname
+        whenUnsatisfiable: ScheduleAnyway
+`,
+		},
+		{
+			name: "fixedNow",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: stamped
+  annotations:
+    rollme: "$(date -u +%Y-%m-%dT%H:%M:%S.%NZ)"
+    renderedAt: "$(date +'%Y-%m-%d %H:%M:%S.%N %z %Z')"
+data:
+  expires: "2030-06-01T12:00:00Z"
+  "2030-06-01T12:00:00Z": release
+  version: "1.2.3"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      annotations:
+        rollme: "$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+`),
+			config: testChartConfig + "fixedNow: \"2000-01-01T00:00:00Z\"\n",
+			expected: `
+apiVersion: v1
+data:
+  "2030-06-01T12:00:00Z": release
+  expires: "2030-06-01T12:00:00Z"
+  version: 1.2.3
+kind: ConfigMap
+metadata:
+  annotations:
+    renderedAt: 2000-01-01 00:00:00 +0000 UTC
+    rollme: "2000-01-01T00:00:00Z"
+  name: stamped
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      annotations:
+        rollme: "2000-01-01T00:00:00Z"
+`,
+		},
+		{
+			name:   "invalid fixedNow",
+			config: testChartConfig + "fixedNow: yesterday\n",
+			err:    "invalid fixedNow",
+		},
+		{
+			name: "hardenServiceAccounts",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: default-sa
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: api-sa
+automountServiceAccountToken: true
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: operator
+spec:
+  template:
+    spec:
+      automountServiceAccountToken: true
+      containers:
+      - name: operator
+        image: operator
+`),
+			config: testChartConfig + "hardenServiceAccounts: true\n",
+			expected: `
+apiVersion: v1
+automountServiceAccountToken: false
+kind: ServiceAccount
+metadata:
+  name: default-sa
+---
+apiVersion: v1
+automountServiceAccountToken: true
+kind: ServiceAccount
+metadata:
+  name: api-sa
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      automountServiceAccountToken: false
+      containers:
+      - image: nginx
+        name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: operator
+spec:
+  template:
+    spec:
+      automountServiceAccountToken: true
+      containers:
+      - image: operator
+        name: operator
+`,
+		},
+		{
+			name:   "stripServerFields by default",
+			helm:   stripServerFieldsHelm,
+			config: testChartConfig,
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - image: nginx
+        name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  annotations:
+    keep: me
+  name: settings
+`,
+		},
+		{
+			name:   "stripServerFields false",
+			helm:   stripServerFieldsHelm,
+			config: testChartConfig + "stripServerFields: false\n",
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations: {}
+  creationTimestamp: null
+  name: web
+spec:
+  template:
+    metadata:
+      creationTimestamp: null
+      labels:
+        app: web
+    spec:
+      containers:
+      - image: nginx
+        name: web
+status: {}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  annotations:
+    keep: me
+  name: settings
+  resourceVersion: "42"
+  uid: 0b4a3c6e-3f3e-4b8e-9d5e-0f3c1a2b3c4d
+`,
+		},
+		{
+			name: "enforceInstanceLabel",
+			helm: instanceLabelHelm,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+releaseName: prod
+chartHome: ./charts
+enforceInstanceLabel: true
+`,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				for _, r := range rm.Resources() {
+					assert.Equal(t, "prod", r.GetLabels()["app.kubernetes.io/instance"], r.GetName())
+				}
+			},
+		},
+		{
+			name: "enforceInstanceLabel without releaseName",
+			helm: instanceLabelHelm,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+chartHome: ./charts
+enforceInstanceLabel: true
+`,
+			err: "enforceInstanceLabel requires releaseName",
+		},
+		{
+			name:   "defaultDenyNetworkPolicy",
+			helm:   denyPolicyHelm,
+			config: strings.Replace(denyPolicyConfig, "releaseName: test", "releaseName: open", 1),
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				policy := findResource(t, rm, "NetworkPolicy", "open-default-deny")
+				assert.Equal(t, "apps", policy.GetNamespace())
+				yml, err := policy.AsYAML()
+				require.NoError(t, err)
+				assert.Contains(t, string(yml), `spec:
+  podSelector: {}
+  policyTypes:
+  - Ingress
+  - Egress
+`)
+			},
+		},
+		{
+			name:   "defaultDenyNetworkPolicy with a deny policy",
+			helm:   denyPolicyHelm,
+			config: strings.Replace(denyPolicyConfig, "releaseName: test", "releaseName: denying", 1),
+			check:  generates(2),
+		},
+		{
+			// A policy without a namespace is in the release namespace.
+			name:   "defaultDenyNetworkPolicy with an unqualified deny policy",
+			helm:   denyPolicyHelm,
+			config: strings.Replace(denyPolicyConfig, "releaseName: test", "releaseName: unqualified", 1),
+			check:  generates(2),
+		},
+		{
+			name: "configChecksums",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+data:
+  conf: $(cat "$root/api.conf")
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: worker
+data:
+  conf: v1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  template:
+    spec:
+      containers:
+      - name: api
+        image: api
+        envFrom:
+        - configMapRef:
+            name: api
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    spec:
+      containers:
+      - name: worker
+        image: worker
+      volumes:
+      - name: conf
+        configMap:
+          name: worker
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: static
+spec:
+  template:
+    spec:
+      containers:
+      - name: static
+        image: static
+`),
+			files: map[string]string{"api.conf": "v1"},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				checksums := func() map[string]string {
+					rm := th.LoadAndRunGenerator(testChartConfig + "configChecksums: true\n")
+					result := map[string]string{}
+					for _, name := range []string{"api", "worker", "static"} {
+						r := findResource(t, rm, "Deployment", name)
+						v, err := r.GetFieldValue(
+							"spec.template.metadata.annotations.checksum/config")
+						if err == nil {
+							result[name] = v.(string)
+						}
+					}
+					return result
+				}
+				before := checksums()
+				require.Len(t, before, 2)
+				assert.NotEqual(t, before["api"], before["worker"])
+
+				th.WriteF(filepath.Join(th.GetRoot(), "api.conf"), "v2")
+				after := checksums()
+				assert.NotEqual(t, before["api"], after["api"])
+				assert.Equal(t, before["worker"], after["worker"])
+			},
+		},
+		{
+			name: "resource filter",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: debug-settings
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: debug
+`),
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				g := th.LoadGenerator(testChartConfig)
+				s, ok := g.(interface {
+					SetResourceFilter(func(*resource.Resource) bool)
+				})
+				require.True(t, ok)
+				s.SetResourceFilter(func(r *resource.Resource) bool {
+					return r.GetKind() != "ConfigMap" || !strings.HasPrefix(r.GetName(), "debug-")
+				})
+				rm, err := g.Generate()
+				require.NoError(t, err)
+				var names []string
+				for _, r := range rm.Resources() {
+					names = append(names, r.GetKind()+" "+r.GetName())
+				}
+				assert.Equal(t, []string{"ConfigMap settings", "Service debug"}, names)
+			},
+		},
+		{
+			name:   "hookWeightOrder annotate",
+			helm:   hooksHelm,
+			config: testChartConfig + "hookWeightOrder: annotate\n",
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				var orders []string
+				for _, r := range rm.Resources() {
+					orders = append(orders, r.GetName()+"="+r.GetAnnotations()["kustomize.helm/hook-order"])
+				}
+				assert.Equal(t, []string{
+					"smoke-test=2147483653",
+					"settings=",
+					"migrate=2147483638",
+				}, orders)
+			},
+		},
+		{
+			name:   "hookWeightOrder sort",
+			helm:   hooksHelm,
+			config: testChartConfig + "hookWeightOrder: sort\n",
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				var names []string
+				for _, r := range rm.Resources() {
+					names = append(names, r.GetName())
+				}
+				assert.Equal(t, []string{"migrate", "settings", "smoke-test"}, names)
+			},
+		},
+		{
+			name:   "hookWeightOrder unknown",
+			helm:   hooksHelm,
+			config: testChartConfig + "hookWeightOrder: weight\n",
+			err:    "hookWeightOrder must be one of [annotate sort]",
+		},
+		{
+			name: "stampKubeVersion",
+			helm: settingsHelm,
+			files: map[string]string{
+				"charts/app/values.yaml": "",
+				"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 1.0.0
+kubeVersion: ">= 1.25.0-0"
+`,
+			},
+			config: stampKubeVersionConfig,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				require.Equal(t, 1, rm.Size())
+				assert.Equal(t, ">= 1.25.0-0",
+					rm.Resources()[0].GetAnnotations()["kustomize.helm/kube-version"])
+			},
+		},
+		{
+			name: "stampKubeVersion without a kubeVersion",
+			helm: settingsHelm,
+			files: map[string]string{
+				"charts/app/values.yaml": "",
+				"charts/app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+			},
+			config: stampKubeVersionConfig,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				require.Equal(t, 1, rm.Size())
+				assert.NotContains(t, rm.Resources()[0].GetAnnotations(), "kustomize.helm/kube-version")
+			},
+		},
+		{
+			name: "meshInjectionAnnotations",
+			helm: fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    metadata:
+      annotations:
+        sidecar.istio.io/inject: "false"
+    spec:
+      containers:
+      - name: migrate
+        image: migrate:1.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`),
+			config: testChartConfig + `
+meshInjectionAnnotations:
+  sidecar.istio.io/inject: "true"
+`,
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      annotations:
+        sidecar.istio.io/inject: "true"
+    spec:
+      containers:
+      - image: nginx:1.25
+        name: web
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    metadata:
+      annotations:
+        sidecar.istio.io/inject: "false"
+    spec:
+      containers:
+      - image: migrate:1.0
+        name: migrate
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`,
+		},
+		{
+			name:   "resourceTransforms",
+			helm:   resourceTransformsHelm,
+			files:  resourceTransformsFiles,
+			config: resourceTransformsConfig,
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 1
+---
+apiVersion: v1
+data:
+  mode: production
+kind: ConfigMap
+metadata:
+  name: settings
+`,
+		},
+		{
+			name:  "resourceTransforms without a matching resource",
+			helm:  resourceTransformsHelm,
+			files: resourceTransformsFiles,
+			config: resourceTransformsConfig + `  Service/web:
+  - patch: '{"spec": {"type": "NodePort"}}'
+`,
+			err: "no resource matches resourceTransforms key 'Service/web'",
+		},
+		{
+			name: "sortMetadataKeys",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  labels:
+    tier: backend
+    app: web
+    component: cache
+  annotations:
+    owner: team-a
+    checksum/config: abc
+`),
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				// Serialization sorts map keys, so look at the node order itself.
+				keys := func(r *resource.Resource, field string) []string {
+					m, err := r.Pipe(kyaml.Lookup("metadata", field))
+					require.NoError(t, err)
+					var got []string
+					for i := 0; i < len(m.YNode().Content); i += 2 {
+						got = append(got, m.YNode().Content[i].Value)
+					}
+					return got
+				}
+				for i := 0; i < 3; i++ {
+					r := th.LoadAndRunGenerator(testChartConfig + `
+sortMetadataKeys: true
+commonAnnotations:
+  a.example.com/team: web
+`).Resources()[0]
+					assert.Equal(t, []string{"app", "component", "tier"}, keys(r, "labels"))
+					assert.Equal(t, []string{"a.example.com/team", "checksum/config", "owner"},
+						keys(r, "annotations"))
+				}
+			},
+		},
+		{
+			name: "commonEnv",
+			helm: fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox:1.36
+      containers:
+      - name: web
+        image: nginx:1.25
+        env:
+        - name: TZ
+          value: Europe/Berlin
+      - name: proxy
+        image: envoy:1.28
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  TZ: UTC
+`),
+			config: testChartConfig + `
+commonEnv:
+  TZ: UTC
+  LANG: C.UTF-8
+`,
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: TZ
+          value: Europe/Berlin
+        - name: LANG
+          value: C.UTF-8
+        image: nginx:1.25
+        name: web
+      - env:
+        - name: LANG
+          value: C.UTF-8
+        - name: TZ
+          value: UTC
+        image: envoy:1.28
+        name: proxy
+      initContainers:
+      - env:
+        - name: LANG
+          value: C.UTF-8
+        - name: TZ
+          value: UTC
+        image: busybox:1.36
+        name: init
+---
+apiVersion: v1
+data:
+  TZ: UTC
+kind: ConfigMap
+metadata:
+  name: settings
+`,
+		},
+		{
+			name:   "focusWorkload",
+			helm:   focusWorkloadHelm,
+			config: testChartConfig + "focusWorkload: Deployment/web\n",
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				var got []string
+				for _, r := range rm.Resources() {
+					got = append(got, r.GetKind()+"/"+r.GetName())
+				}
+				assert.Equal(t, []string{
+					"Deployment/web",
+					"ConfigMap/web-env",
+					"ConfigMap/web-extra",
+					"Secret/web-credentials",
+					"Secret/registry",
+					"ServiceAccount/web",
+					"Service/web",
+				}, got)
+			},
+		},
+		{
+			name:   "focusWorkload without a matching resource",
+			helm:   focusWorkloadHelm,
+			config: testChartConfig + "focusWorkload: Deployment/api\n",
+			err:    "no resource matches focusWorkload 'Deployment/api'",
+		},
+		{
+			name:   "focusWorkload on other than a workload",
+			helm:   focusWorkloadHelm,
+			config: testChartConfig + "focusWorkload: ConfigMap/web-env\n",
+			err:    "focusWorkload 'ConfigMap/web-env' is not of the form 'Kind/name' of a workload",
+		},
+		{
+			name:   "focusWorkload without a pod spec",
+			helm:   focusWorkloadHelm,
+			config: testChartConfig + "focusWorkload: Deployment/empty\n",
+			err:    "focusWorkload 'Deployment/empty' has no pod spec",
+		},
+		{
+			name:     "priorityClassName",
+			realHelm: true,
+			config:   workloadsConfig + "priorityClassName: critical\n",
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				deployment, err := findResource(t, rm, "Deployment", "web").
+					GetFieldValue("spec.template.spec.priorityClassName")
+				require.NoError(t, err)
+				assert.Equal(t, "critical", deployment)
+
+				// The chart's own setting is preserved.
+				cronJob, err := findResource(t, rm, "CronJob", "cleanup").
+					GetFieldValue("spec.jobTemplate.spec.template.spec.priorityClassName")
+				require.NoError(t, err)
+				assert.Equal(t, "batch-low", cronJob)
+
+				_, err = findResource(t, rm, "Service", "web").GetFieldValue("spec.priorityClassName")
+				assert.Error(t, err)
+			},
+		},
+		{
+			name:     "defaultSecurityContext",
+			realHelm: true,
+			config: workloadsConfig + `
+defaultSecurityContext:
+  pod:
+    runAsNonRoot: true
+    runAsUser: 65534
+  container:
+    readOnlyRootFilesystem: true
+    allowPrivilegeEscalation: false
+`,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				deployment, err := findResource(t, rm, "Deployment", "web").AsYAML()
+				require.NoError(t, err)
+				assert.Contains(t, string(deployment), `
+      containers:
+      - envFrom:
+        - configMapRef:
+            name: web-config
+        image: nginx:1.25
+        name: nginx
+        resources:
+          requests:
+            cpu: 250m
+        securityContext:
+          allowPrivilegeEscalation: false
+          readOnlyRootFilesystem: true
+      - image: busybox:1.36
+        name: sidecar
+        securityContext:
+          allowPrivilegeEscalation: false
+          readOnlyRootFilesystem: false
+      securityContext:
+        runAsNonRoot: true
+        runAsUser: 65534
+`)
+
+				cronJob, err := findResource(t, rm, "CronJob", "cleanup").AsYAML()
+				require.NoError(t, err)
+				assert.Contains(t, string(cronJob), `
+          securityContext:
+            runAsNonRoot: true
+            runAsUser: 1000
+`)
+			},
+		},
+	})
+}
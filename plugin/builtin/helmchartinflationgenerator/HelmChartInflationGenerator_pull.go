@@ -0,0 +1,795 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// ClearCache removes the contents of the helm cache directory, and of
+// the directory into which the chart was pulled, if kustomize pulled
+// it.  Charts vendored directly into ChartHome are left alone.
+func (p *plugin) ClearCache() error {
+	dirs := []string{filepath.Join(p.ConfigHome, ".cache")}
+	if p.Version != "" && p.Repo != "" {
+		dirs = append(dirs, p.absChartHome())
+	}
+	for _, dir := range dirs {
+		if err := removeContents(dir); err != nil {
+			return errors.WrapPrefixf(err, "unable to clear cache")
+		}
+	}
+	return nil
+}
+
+// removeContents removes everything inside dir, but not dir itself.
+func removeContents(dir string) error {
+	if dir == "" || filepath.Dir(dir) == dir {
+		return fmt.Errorf("refusing to clear '%s'", dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chartVersion returns the configured chart version, or the resolved
+// version if the chart was pulled without one.
+func (p *plugin) chartVersion() string {
+	if p.Version != "" {
+		return p.Version
+	}
+	return p.resolvedVersion
+}
+
+// pinLatestVersion records the version of a chart that was pulled
+// without a version, and warns that the build isn't reproducible.
+func (p *plugin) pinLatestVersion() error {
+	m, err := p.readChartMetadata()
+	if err != nil {
+		return err
+	}
+	p.resolvedVersion = m.Version
+	log.Printf(
+		"Warning: no version specified for chart '%s', resolved to '%s'; "+
+			"pin the version for reproducible builds", p.Name, m.Version)
+	if p.PinnedVersionFile == "" {
+		return nil
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.PinnedVersionFile, []byte(m.Version+"\n")),
+		"failed to write pinned version")
+}
+
+// isVendored returns true if the chart is given as a tarball,
+// rather than looked up in chart home.
+func (p *plugin) isVendored() bool {
+	return p.ChartTarball != "" || p.ChartTarballData != ""
+}
+
+// extractChartTarball verifies ChartTarball against ProvenanceFile,
+// if one is given, and extracts it, or ChartTarballData, into chart home.
+func (p *plugin) extractChartTarball() error {
+	if p.ChartTarballData != "" {
+		return p.extractChart(p.chartTarball)
+	}
+	b, err := p.h.Loader().Load(p.ChartTarball)
+	if err != nil {
+		return errors.WrapPrefixf(err, "unable to load chart tarball")
+	}
+	if p.ProvenanceFile != "" {
+		if err = p.verifyProvenance(b); err != nil {
+			return err
+		}
+	}
+	return p.extractChart(b)
+}
+
+// extractChart extracts a chart tarball into chart home,
+// enforcing MaxChartBytes.
+func (p *plugin) extractChart(tarball []byte) error {
+	if p.MaxChartBytes > 0 && int64(len(tarball)) > p.MaxChartBytes {
+		return fmt.Errorf(
+			"chart tarball of %d bytes exceeds maxChartBytes %d",
+			len(tarball), p.MaxChartBytes)
+	}
+	return extractTarball(
+		bytes.NewReader(tarball), p.absChartHome(), p.MaxChartBytes, p.FollowSymlinks)
+}
+
+// verifyProvenance runs 'helm verify' on the chart tarball, which
+// expects the provenance file to sit next to the tarball.
+func (p *plugin) verifyProvenance(tarball []byte) error {
+	prov, err := p.h.Loader().Load(p.ProvenanceFile)
+	if err != nil {
+		return errors.WrapPrefixf(err, "unable to load provenance file")
+	}
+	path := filepath.Join(p.tmpDir, filepath.Base(p.ChartTarball))
+	if err = os.WriteFile(path, tarball, 0644); err != nil {
+		return errors.WrapPrefixf(err, "failed to write chart tarball")
+	}
+	if err = os.WriteFile(path+".prov", prov, 0644); err != nil {
+		return errors.WrapPrefixf(err, "failed to write provenance file")
+	}
+	_, err = p.runHelmCommand([]string{
+		"verify", "--keyring", p.absPath(p.Keyring), path})
+	return errors.WrapPrefixf(err, "chart tarball failed provenance verification")
+}
+
+// extractTarball extracts a gzipped chart tarball into dir.
+// Only directories, regular files and symlinks are extracted, and
+// none may be placed outside of dir, nor written through a symlink
+// extracted earlier.  Symlinks resolving outside of dir are an error,
+// unless followSymlinks.  If maxBytes is positive, it bounds the
+// total size of the extracted files.
+func extractTarball(r io.Reader, dir string, maxBytes int64, followSymlinks bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.WrapPrefixf(err, "unable to create chart directory")
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return errors.WrapPrefixf(err, "unable to resolve chart directory")
+	}
+	var extracted int64
+	var links []string
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.WrapPrefixf(err, "unable to read chart tarball")
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WrapPrefixf(err, "unable to read chart tarball")
+		}
+		target := filepath.Join(root, filepath.FromSlash(hdr.Name))
+		if !isWithin(root, target) || target == root {
+			return fmt.Errorf("chart tarball entry '%s' is outside of the chart", hdr.Name)
+		}
+		if link, err := firstSymlink(root, target); err != nil {
+			return errors.WrapPrefixf(err, "unable to extract '%s'", hdr.Name)
+		} else if link != "" {
+			return fmt.Errorf(
+				"chart tarball entry '%s' would be written through the symlink '%s'",
+				hdr.Name, filepath.ToSlash(strings.TrimPrefix(link, root+string(filepath.Separator))))
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			var entry io.Reader = tr
+			if maxBytes > 0 {
+				entry = io.LimitReader(tr, maxBytes-extracted+1)
+			}
+			var n int64
+			n, err = writeTarEntry(entry, target)
+			extracted += n
+		case tar.TypeSymlink:
+			if !followSymlinks {
+				if resolved, err := resolvePath(filepath.Dir(target), hdr.Linkname, 0); err != nil {
+					return errors.WrapPrefixf(err, "unable to resolve '%s'", hdr.Name)
+				} else if !isWithin(root, resolved) {
+					return fmt.Errorf(
+						"chart tarball entry '%s' is a symlink to '%s', outside of the chart",
+						hdr.Name, hdr.Linkname)
+				}
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+			links = append(links, strings.TrimPrefix(target, root+string(filepath.Separator)))
+		}
+		if err != nil {
+			return errors.WrapPrefixf(err, "unable to extract '%s'", hdr.Name)
+		}
+		if maxBytes > 0 && extracted > maxBytes {
+			return fmt.Errorf(
+				"extracted chart exceeds maxChartBytes %d", maxBytes)
+		}
+	}
+	if followSymlinks {
+		return nil
+	}
+	// A symlink checked above may since have been redirected by
+	// symlinks extracted after it, so check them all once more.
+	for _, link := range links {
+		resolved, err := resolvePath(root, link, 0)
+		if err != nil {
+			return errors.WrapPrefixf(err, "unable to resolve '%s'", link)
+		}
+		if !isWithin(root, resolved) {
+			return fmt.Errorf(
+				"chart tarball symlink '%s' resolves outside of the chart", link)
+		}
+	}
+	return nil
+}
+
+// maxSymlinkHops bounds the symlinks followed by resolvePath,
+// guarding against symlink loops.
+const maxSymlinkHops = 255
+
+// resolvePath returns the path that name, relative to the directory
+// dir, refers to, evaluating the symlinks on disk one component at
+// a time, as the OS would.  Unlike filepath.EvalSymlinks, the path
+// need not exist, and '..' is never applied before the preceding
+// symlink is evaluated.  dir must not contain symlinks.
+func resolvePath(dir, name string, hops int) (string, error) {
+	current := dir
+	if filepath.IsAbs(name) {
+		current = string(filepath.Separator)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(name), "/") {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+		next := filepath.Join(current, elem)
+		fi, err := os.Lstat(next)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+		if hops >= maxSymlinkHops {
+			return "", fmt.Errorf("too many levels of symlinks at '%s'", next)
+		}
+		dest, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if current, err = resolvePath(current, dest, hops+1); err != nil {
+			return "", err
+		}
+	}
+	return current, nil
+}
+
+// firstSymlink returns the first existing symlink among path and
+// its ancestors below root, or "" if there is none.
+func firstSymlink(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	current := root
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, elem)
+		fi, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return current, nil
+		}
+	}
+	return "", nil
+}
+
+// isWithin returns true if path is dir or lies below it.
+func isWithin(dir, path string) bool {
+	dir = filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func writeTarEntry(r io.Reader, path string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(f, r) //nolint:gosec
+}
+
+// pullChart pulls the chart into chart home.
+func (p *plugin) pullChart() error {
+	if p.CosignVerify != nil {
+		if err := p.verifyChartSignature(); err != nil {
+			return err
+		}
+	}
+	if p.MaxChartBytes > 0 {
+		if err := os.MkdirAll(p.pullDir(), 0755); err != nil {
+			return err
+		}
+	}
+	limiter := concurrencyLimiterFor("pull", p.MaxPullConcurrency)
+	limiter.acquire()
+	defer limiter.release()
+	_, err := p.runHelmCommandWithTimeout(p.pullCommand(), p.pullTimeout)
+	if err != nil || p.MaxChartBytes == 0 {
+		return err
+	}
+	// A bounded chart is pulled as a tarball, and extracted here.
+	tarballs, err := filepath.Glob(filepath.Join(p.pullDir(), "*.tgz"))
+	if err != nil {
+		return err
+	}
+	if len(tarballs) != 1 {
+		return fmt.Errorf("expected one chart tarball in '%s', found %d",
+			p.pullDir(), len(tarballs))
+	}
+	b, err := os.ReadFile(tarballs[0])
+	if err != nil {
+		return errors.WrapPrefixf(err, "unable to read pulled chart")
+	}
+	return p.extractChart(b)
+}
+
+// verifyChartSignature verifies the signature of the chart's OCI
+// reference, at Version, with cosign, on the registry the chart is
+// pulled from.  The manifest digest that cosign verified is recorded,
+// so that exactly that manifest is pulled, even if the tag has been
+// moved since.
+func (p *plugin) verifyChartSignature() error {
+	command := p.CosignVerify.Command
+	if command == "" {
+		command = "cosign"
+	}
+	ref := strings.TrimPrefix(p.mirrored(p.ociChartRef()), "oci://")
+	if p.Version != "" {
+		ref += ":" + p.Version
+	}
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(command, "verify", "--key", p.absPath(p.CosignVerify.Key), ref)
+	cmd.Dir = p.h.Loader().Root()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return errors.WrapPrefixf(
+			fmt.Errorf("cosign failed to verify chart '%s': %w", ref, err), stderr.String())
+	}
+	// cosign prints the verified signature payloads, each
+	// naming the digest of the manifest it signs.
+	var payloads []struct {
+		Critical struct {
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &payloads); err != nil {
+		return errors.WrapPrefixf(err, "unable to parse cosign output for chart '%s'", ref)
+	}
+	digest := ""
+	for _, payload := range payloads {
+		d := payload.Critical.Image.Digest
+		if d == "" || (digest != "" && d != digest) {
+			return fmt.Errorf("cosign verified no single digest of chart '%s'", ref)
+		}
+		digest = d
+	}
+	if digest == "" {
+		return fmt.Errorf("cosign verified no signature of chart '%s'", ref)
+	}
+	p.chartDigest = digest
+	return nil
+}
+
+// ociChartRef returns the 'oci://' reference of the chart in Repo.
+func (p *plugin) ociChartRef() string {
+	return strings.TrimSuffix(p.Repo, "/") + "/" + p.Name
+}
+
+// pullChartOrFallback pulls the chart, refreshing the repository
+// index if it's corrupted or Version isn't found, and falling back to
+// FallbackVersion if Version still isn't found.
+func (p *plugin) pullChartOrFallback() error {
+	err := p.pullChart()
+	if isChecksumMismatch(err) && p.RefreshOnChecksumMismatch {
+		log.Printf(
+			"Warning: checksum mismatch pulling chart '%s', clearing cached repository indexes",
+			p.Name)
+		if err = removeContents(filepath.Join(p.ConfigHome, ".cache", "repository")); err != nil {
+			return errors.WrapPrefixf(err, "unable to clear cached repository indexes")
+		}
+		err = p.pullChart()
+	}
+	if isNotFound(err) && p.RefreshIndexOnMiss {
+		log.Printf(
+			"Warning: version '%s' of chart '%s' not found, refreshing repository index",
+			p.Version, p.Name)
+		// A pull from a repository URL configures no repository to
+		// 'helm repo update', so the index is fetched again into an
+		// empty cache instead.
+		if err = p.establishTmpDir(); err != nil {
+			return err
+		}
+		p.repositoryCache, err = os.MkdirTemp(p.tmpDir, "repository-")
+		if err != nil {
+			return errors.WrapPrefixf(err, "unable to create repository cache")
+		}
+		err = p.pullChart()
+	}
+	if !isNotFound(err) || p.FallbackVersion == "" {
+		return err
+	}
+	log.Printf(
+		"Warning: version '%s' of chart '%s' not found, falling back to version '%s'",
+		p.Version, p.Name, p.FallbackVersion)
+	oldHome := p.absChartHome()
+	p.Version = p.FallbackVersion
+	if strings.HasPrefix(p.ValuesFile, oldHome+string(filepath.Separator)) {
+		p.ValuesFile = filepath.Join(
+			p.absChartHome(), strings.TrimPrefix(p.ValuesFile, oldHome))
+	}
+	if _, exists := p.chartExistsLocally(); exists {
+		return nil
+	}
+	return p.pullChart()
+}
+
+// chartNotFoundRe matches the errors of helm reporting that a chart,
+// or a version of it, isn't in the repository.
+var chartNotFoundRe = regexp.MustCompile( //nolint:gochecknoglobals
+	`chart "[^"]*"( version "[^"]*")? not found in|no chart version found for`)
+
+// isNotFound returns true if err reports that the chart
+// version wasn't found in the repository.
+func isNotFound(err error) bool {
+	return err != nil && chartNotFoundRe.MatchString(err.Error())
+}
+
+// isChecksumMismatch returns true if err reports that a checksum
+// didn't match, e.g. the one of a cached repository index.
+func isChecksumMismatch(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "checksum mismatch")
+}
+
+// pullDir is where a chart is pulled to before extraction.
+func (p *plugin) pullDir() string {
+	return filepath.Join(p.tmpDir, "pulled")
+}
+
+// errIfUndeclaredTags returns an error if Tags names a tag
+// not declared by any dependency of the chart.
+func (p *plugin) errIfUndeclaredTags() error {
+	m, err := p.readChartMetadata()
+	if err != nil {
+		return err
+	}
+	declared := map[string]bool{}
+	for _, dep := range m.Dependencies {
+		for _, tag := range dep.Tags {
+			declared[tag] = true
+		}
+	}
+	for _, tag := range sortedKeys(p.Tags) {
+		if !declared[tag] {
+			return fmt.Errorf(
+				"tag '%s' is not declared by any dependency of chart '%s'", tag, p.Name)
+		}
+	}
+	return nil
+}
+
+// dependencyMu serializes fetching dependencies, so that
+// charts sharing a dependency fetch it only once.
+var dependencyMu sync.Mutex //nolint:gochecknoglobals
+
+// fetchDependencies copies the chart's dependencies missing from its
+// charts directory out of the dependency cache, fetching those not
+// yet cached.
+func (p *plugin) fetchDependencies() error {
+	m, err := p.readChartMetadata()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(p.absChartHome(), p.Name, "charts")
+	dependencyMu.Lock()
+	defer dependencyMu.Unlock()
+	for _, dep := range m.Dependencies {
+		if !strings.HasPrefix(dep.Repository, "oci://") &&
+			!strings.HasPrefix(dep.Repository, "http://") &&
+			!strings.HasPrefix(dep.Repository, "https://") {
+			// Local and named repositories are left to helm.
+			continue
+		}
+		if dependencyExists(dir, dep.Name) {
+			continue
+		}
+		name, blob, err := p.cachedDependency(dep)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(blob)
+		if err != nil {
+			return errors.WrapPrefixf(err, "unable to read dependency '%s'", dep.Name)
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err = os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			return errors.WrapPrefixf(err, "unable to write dependency '%s'", dep.Name)
+		}
+		if p.CacheMaxBytes > 0 {
+			if err = p.collectDependencyCache(blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dependencyExists returns true if the charts directory holds
+// the dependency, either as a tarball or unpacked.
+func dependencyExists(dir, name string) bool {
+	if _, err := os.Stat(filepath.Join(dir, name, "Chart.yaml")); err == nil {
+		return true
+	}
+	tarballs, _ := filepath.Glob(filepath.Join(dir, name+"-*.tgz"))
+	return len(tarballs) > 0
+}
+
+// cachedDependency returns the file name of the dependency's tarball
+// and the path of its blob in the dependency cache, pulling it into the
+// cache if it's missing.  The cache stores each tarball once, as the
+// blob 'sha256/{digest}', and refers to it from the directory
+// '{name}/{version}' by a file '{tarball}.digest' holding the digest.
+// The version is the one the dependency's version resolves to, so
+// that ranges pick up the releases made since they were last cached.
+func (p *plugin) cachedDependency(dep chartDependency) (string, string, error) {
+	version, err := p.resolveDependencyVersion(dep)
+	if err != nil {
+		return "", "", err
+	}
+	cache := filepath.Join(p.absChartHomeRoot(), ".dependencies")
+	dir := filepath.Join(cache, dep.Name, url.PathEscape(version))
+	refs, err := filepath.Glob(filepath.Join(dir, "*.tgz.digest"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(refs) == 1 {
+		digest, err := os.ReadFile(refs[0])
+		if err != nil {
+			return "", "", err
+		}
+		blob := filepath.Join(cache, "sha256", strings.TrimSpace(string(digest)))
+		now := time.Now()
+		if err = os.Chtimes(blob, now, now); err == nil {
+			return strings.TrimSuffix(filepath.Base(refs[0]), ".digest"), blob, nil
+		}
+		// The blob was evicted.
+		if err = os.Remove(refs[0]); err != nil {
+			return "", "", err
+		}
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	args := append([]string{"pull", "--destination", dir}, p.dependencyRef(dep)...)
+	args = append(args, "--version", version)
+	if _, err = p.runHelmCommandWithTimeout(args, p.pullTimeout); err != nil {
+		return "", "", errors.WrapPrefixf(err, "unable to fetch dependency '%s'", dep.Name)
+	}
+	tarballs, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(tarballs) != 1 {
+		return "", "", fmt.Errorf("expected one tarball of dependency '%s' in '%s', found %d",
+			dep.Name, dir, len(tarballs))
+	}
+	return storeDependency(cache, tarballs[0])
+}
+
+// exactVersionRe matches the semantic versions that name a single
+// release, rather than a range of them.
+var exactVersionRe = regexp.MustCompile( //nolint:gochecknoglobals
+	`^v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// resolveDependencyVersion returns the version of the release the
+// dependency's version refers to.  Ranges, and missing versions, are
+// resolved to the latest matching release in the dependency's
+// repository by 'helm show chart'.
+func (p *plugin) resolveDependencyVersion(dep chartDependency) (string, error) {
+	if exactVersionRe.MatchString(dep.Version) {
+		return dep.Version, nil
+	}
+	args := append([]string{"show", "chart"}, p.dependencyRef(dep)...)
+	if dep.Version != "" {
+		args = append(args, "--version", dep.Version)
+	}
+	out, err := p.runHelmCommandWithTimeout(args, p.pullTimeout)
+	if err != nil {
+		return "", errors.WrapPrefixf(err,
+			"unable to resolve version '%s' of dependency '%s'", dep.Version, dep.Name)
+	}
+	var m chartMetadata
+	if err = yaml.Unmarshal(out, &m); err != nil || m.Version == "" {
+		return "", fmt.Errorf(
+			"unable to resolve version '%s' of dependency '%s': no version in\n%s",
+			dep.Version, dep.Name, out)
+	}
+	return m.Version, nil
+}
+
+// dependencyRef returns the arguments of 'helm pull' and
+// 'helm show' naming the dependency's chart.
+func (p *plugin) dependencyRef(dep chartDependency) []string {
+	if strings.HasPrefix(dep.Repository, "oci://") {
+		return []string{p.mirrored(strings.TrimSuffix(dep.Repository, "/") + "/" + dep.Name)}
+	}
+	return []string{"--repo", dep.Repository, dep.Name}
+}
+
+// storeDependency moves the pulled tarball into the blobs of the
+// dependency cache, leaving a reference to it in its place.
+func storeDependency(cache, tarball string) (string, string, error) {
+	b, err := os.ReadFile(tarball)
+	if err != nil {
+		return "", "", err
+	}
+	digest := fmt.Sprintf("%x", sha256.Sum256(b))
+	blob := filepath.Join(cache, "sha256", digest)
+	if err = os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return "", "", err
+	}
+	if err = os.Rename(tarball, blob); err != nil {
+		return "", "", errors.WrapPrefixf(err, "unable to store dependency")
+	}
+	if err = os.WriteFile(tarball+".digest", []byte(digest+"\n"), 0644); err != nil {
+		return "", "", errors.WrapPrefixf(err, "unable to store dependency")
+	}
+	return filepath.Base(tarball), blob, nil
+}
+
+// collectDependencyCache evicts the least recently used blobs from
+// the dependency cache until their total size is within CacheMaxBytes.
+// The blob in use is never evicted.  References to evicted blobs are
+// dropped when next used.
+func (p *plugin) collectDependencyCache(inUse string) error {
+	entries, err := os.ReadDir(filepath.Join(p.absChartHomeRoot(), ".dependencies", "sha256"))
+	if err != nil {
+		return err
+	}
+	var blobs []fs.FileInfo
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, info)
+		total += info.Size()
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].ModTime().Before(blobs[j].ModTime())
+	})
+	for _, info := range blobs {
+		if total <= p.CacheMaxBytes {
+			break
+		}
+		blob := filepath.Join(filepath.Dir(inUse), info.Name())
+		if blob == inUse {
+			continue
+		}
+		if err = os.Remove(blob); err != nil {
+			return errors.WrapPrefixf(err, "unable to evict cached dependency")
+		}
+		total -= info.Size()
+	}
+	return nil
+}
+
+// concurrencyLimiter bounds how many helm invocations of one kind
+// run at once, across all instances of the plugin sharing the bound.
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	max     int
+	running int
+}
+
+// concurrencyLimiters holds a limiter per kind of invocation and
+// bound, so that the plugins configured with different bounds,
+// e.g. by the HelmGlobals of different kustomizations, don't
+// count each other's invocations.
+var concurrencyLimiters = struct { //nolint:gochecknoglobals
+	sync.Mutex
+	m map[string]*concurrencyLimiter
+}{m: map[string]*concurrencyLimiter{}}
+
+// concurrencyLimiterFor returns the limiter of the kind of
+// invocation with the bound max, or nil, which doesn't limit
+// anything, if max is zero (or less).
+func concurrencyLimiterFor(kind string, max int) *concurrencyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	concurrencyLimiters.Lock()
+	defer concurrencyLimiters.Unlock()
+	key := kind + "/" + strconv.Itoa(max)
+	l, found := concurrencyLimiters.m[key]
+	if !found {
+		l = &concurrencyLimiter{max: max}
+		l.cond = sync.NewCond(&l.mu)
+		concurrencyLimiters.m[key] = l
+	}
+	return l
+}
+
+// acquire blocks until fewer than max invocations are running.
+func (l *concurrencyLimiter) acquire() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.running >= l.max {
+		l.cond.Wait()
+	}
+	l.running++
+}
+
+func (l *concurrencyLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.cond.Signal()
+}
+
+// mirrored returns the 'oci://' reference ref with its registry host
+// replaced by RegistryMirror, if set.
+func (p *plugin) mirrored(ref string) string {
+	if p.RegistryMirror == "" || !strings.HasPrefix(ref, "oci://") {
+		return ref
+	}
+	path := strings.TrimPrefix(ref, "oci://")
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[i:]
+	} else {
+		path = ""
+	}
+	return "oci://" + strings.TrimSuffix(strings.TrimPrefix(p.RegistryMirror, "oci://"), "/") + path
+}
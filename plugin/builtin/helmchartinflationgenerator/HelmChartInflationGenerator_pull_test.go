@@ -0,0 +1,940 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/resmap"
+	kusttest_test "sigs.k8s.io/kustomize/api/testutils/kusttest"
+)
+
+func TestHelmChartInflationGeneratorPulls(t *testing.T) {
+	renderedTest := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`
+	// The fake 'helm verify' accepts provenance files that say 'good',
+	// and 'helm template' checks that the chart was extracted.
+	provenanceHelm := `if [ "$1" = "verify" ]; then
+  grep -q good "$4.prov" || { echo "Error: sha256 sum does not match" >&2; exit 1; }
+  exit 0
+fi
+if [ "$1" = "template" ]; then
+  test -f "$3/Chart.yaml" || exit 1
+fi
+` + fakeHelmPreamble
+	provenanceConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: vendored
+name: vendored
+releaseName: test
+chartTarball: vendored-1.0.0.tgz
+keyring: pubring.gpg
+`
+	provenanceFiles := map[string]string{
+		"pubring.gpg": "keys",
+		"good.prov":   "good",
+		"bad.prov":    "bad",
+	}
+	writeVendoredTarball := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		writeChartTarball(t, filepath.Join(th.GetRoot(), "vendored-1.0.0.tgz"), map[string]string{
+			"vendored/Chart.yaml":  "apiVersion: v2\nname: vendored\nversion: 1.0.0\n",
+			"vendored/values.yaml": "foo: bar\n",
+		})
+	}
+	// The fake 'helm pull' logs its arguments, and creates the chart.
+	logPullHelm := `if [ "$1" = "pull" ]; then
+  echo "$@" > "$root/pulls.log"
+  mkdir -p "$4/app"
+  touch "$4/app/values.yaml"
+  exit 0
+fi
+` + fakeHelmPreamble
+	// The fake 'helm pull' copies the tarball named after
+	// the version into the destination.
+	maxChartBytesHelm := `if [ "$1" = "pull" ]; then
+  cp "$root/tarballs/$8.tgz" "$3/app-$8.tgz"
+  exit 0
+fi
+` + fakeHelmPreamble
+	writeSizedTarballs := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		th.MkDir("tarballs")
+		writeChartTarball(t, filepath.Join(th.GetRoot(), "tarballs", "small.tgz"), map[string]string{
+			"app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+			"app/values.yaml": "",
+		})
+		// A megabyte of zeros compresses into a tarball of a few kilobytes.
+		writeChartTarball(t, filepath.Join(th.GetRoot(), "tarballs", "bomb.tgz"), map[string]string{
+			"app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+			"app/values.yaml": strings.Repeat("\x00", 1<<20),
+		})
+	}
+	maxChartBytesConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: https://example.com/charts
+releaseName: test
+`
+	// The fake 'helm pull' copies the tarball named after the chart
+	// and version into the destination.
+	copyTarballHelm := func(logged string) string {
+		return `if [ "$1" = "pull" ]; then
+  echo "` + logged + `" >> "$root/pulls.log"
+  cp "$root/$6-$8.tgz" "$3/"
+  exit 0
+fi
+` + fakeHelmPreamble
+	}
+	umbrellaFiles := map[string]string{
+		"charts/umbrella/Chart.yaml": `
+apiVersion: v2
+name: umbrella
+version: 1.0.0
+dependencies:
+- name: api
+  version: 1.0.0
+  repository: file://../api
+  tags: [backend]
+- name: prometheus
+  version: 1.0.0
+  repository: file://../prometheus
+  tags: [monitoring]
+`,
+		"charts/umbrella/values.yaml": "",
+	}
+	umbrellaConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: umbrella
+name: umbrella
+`
+	fallbackVersionHelm := `if [ "$1" = "pull" ] && [ "$9" = "2.0.0" ]; then
+  echo "Error: chart \"app\" version \"2.0.0\" not found in https://example.com/charts repository" >&2
+  exit 1
+fi
+` + fakeHelmPreamble + fakeHelmPullChart
+	appConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: https://example.com/charts
+version: 2.0.0
+releaseName: test
+`
+	linkedConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: linked
+name: linked
+releaseName: test
+`
+	writeLinkedTarballs := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		files := map[string]string{
+			"linked/Chart.yaml":  "apiVersion: v2\nname: linked\nversion: 1.0.0\n",
+			"linked/values.yaml": "foo: bar\n",
+		}
+		writeChartTarballWithSymlinks(t, filepath.Join(th.GetRoot(), "inside.tgz"), files,
+			map[string]string{"linked/defaults.yaml": "values.yaml"})
+		writeChartTarballWithSymlinks(t, filepath.Join(th.GetRoot(), "escaping.tgz"), files,
+			map[string]string{"linked/templates/passwd": "../../../../../etc/passwd"})
+	}
+	// writeChainedTarballs writes tarballs of symlink chains.  Their
+	// entries are written in order, as symlinks if they have a target
+	// and as files otherwise.
+	writeChainedTarballs := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		writeTarball := func(name string, entries [][2]string) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			for _, e := range entries {
+				hdr := &tar.Header{Name: e[0], Mode: 0644, Typeflag: tar.TypeReg}
+				if e[1] != "" {
+					hdr.Linkname, hdr.Mode, hdr.Typeflag = e[1], 0777, tar.TypeSymlink
+				}
+				require.NoError(t, tw.WriteHeader(hdr))
+			}
+			require.NoError(t, tw.Close())
+			require.NoError(t, gz.Close())
+			require.NoError(t, os.WriteFile( //nolint:gosec
+				filepath.Join(th.GetRoot(), name), buf.Bytes(), 0644))
+		}
+		// Each symlink on its own resolves within the chart home,
+		// but 'c' resolves to the kustomization root.
+		writeTarball("chain.tgz", [][2]string{
+			{"a/b", ".."},
+			{"c", "a/b/.."},
+			{"c/evil", ""},
+		})
+		// 'c' resolves within the chart home when extracted, but
+		// not once 'x' is extracted after it.
+		writeTarball("late.tgz", [][2]string{
+			{"c", "x/.."},
+			{"a/b", ".."},
+			{"x", "a/b"},
+		})
+	}
+	// The fake 'helm pull' logs the chart reference it pulls.
+	cosignHelm := `if [ "$1" = "pull" ]; then
+  echo "$5" >> "$root/pulls.log"
+  mkdir -p "$4/app"
+  touch "$4/app/values.yaml"
+  exit 0
+fi
+` + fakeHelmPreamble
+	// The fake cosign only accepts signatures made with trusted.pub,
+	// of the mirror's manifest.
+	writeCosign := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		th.WriteF(filepath.Join(th.GetRoot(), "cosign"), `#!/bin/sh
+[ "$1 $2" = "verify --key" ] || exit 2
+case "$3" in
+*/trusted.pub)
+  echo "Verification for $4 -- The cosign claims were validated" >&2
+  echo '[{"critical":{"identity":{"docker-reference":"'${4%:*}'"},'\
+'"image":{"docker-manifest-digest":"sha256:4f5a"},"type":"cosign container image signature"}}]'
+  exit 0;;
+esac
+echo "Error: no matching signatures for $4" >&2
+exit 1
+`)
+		require.NoError(t, os.Chmod(filepath.Join(th.GetRoot(), "cosign"), 0755))
+		th.WriteF(filepath.Join(th.GetRoot(), "trusted.pub"), "trusted")
+		th.WriteF(filepath.Join(th.GetRoot(), "other.pub"), "other")
+	}
+	cosignConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: oci://registry.example.com/charts
+registryMirror: mirror.example.com
+version: 1.0.0
+cosignVerify:
+  command: ./cosign
+`
+	checksumMismatchHelm := `if [ "$1" = "pull" ] && [ -f "$HELM_CACHE_HOME/repository/example-index.yaml" ]; then
+  echo "Error: checksum mismatch for index of https://example.com/charts" >&2
+  exit 1
+fi
+` + fakeHelmPreamble + fakeHelmPullChart
+
+	runGeneratorCases(t, []generatorCase{
+		{
+			name: "maxPullConcurrency",
+			helm: fakeHelmPreamble + `
+touch "$root/pulls/running.$$"
+ls "$root/pulls" | grep -c running >> "$root/pulls.log"
+sleep 0.2
+rm "$root/pulls/running.$$"
+` + fakeHelmPullChart,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				th.MkDir("pulls")
+				config := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: chart-%d
+name: chart-%d
+version: 1.0.0
+repo: https://example.com/charts
+releaseName: release-%d
+maxPullConcurrency: 2
+`
+				var wg sync.WaitGroup
+				errs := make([]error, 6)
+				for i := range errs {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						errs[i] = th.ErrorFromLoadAndRunGenerator(fmt.Sprintf(config, i, i, i))
+					}(i)
+				}
+				wg.Wait()
+				for _, err := range errs {
+					require.NoError(t, err)
+				}
+
+				log, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				counts := strings.Fields(string(log))
+				assert.Len(t, counts, len(errs))
+				for _, count := range counts {
+					assert.LessOrEqual(t, count, "2")
+				}
+			},
+		},
+		{
+			name: "ClearCache",
+			files: map[string]string{
+				"helm/.cache/repository/index.yaml": "entries: {}",
+				"charts/podinfo-6.2.1/Chart.yaml":   "name: podinfo",
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				g := th.LoadGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: podinfo
+name: podinfo
+version: 6.2.1
+repo: https://stefanprodan.github.io/podinfo
+releaseName: podinfo
+configHome: ` + filepath.Join(th.GetRoot(), "helm") + `
+`)
+				c, ok := g.(interface{ ClearCache() error })
+				require.True(t, ok)
+				require.NoError(t, c.ClearCache())
+
+				for _, dir := range []string{
+					filepath.Join(th.GetRoot(), "helm", ".cache"),
+					filepath.Join(th.GetRoot(), "charts", "podinfo-6.2.1"),
+				} {
+					entries, err := os.ReadDir(dir)
+					require.NoError(t, err)
+					assert.Empty(t, entries)
+				}
+				// Vendored charts are left alone.
+				assert.True(t, th.GetFSys().Exists(
+					filepath.Join(th.GetRoot(), "charts", "test-chart", "Chart.yaml")))
+			},
+		},
+		{
+			name:     "provenanceFile",
+			helm:     provenanceHelm,
+			files:    provenanceFiles,
+			setup:    writeVendoredTarball,
+			config:   provenanceConfig + "provenanceFile: good.prov\n",
+			expected: renderedTest,
+		},
+		{
+			name:  "provenanceFile failing verification",
+			helm:  provenanceHelm,
+			files: provenanceFiles,
+			setup: writeVendoredTarball,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(provenanceConfig + "provenanceFile: bad.prov\n")
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "chart tarball failed provenance verification")
+				assert.Contains(t, err.Error(), "sha256 sum does not match")
+			},
+		},
+		{
+			name:  "registryCAFile",
+			helm:  logPullHelm,
+			files: map[string]string{"registry-ca.pem": "ca"},
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: oci://registry.example.com/charts
+version: 1.0.0
+registryCAFile: registry-ca.pem
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				assert.Contains(t, string(b), "--ca-file "+
+					filepath.Join(th.GetRoot(), "registry-ca.pem")+
+					" oci://registry.example.com/charts/app --version 1.0.0")
+			},
+		},
+		{
+			name:  "registryCAFile with an https repo",
+			helm:  logPullHelm,
+			files: map[string]string{"registry-ca.pem": "ca"},
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: https://example.com/charts
+registryCAFile: registry-ca.pem
+`,
+			err: "registryCAFile requires an oci:// repo",
+		},
+		{
+			name:  "maxChartBytes",
+			helm:  maxChartBytesHelm,
+			setup: writeSizedTarballs,
+			config: maxChartBytesConfig + `
+version: small
+chartHome: small-charts
+maxChartBytes: 65536
+`,
+			expected: renderedTest,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				assert.FileExists(t, filepath.Join(th.GetRoot(), "small-charts", "app-small", "app", "Chart.yaml"))
+			},
+		},
+		{
+			name:  "maxChartBytes exceeded by the tarball",
+			helm:  maxChartBytesHelm,
+			setup: writeSizedTarballs,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(maxChartBytesConfig + `
+version: small
+chartHome: tiny-charts
+maxChartBytes: 16
+`)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "exceeds maxChartBytes 16")
+				assert.Contains(t, err.Error(), "chart tarball of")
+			},
+		},
+		{
+			name:  "maxChartBytes exceeded by the extracted chart",
+			helm:  maxChartBytesHelm,
+			setup: writeSizedTarballs,
+			config: maxChartBytesConfig + `
+version: bomb
+chartHome: bomb-charts
+maxChartBytes: 65536
+`,
+			err: "extracted chart exceeds maxChartBytes 65536",
+		},
+		{
+			name: "fetchDependencies",
+			helm: copyTarballHelm("$@"),
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				writeChartTarball(t, filepath.Join(th.GetRoot(), "common-1.0.0.tgz"), map[string]string{
+					"common/Chart.yaml": "apiVersion: v2\nname: common\nversion: 1.0.0\n",
+				})
+				for _, chart := range []string{"api", "worker"} {
+					require.NoError(t, os.MkdirAll(filepath.Join(th.GetRoot(), "charts", chart), 0755))
+					th.WriteF(filepath.Join(th.GetRoot(), "charts", chart, "Chart.yaml"), `
+apiVersion: v2
+name: `+chart+`
+version: 1.0.0
+dependencies:
+- name: common
+  version: 1.0.0
+  repository: https://example.com/charts
+`)
+					th.WriteF(filepath.Join(th.GetRoot(), "charts", chart, "values.yaml"), "")
+				}
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				for _, chart := range []string{"api", "worker"} {
+					th.LoadAndRunGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: ` + chart + `
+name: ` + chart + `
+releaseName: ` + chart + `
+fetchDependencies: true
+`)
+					assert.FileExists(t, filepath.Join(
+						th.GetRoot(), "charts", chart, "charts", "common-1.0.0.tgz"))
+				}
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				assert.Equal(t, "pull --destination "+
+					filepath.Join(th.GetRoot(), "charts", ".dependencies", "common", "1.0.0")+
+					" --repo https://example.com/charts common --version 1.0.0\n", string(b))
+			},
+		},
+		{
+			// The fake 'helm show chart' reports the latest release
+			// of common in the repository.
+			name: "fetchDependencies with a version range",
+			helm: `if [ "$1" = "show" ] && [ "$2" = "chart" ]; then
+  echo "name: $5"
+  echo "version: $(cat "$root/latest")"
+  exit 0
+fi
+` + copyTarballHelm("$8"),
+			files: map[string]string{
+				"charts/api/Chart.yaml": `
+apiVersion: v2
+name: api
+version: 1.0.0
+dependencies:
+- name: common
+  version: ^1.0.0
+  repository: https://example.com/charts
+`,
+				"charts/api/values.yaml": "",
+				"latest":                 "1.0.0",
+			},
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				for _, version := range []string{"1.0.0", "1.1.0"} {
+					writeChartTarball(t, filepath.Join(th.GetRoot(), "common-"+version+".tgz"), map[string]string{
+						"common/Chart.yaml": "apiVersion: v2\nname: common\nversion: " + version + "\n",
+					})
+				}
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				chartDir := filepath.Join(th.GetRoot(), "charts", "api")
+				render := func() {
+					t.Helper()
+					require.NoError(t, os.RemoveAll(filepath.Join(chartDir, "charts")))
+					th.LoadAndRunGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: api
+name: api
+releaseName: api
+fetchDependencies: true
+`)
+				}
+				render()
+				assert.FileExists(t, filepath.Join(chartDir, "charts", "common-1.0.0.tgz"))
+				render()
+				th.WriteF(filepath.Join(th.GetRoot(), "latest"), "1.1.0")
+				render()
+				assert.FileExists(t, filepath.Join(chartDir, "charts", "common-1.1.0.tgz"))
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				assert.Equal(t, "1.0.0\n1.1.0\n", string(b))
+			},
+		},
+		{
+			// The fake 'helm pull' hangs.
+			name: "pullTimeout",
+			helm: `[ "$1" = "pull" ] && exec sleep 10
+` + fakeHelmPreamble,
+			files: map[string]string{
+				"charts/api/Chart.yaml": `
+apiVersion: v2
+name: api
+version: 1.0.0
+dependencies:
+- name: common
+  version: 1.0.0
+  repository: https://example.com/charts
+`,
+				"charts/api/values.yaml": "",
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				start := time.Now()
+				err := th.ErrorFromLoadAndRunGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: api
+name: api
+fetchDependencies: true
+pullTimeout: 200ms
+`)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "unable to fetch dependency 'common'")
+				assert.Contains(t, err.Error(), "timed out after 200ms")
+				assert.Less(t, time.Since(start), 5*time.Second)
+			},
+		},
+		{
+			name: "tags",
+			helm: `[ "$1" = "template" ] && echo "$@" > "$root/templates.log"
+` + fakeHelmPreamble,
+			files: umbrellaFiles,
+			config: umbrellaConfig + `
+tags:
+  backend: true
+  monitoring: false
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "templates.log"))
+				require.NoError(t, err)
+				assert.Contains(t, string(b), "--set tags.backend=true --set tags.monitoring=false")
+			},
+		},
+		{
+			name:  "undeclared tags",
+			files: umbrellaFiles,
+			config: umbrellaConfig + `
+tags:
+  logging: true
+`,
+			err: "tag 'logging' is not declared by any dependency of chart 'umbrella'",
+		},
+		{
+			name:   "version not found",
+			helm:   fallbackVersionHelm,
+			config: appConfig,
+			err:    `version "2.0.0" not found`,
+		},
+		{
+			name:     "fallbackVersion",
+			helm:     fallbackVersionHelm,
+			config:   appConfig + "fallbackVersion: 1.9.0\n",
+			expected: renderedTest,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				assert.FileExists(t, filepath.Join(th.GetRoot(), "charts", "app-1.9.0", "app", "Chart.yaml"))
+				assert.NoDirExists(t, filepath.Join(th.GetRoot(), "charts", "app-2.0.0", "app"))
+			},
+		},
+		{
+			// Neither another error saying "not found" nor the echo of
+			// the command triggers the fallback.
+			name: "fallbackVersion on other errors",
+			helm: `if [ "$1" = "pull" ]; then
+  case "$*" in
+    *2.0.0*) echo "Error: credentials not found" >&2; exit 1 ;;
+  esac
+fi
+` + fakeHelmPreamble + fakeHelmPullChart,
+			config: strings.Replace(appConfig, "example.com/charts", "example.com/not-found", 1) +
+				"fallbackVersion: 1.0.0\n",
+			err: "credentials not found",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				assert.NoDirExists(t, filepath.Join(th.GetRoot(), "charts", "app-1.0.0"))
+			},
+		},
+		{
+			// The fake 'helm template' checks that the chart was extracted.
+			name: "chartTarballData",
+			helm: `if [ "$1" = "template" ]; then
+  test -f "$3/Chart.yaml" || exit 1
+fi
+` + fakeHelmPreamble,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				tarball := filepath.Join(t.TempDir(), "embedded-1.0.0.tgz")
+				writeChartTarball(t, tarball, map[string]string{
+					"embedded/Chart.yaml":  "apiVersion: v2\nname: embedded\nversion: 1.0.0\n",
+					"embedded/values.yaml": "",
+				})
+				b, err := os.ReadFile(tarball)
+				require.NoError(t, err)
+				th.AssertActualEqualsExpected(th.LoadAndRunGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: embedded
+name: embedded
+releaseName: test
+chartTarballData: `+base64.StdEncoding.EncodeToString(b)+`
+`), renderedTest)
+			},
+		},
+		{
+			name: "invalid chartTarballData",
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: embedded
+name: embedded
+chartTarballData: not-base64!
+`,
+			err: "invalid chartTarballData",
+		},
+		{
+			// The fake helm looks the version up in the cached index,
+			// which it fetches, with the version, only if there is none
+			// in the cache.
+			name: "refreshIndexOnMiss",
+			helm: `cache="$HELM_CACHE_HOME/repository"
+last=""
+for arg in "$@"; do
+  if [ "$last" = "--repository-cache" ]; then
+    cache="$arg"
+  fi
+  last="$arg"
+done
+if [ "$1" = "repo" ]; then
+  echo "Error: no repositories found. You must add one before updating" >&2
+  exit 1
+fi
+if [ "$1" = "pull" ]; then
+  if [ ! -f "$cache/example-index.yaml" ]; then
+    mkdir -p "$cache"
+    echo "app: 2.0.0" > "$cache/example-index.yaml"
+  fi
+  if ! grep -q 2.0.0 "$cache/example-index.yaml"; then
+    echo "Error: chart \"app\" version \"2.0.0\" not found in https://example.com/charts repository" >&2
+    exit 1
+  fi
+fi
+` + fakeHelmPreamble + fakeHelmPullChart,
+			files: map[string]string{
+				"helm/.cache/repository/example-index.yaml": "app: 1.0.0\n",
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				config := appConfig + "configHome: " + filepath.Join(th.GetRoot(), "helm") + "\n"
+				err := th.ErrorFromLoadAndRunGenerator(config)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), `version "2.0.0" not found`)
+
+				th.AssertActualEqualsExpected(
+					th.LoadAndRunGenerator(config+"refreshIndexOnMiss: true\n"), renderedTest)
+				assert.FileExists(t, filepath.Join(th.GetRoot(), "charts", "app-2.0.0", "app", "Chart.yaml"))
+			},
+		},
+		{
+			name: "refreshOnChecksumMismatch",
+			helm: checksumMismatchHelm,
+			files: map[string]string{
+				"helm/.cache/repository/example-index.yaml": "corrupted",
+			},
+			logs: "Warning: checksum mismatch pulling chart 'app', clearing cached repository indexes",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				config := appConfig + "configHome: " + filepath.Join(th.GetRoot(), "helm") + "\n"
+				index := filepath.Join(th.GetRoot(), "helm", ".cache", "repository", "example-index.yaml")
+				err := th.ErrorFromLoadAndRunGenerator(config)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "checksum mismatch")
+				assert.FileExists(t, index)
+
+				th.AssertActualEqualsExpected(
+					th.LoadAndRunGenerator(config+"refreshOnChecksumMismatch: true\n"), renderedTest)
+				assert.NoFileExists(t, index)
+			},
+		},
+		{
+			name:   "symlink within the chart",
+			setup:  writeLinkedTarballs,
+			config: linkedConfig + "chartTarball: inside.tgz\n",
+			check:  generates(1),
+		},
+		{
+			name:   "symlink outside the chart",
+			setup:  writeLinkedTarballs,
+			config: linkedConfig + "chartTarball: escaping.tgz\n",
+			err: "chart tarball entry 'linked/templates/passwd' is a symlink to " +
+				"'../../../../../etc/passwd', outside of the chart",
+		},
+		{
+			name:  "followSymlinks",
+			setup: writeLinkedTarballs,
+			config: linkedConfig + `
+chartTarball: escaping.tgz
+followSymlinks: true
+`,
+			check: generates(1),
+		},
+		{
+			name:   "symlink chain outside the chart",
+			setup:  writeChainedTarballs,
+			config: linkedConfig + "chartTarball: chain.tgz\n",
+			err:    "chart tarball entry 'c' is a symlink to 'a/b/..', outside of the chart",
+		},
+		{
+			name:  "followSymlinks with a symlink chain outside the chart",
+			setup: writeChainedTarballs,
+			config: linkedConfig + `
+chartTarball: chain.tgz
+followSymlinks: true
+`,
+			err: "chart tarball entry 'c/evil' would be written through the symlink 'c'",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				assert.NoFileExists(t, filepath.Join(th.GetRoot(), "evil"))
+			},
+		},
+		{
+			name:   "symlink chain extracted outside the chart",
+			setup:  writeChainedTarballs,
+			config: linkedConfig + "chartTarball: late.tgz\n",
+			err:    "chart tarball symlink 'c' resolves outside of the chart",
+		},
+		{
+			name: "downloader plugin",
+			helm: `if [ "$1" = "pull" ]; then
+  echo "$@ HELM_PLUGINS=$HELM_PLUGINS" > "$root/pulls.log"
+  mkdir -p "$4/app"
+  touch "$4/app/values.yaml"
+  exit 0
+fi
+` + fakeHelmPreamble,
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				th.MkDir("helm-plugins")
+			},
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: s3://charts/app-1.0.0.tgz
+version: 1.0.0
+pluginsHome: helm-plugins
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				assert.Equal(t, "pull --untar --untardir "+filepath.Join(th.GetRoot(), "charts", "app-1.0.0")+
+					" s3://charts/app-1.0.0.tgz HELM_PLUGINS="+
+					filepath.Join(th.GetRoot(), "helm-plugins")+"\n", string(b))
+			},
+		},
+		{
+			name: "cacheMaxBytes",
+			helm: copyTarballHelm("$6"),
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				deps := []string{"common", "util"}
+				var sizes []int64
+				for _, dep := range deps {
+					tarball := filepath.Join(th.GetRoot(), dep+"-1.0.0.tgz")
+					writeChartTarball(t, tarball, map[string]string{
+						dep + "/Chart.yaml": "apiVersion: v2\nname: " + dep + "\nversion: 1.0.0\n",
+					})
+					info, err := os.Stat(tarball)
+					require.NoError(t, err)
+					sizes = append(sizes, info.Size())
+				}
+				// Each chart depends on one of deps, and the cache fits only one.
+				inflate := func(dep string) {
+					t.Helper()
+					chart := filepath.Join(th.GetRoot(), "charts", dep+"-app")
+					require.NoError(t, os.RemoveAll(chart))
+					require.NoError(t, os.MkdirAll(chart, 0755))
+					th.WriteF(filepath.Join(chart, "Chart.yaml"), `
+apiVersion: v2
+name: `+dep+`-app
+version: 1.0.0
+dependencies:
+- name: `+dep+`
+  version: 1.0.0
+  repository: https://example.com/charts
+`)
+					th.WriteF(filepath.Join(chart, "values.yaml"), "")
+					th.LoadAndRunGenerator(fmt.Sprintf(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: %[1]s-app
+name: %[1]s-app
+releaseName: %[1]s
+fetchDependencies: true
+cacheMaxBytes: %[2]d
+`, dep, sizes[0]+sizes[1]-1))
+					assert.FileExists(t, filepath.Join(chart, "charts", dep+"-1.0.0.tgz"))
+				}
+				blobs := func() int {
+					t.Helper()
+					entries, err := os.ReadDir(filepath.Join(th.GetRoot(), "charts", ".dependencies", "sha256"))
+					require.NoError(t, err)
+					return len(entries)
+				}
+
+				inflate("common")
+				inflate("common")
+				assert.Equal(t, 1, blobs())
+				inflate("util")
+				assert.Equal(t, 1, blobs())
+				inflate("util")
+				inflate("common")
+				assert.Equal(t, 1, blobs())
+
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				assert.Equal(t, "common\nutil\ncommon\n", string(b))
+			},
+		},
+		{
+			name: "registryMirror",
+			helm: logPullHelm,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+repo: oci://registry.example.com/charts
+version: 1.0.0
+registryMirror: mirror.example.com/cache/
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				assert.Contains(t, string(b),
+					" oci://mirror.example.com/cache/charts/app --version 1.0.0\n")
+			},
+		},
+		{
+			name:   "cosignVerify without exec",
+			helm:   cosignHelm,
+			setup:  writeCosign,
+			config: cosignConfig + "  key: trusted.pub\n",
+			err:    "cosignVerify requires --enable-exec",
+		},
+		{
+			name: "cosignVerify failing verification",
+			helm: cosignHelm,
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				writeCosign(t, th)
+				th.GetPluginConfig().FnpLoadingOptions.EnableExec = true
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(cosignConfig + "  key: other.pub\n")
+				require.Error(t, err)
+				assert.Contains(t, err.Error(),
+					"cosign failed to verify chart 'mirror.example.com/charts/app:1.0.0': exit status 1")
+				assert.Contains(t, err.Error(),
+					"no matching signatures for mirror.example.com/charts/app:1.0.0")
+				assert.NoDirExists(t, filepath.Join(th.GetRoot(), "charts", "app-1.0.0"))
+				assert.NoFileExists(t, filepath.Join(th.GetRoot(), "pulls.log"))
+			},
+		},
+		{
+			// The verified manifest is pulled by its digest.
+			name: "cosignVerify",
+			helm: cosignHelm,
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				writeCosign(t, th)
+				th.GetPluginConfig().FnpLoadingOptions.EnableExec = true
+			},
+			config: cosignConfig + "  key: trusted.pub\n",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				assert.DirExists(t, filepath.Join(th.GetRoot(), "charts", "app-1.0.0", "app"))
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "pulls.log"))
+				require.NoError(t, err)
+				assert.Equal(t, "oci://mirror.example.com/charts/app@sha256:4f5a\n", string(b))
+			},
+		},
+		{
+			name:     "pinLatest",
+			realHelm: true,
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: workloads
+name: workloads
+releaseName: test
+chartHome: ./charts
+pinLatest: true
+pinnedVersionFile: workloads.version
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				pinned, err := th.GetFSys().ReadFile(filepath.Join(th.GetRoot(), "workloads.version"))
+				require.NoError(t, err)
+				assert.Equal(t, "0.1.0\n", string(pinned))
+			},
+		},
+	})
+}
@@ -0,0 +1,308 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	openapierrors "k8s.io/kube-openapi/pkg/validation/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+// checkValuesSchema validates the values that helm would be given
+// against the chart's values.schema.json, if it has one, so that all
+// violations are reported at once, by JSON pointer, before templating.
+func (p *plugin) checkValuesSchema() error {
+	b, err := os.ReadFile(filepath.Join(p.absChartHome(), p.Name, "values.schema.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WrapPrefixf(err, "unable to read values.schema.json")
+	}
+	var schema spec.Schema
+	if err = json.Unmarshal(b, &schema); err != nil {
+		return errors.WrapPrefixf(err, "could not parse values.schema.json of chart '%s'", p.Name)
+	}
+	values, _, err := p.effectiveValues(false)
+	if err != nil {
+		return err
+	}
+	inliner := schemaInliner{defs: schema.Definitions}
+	if schema, err = inliner.inline(schema, nil); err != nil {
+		return errors.WrapPrefixf(err, "unable to use values.schema.json of chart '%s'", p.Name)
+	}
+	result := validate.NewSchemaValidator(&schema, nil, "", strfmt.Default).Validate(values)
+	if violations := schemaViolations(result, true); len(violations) > 0 {
+		return fmt.Errorf("values of chart '%s' do not conform to values.schema.json:\n  %s",
+			p.Name, strings.Join(violations, "\n  "))
+	}
+	return nil
+}
+
+// runKubeconform validates the inflated resources with kubeconform.
+func (p *plugin) runKubeconform(rm resmap.ResMap) error {
+	b, err := rm.AsYaml()
+	if err != nil {
+		return err
+	}
+	command := p.Kubeconform.Command
+	if command == "" {
+		command = "kubeconform"
+	}
+	out := new(bytes.Buffer)
+	cmd := exec.Command(command, p.Kubeconform.Args()...)
+	cmd.Dir = p.h.Loader().Root()
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err = cmd.Run(); err != nil {
+		return errors.WrapPrefixf(
+			fmt.Errorf("kubeconform failed: %w", err), out.String())
+	}
+	return nil
+}
+
+// Definitions of the OpenAPI schema whose values are commonly
+// written as numbers, though the definition types them as strings.
+const (
+	intOrStringDefinition = "io.k8s.apimachinery.pkg.util.intstr.IntOrString"
+	quantityDefinition    = "io.k8s.apimachinery.pkg.api.resource.Quantity"
+)
+
+// validateOpenAPISchema returns an error listing the schema violations
+// of the inflated resources, validated against the OpenAPISchema.
+func (p *plugin) validateOpenAPISchema(rm resmap.ResMap) error {
+	b, err := p.h.Loader().Load(p.OpenAPISchema)
+	if err != nil {
+		return errors.WrapPrefixf(err, "could not load openAPISchema")
+	}
+	var swagger spec.Swagger
+	if err = json.Unmarshal(b, &swagger); err != nil {
+		return errors.WrapPrefixf(err, "could not parse openAPISchema")
+	}
+	byGvk := map[resid.Gvk]string{}
+	for name, def := range swagger.Definitions {
+		var gvks []resid.Gvk
+		if err = def.Extensions.GetObject(
+			"x-kubernetes-group-version-kind", &gvks); err != nil {
+			return errors.WrapPrefixf(err, "invalid definition '%s' in openAPISchema", name)
+		}
+		for _, gvk := range gvks {
+			byGvk[gvk] = name
+		}
+	}
+	inliner := schemaInliner{defs: swagger.Definitions, kubernetes: true}
+	validators := map[string]*validate.SchemaValidator{}
+	var violations []string
+	for _, r := range rm.Resources() {
+		name, found := byGvk[r.GetGvk()]
+		if !found {
+			continue
+		}
+		sv, found := validators[name]
+		if !found {
+			s, err := inliner.inline(*spec.RefSchema("#/definitions/" + name), nil)
+			if err != nil {
+				return errors.WrapPrefixf(err, "invalid definition '%s' in openAPISchema", name)
+			}
+			sv = validate.NewSchemaValidator(&s, nil, "", strfmt.Default)
+			validators[name] = sv
+		}
+		m, err := r.Map()
+		if err != nil {
+			return err
+		}
+		for _, v := range schemaViolations(sv.Validate(m), false) {
+			violations = append(violations, describe(r)+": "+v)
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("resources do not conform to openAPISchema '%s':\n  %s",
+			p.OpenAPISchema, strings.Join(violations, "\n  "))
+	}
+	return nil
+}
+
+// schemaInliner prepares OpenAPI, or JSON, schemas for validation
+// by kube-openapi, which does not follow '$ref's.
+type schemaInliner struct {
+	// defs are the definitions that '$ref's point to,
+	// keyed by the name following '#/definitions/'.
+	defs spec.Definitions
+
+	// kubernetes adapts the schemas to how the API server
+	// validates resources: fields the schema does not declare are
+	// rejected, nulls are accepted, and int-or-string and quantity
+	// fields accept numbers as well as strings.
+	kubernetes bool
+}
+
+// unsupportedSchemaKeywords are the JSON schema keywords that
+// kube-openapi ignores, so that schemas using them are rejected
+// rather than silently passing invalid values.
+var unsupportedSchemaKeywords = []string{ //nolint:gochecknoglobals
+	"const", "contains", "dependentRequired", "dependentSchemas",
+	"else", "if", "maxContains", "minContains", "prefixItems",
+	"propertyNames", "then", "unevaluatedItems", "unevaluatedProperties",
+}
+
+// inline returns a copy of the schema with the '$ref's replaced by
+// the definitions they point to.  A '$ref' to a definition that is
+// being inlined already, i.e. a recursive one, is replaced by an
+// empty schema, accepting any value.  stack holds the definitions
+// being inlined.
+func (si schemaInliner) inline(s spec.Schema, stack []string) (spec.Schema, error) {
+	if ref := s.Ref.String(); ref != "" {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		def, found := si.defs[name]
+		if !found || name == ref {
+			return s, fmt.Errorf("unsupported $ref '%s'", ref)
+		}
+		for _, n := range stack {
+			if n == name {
+				return spec.Schema{}, nil
+			}
+		}
+		if si.kubernetes && name == intOrStringDefinition {
+			def.Type, def.Format = spec.StringOrArray{"integer", "string"}, ""
+		}
+		if si.kubernetes && name == quantityDefinition {
+			def.Type, def.Format = spec.StringOrArray{"number", "string"}, ""
+		}
+		return si.inline(def, append(stack, name))
+	}
+	for _, k := range unsupportedSchemaKeywords {
+		if _, found := s.ExtraProps[k]; found {
+			return s, fmt.Errorf("unsupported keyword '%s'", k)
+		}
+	}
+	if si.kubernetes {
+		s.Nullable = true
+		if s.Format == "int-or-string" {
+			s.Type, s.Format = spec.StringOrArray{"integer", "string"}, ""
+		}
+		preserve, _ := s.Extensions.GetBool("x-kubernetes-preserve-unknown-fields")
+		if len(s.Properties) > 0 && s.AdditionalProperties == nil && !preserve {
+			s.AdditionalProperties = &spec.SchemaOrBool{Allows: false}
+		}
+	}
+	var err error
+	each := func(schemas []spec.Schema) []spec.Schema {
+		result := make([]spec.Schema, len(schemas))
+		for i := range schemas {
+			if err == nil {
+				result[i], err = si.inline(schemas[i], stack)
+			}
+		}
+		return result
+	}
+	eachOf := func(schemas map[string]spec.Schema) map[string]spec.Schema {
+		result := make(map[string]spec.Schema, len(schemas))
+		for k, v := range schemas {
+			if err == nil {
+				result[k], err = si.inline(v, stack)
+			}
+		}
+		return result
+	}
+	one := func(schema *spec.Schema) *spec.Schema {
+		if schema == nil || err != nil {
+			return schema
+		}
+		var result spec.Schema
+		result, err = si.inline(*schema, stack)
+		return &result
+	}
+	s.Definitions = nil
+	s.AllOf, s.AnyOf, s.OneOf = each(s.AllOf), each(s.AnyOf), each(s.OneOf)
+	s.Not = one(s.Not)
+	s.Properties = eachOf(s.Properties)
+	s.PatternProperties = eachOf(s.PatternProperties)
+	if s.AdditionalProperties != nil {
+		s.AdditionalProperties = &spec.SchemaOrBool{
+			Allows: s.AdditionalProperties.Allows,
+			Schema: one(s.AdditionalProperties.Schema),
+		}
+	}
+	if s.AdditionalItems != nil {
+		s.AdditionalItems = &spec.SchemaOrBool{
+			Allows: s.AdditionalItems.Allows,
+			Schema: one(s.AdditionalItems.Schema),
+		}
+	}
+	if s.Items != nil {
+		s.Items = &spec.SchemaOrArray{
+			Schema:  one(s.Items.Schema),
+			Schemas: each(s.Items.Schemas),
+		}
+	}
+	if len(s.Dependencies) > 0 {
+		deps := make(spec.Dependencies, len(s.Dependencies))
+		for k, v := range s.Dependencies {
+			deps[k] = spec.SchemaOrStringArray{Schema: one(v.Schema), Property: v.Property}
+		}
+		s.Dependencies = deps
+	}
+	return s, err
+}
+
+// schemaViolations returns the sorted violations in the result of
+// a validation, located by JSON pointer, e.g. '/a/0/b', if pointers,
+// and by field path, e.g. 'a[0].b', otherwise.
+func schemaViolations(result *validate.Result, pointers bool) []string {
+	var violations []string
+	var add func(errs []error)
+	add = func(errs []error) {
+		for _, err := range errs {
+			switch e := err.(type) {
+			case *openapierrors.CompositeError:
+				add(e.Errors)
+			case *openapierrors.Validation:
+				name := e.Name
+				message := strings.TrimPrefix(
+					strings.Replace(e.Error(), " in "+e.In+" ", " ", 1), name)
+				if e.Code() == openapierrors.UnallowedPropertyCode {
+					name = strings.TrimPrefix(name+"."+fmt.Sprint(e.Value), ".")
+					message = " is a forbidden property"
+				}
+				violations = append(violations, schemaPath(name, pointers)+message)
+			default:
+				violations = append(violations, err.Error())
+			}
+		}
+	}
+	add(result.Errors)
+	sort.Strings(violations)
+	return violations
+}
+
+// schemaIndexRe matches the indices in the field paths of
+// kube-openapi, e.g. the '[0]' of 'a[0].b'.
+var schemaIndexRe = regexp.MustCompile(`\[(\d+)\]`) //nolint:gochecknoglobals
+
+// schemaPath converts a field path of kube-openapi, e.g. 'a[0].b',
+// to a JSON pointer, e.g. '/a/0/b', if pointer.
+func schemaPath(name string, pointer bool) string {
+	if name == "" {
+		return "(root)"
+	}
+	if !pointer {
+		return name
+	}
+	return "/" + strings.ReplaceAll(schemaIndexRe.ReplaceAllString(name, ".$1"), ".", "/")
+}
@@ -0,0 +1,303 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/resmap"
+	kusttest_test "sigs.k8s.io/kustomize/api/testutils/kusttest"
+)
+
+func TestHelmChartInflationGeneratorSchemas(t *testing.T) {
+	// The fake kubeconform rejects Secrets.
+	writeKubeconform := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		th.WriteF(filepath.Join(th.GetRoot(), "kubeconform"), `#!/bin/sh
+[ "$1 $2 $3" = "-summary -schema-location default" ] || exit 2
+if grep -q "kind: Secret" -; then
+  echo "stdin - Secret test is invalid: problem validating schema"
+  exit 1
+fi
+echo "Summary: 1 resource found parsing stdin - Valid: 1, Invalid: 0"
+`)
+		require.NoError(t, os.Chmod(filepath.Join(th.GetRoot(), "kubeconform"), 0755))
+	}
+	enableExec := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		writeKubeconform(t, th)
+		th.GetPluginConfig().FnpLoadingOptions.EnableExec = true
+	}
+	kubeconformConfig := testChartConfig + `
+kubeconform:
+  command: ./kubeconform
+  schemaLocations:
+  - default
+`
+	valuesSchemaChart := map[string]string{
+		"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 1.0.0
+`,
+		"charts/app/values.yaml": `
+replicas: 1
+ports:
+- name: http
+  port: 80
+`,
+		"charts/app/values.schema.json": `{
+  "type": "object",
+  "definitions": {
+    "version": {"type": "string", "pattern": "^v[0-9]+$"}
+  },
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "mode": {"enum": [1, true]},
+    "image": {
+      "anyOf": [
+        {"type": "string"},
+        {"type": "object", "properties": {"tag": {"$ref": "#/definitions/version"}}}
+      ]
+    },
+    "ports": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "port": {"type": "integer"}
+        }
+      }
+    }
+  }
+}`,
+		"charts/app/templates/cm.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  replicas: {{ .Values.replicas | quote }}
+`,
+	}
+	valuesSchemaConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+releaseName: test
+chartHome: ./charts
+validateValuesSchema: true
+`
+
+	runGeneratorCases(t, []generatorCase{
+		{
+			name:   "kubeconform without exec",
+			setup:  writeKubeconform,
+			config: kubeconformConfig,
+			err:    "kubeconform requires --enable-exec",
+		},
+		{
+			name:   "kubeconform",
+			setup:  enableExec,
+			config: kubeconformConfig,
+			expected: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`,
+		},
+		{
+			name:  "kubeconform rejecting resources",
+			setup: enableExec,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(kubeconformConfig + `
+postCommands:
+- [sed, "s/kind: ConfigMap/kind: Secret/"]
+`)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "kubeconform failed: exit status 1")
+				assert.Contains(t, err.Error(), "Secret test is invalid")
+			},
+		},
+		{
+			name: "openAPISchema",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: good
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: bad
+  labels:
+  - app
+dat:
+  key: value
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: good
+spec:
+  ports:
+  - name: http
+    port: 80
+    targetPort: http
+  - name: metrics
+    port: 9090
+    targetPort: 9090
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: bad
+spec:
+  ports:
+  - name: Not_A_Name
+    port: 70000
+    targetPort: true
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: unknown
+`),
+			files: map[string]string{
+				"openapi.json": `{
+  "swagger": "2.0",
+  "info": {"title": "Kubernetes", "version": "v1.28.0"},
+  "paths": {},
+  "definitions": {
+    "io.k8s.api.core.v1.ConfigMap": {
+      "type": "object",
+      "required": ["metadata"],
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "data": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "kind": "ConfigMap", "version": "v1"}]
+    },
+    "io.k8s.api.core.v1.Service": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.core.v1.ServiceSpec"}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "kind": "Service", "version": "v1"}]
+    },
+    "io.k8s.api.core.v1.ServiceSpec": {
+      "type": "object",
+      "properties": {
+        "ports": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.ServicePort"}}
+      }
+    },
+    "io.k8s.api.core.v1.ServicePort": {
+      "type": "object",
+      "required": ["port"],
+      "properties": {
+        "name": {"type": "string", "pattern": "^[a-z0-9-]+$"},
+        "port": {"type": "integer", "format": "int32", "minimum": 1, "maximum": 65535},
+        "targetPort": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.util.intstr.IntOrString"}
+      }
+    },
+    "io.k8s.apimachinery.pkg.util.intstr.IntOrString": {
+      "type": "string",
+      "format": "int-or-string"
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    }
+  }
+}`,
+			},
+			config: testChartConfig + "openAPISchema: openapi.json\n",
+			err: `resources do not conform to openAPISchema 'openapi.json':
+  ConfigMap bad: dat is a forbidden property
+  ConfigMap bad: metadata.labels must be of type object: "array"
+  Service bad: spec.ports[0].name should match '^[a-z0-9-]+$'
+  Service bad: spec.ports[0].port should be less than or equal to 65535
+  Service bad: spec.ports[0].targetPort must be of type integer,string: "boolean"`,
+			errExcludes: []string{"good", "Widget"},
+		},
+		{
+			name:  "validateValuesSchema with values of the wrong type",
+			files: valuesSchemaChart,
+			config: valuesSchemaConfig + `
+valuesInline:
+  replicas: three
+  ports:
+  - name: http
+    port: "80"
+`,
+			err: "values of chart 'app' do not conform to values.schema.json:\n" +
+				"  /ports/0/port must be of type integer: \"string\"\n" +
+				"  /replicas must be of type integer: \"string\"",
+		},
+		{
+			// Enums compare values with their types, and the keywords
+			// beyond types, such as minimum, pattern and anyOf, apply.
+			name:  "validateValuesSchema with values out of range",
+			files: valuesSchemaChart,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(valuesSchemaConfig + `
+valuesInline:
+  replicas: 0
+  mode: "1"
+  image:
+    tag: latest
+`)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "/replicas should be greater than or equal to 1")
+				assert.Contains(t, err.Error(), "/mode should be one of [1 true]")
+				assert.Contains(t, err.Error(), "/image/tag should match '^v[0-9]+$'")
+			},
+		},
+		{
+			name:  "validateValuesSchema",
+			files: valuesSchemaChart,
+			config: valuesSchemaConfig + `
+valuesInline:
+  replicas: 3
+  mode: true
+  image:
+    tag: v2
+`,
+			check: generates(1),
+		},
+		{
+			// Keywords the validator doesn't support fail the build,
+			// rather than pass values that helm would reject.
+			name:  "validateValuesSchema with unsupported keywords",
+			files: valuesSchemaChart,
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				th.WriteF(filepath.Join(th.GetRoot(), "charts", "app", "values.schema.json"), `{
+  "type": "object",
+  "properties": {"replicas": {"const": 1}}
+}`)
+			},
+			config: valuesSchemaConfig,
+			err:    "unable to use values.schema.json of chart 'app': unsupported keyword 'const'",
+		},
+	})
+}
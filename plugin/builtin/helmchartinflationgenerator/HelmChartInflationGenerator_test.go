@@ -4,13 +4,22 @@
 package main_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
 	kusttest_test "sigs.k8s.io/kustomize/api/testutils/kusttest"
 	"sigs.k8s.io/kustomize/kyaml/copyutil"
 )
@@ -169,8 +178,6 @@ spec:
       secretReference:
         name: moria-git-webhook-secret
     type: generic
-status:
-  lastVersion: 0
 `)
 }
 
@@ -191,7 +198,6 @@ type: Opaque
 apiVersion: v1
 kind: Service
 metadata:
-  annotations: {}
   labels:
     app: moria-minecraft
     chart: minecraft-3.1.3
@@ -211,7 +217,6 @@ spec:
 apiVersion: v1
 kind: Service
 metadata:
-  annotations: {}
   labels:
     app: moria-minecraft
     chart: minecraft-3.1.3
@@ -959,3 +964,848 @@ chartHome: ./charts
 	assert.Contains(t, string(chartYamlContent), "name: test-chart")
 	assert.Contains(t, string(chartYamlContent), "version: 1.0.0")
 }
+
+func findResource(
+	t *testing.T, rm resmap.ResMap, kind, name string) *resource.Resource {
+	t.Helper()
+	for _, r := range rm.Resources() {
+		if r.GetKind() == kind && r.GetName() == name {
+			return r
+		}
+	}
+	t.Fatalf("%s %s not found", kind, name)
+	return nil
+}
+
+// writeFakeHelm writes a shell script standing in for helm into the
+// harness root, and configures the harness to run it instead of helm.
+// The script may refer to the harness root as $root.
+func writeFakeHelm(t *testing.T, th *kusttest_test.HarnessEnhanced, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping: fake helm requires a POSIX shell")
+	}
+	path := filepath.Join(th.GetRoot(), "fake-helm")
+	script = fmt.Sprintf("#!/bin/sh\nroot='%s'\n%s", th.GetRoot(), script)
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755)) //nolint:gosec
+	th.GetPluginConfig().HelmConfig.Command = path
+}
+
+// testChartConfig configures the plugin to inflate the test chart
+// copied into the harness by copyTestChartsIntoHarness.
+const testChartConfig = `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+releaseName: test
+chartHome: ./charts
+`
+
+// generatorCase is a case of the table-driven tests of the plugin.
+type generatorCase struct {
+	name string
+	// realHelm runs the case with helm, rather than with a fake, and
+	// skips it if there is no helm.
+	realHelm bool
+	// helm is the fake helm script.  Defaults to fakeHelmPreamble.
+	helm string
+	// files are written to the harness root, keyed by their path
+	// relative to it, before the plugin runs.
+	files map[string]string
+	// setup prepares the harness further before the plugin runs.
+	setup func(t *testing.T, th *kusttest_test.HarnessEnhanced)
+	// config configures the plugin.  If empty, the plugin isn't run,
+	// and is left to check.
+	config string
+	// expected are the resources the plugin should generate.
+	expected string
+	// err is part of the error the plugin should fail with, and
+	// errExcludes are parts it shouldn't have.
+	err         string
+	errExcludes []string
+	// logs is part of what the plugin, including runs of it by
+	// check, should log.
+	logs string
+	// check makes further assertions on the harness and on the
+	// generated resources.
+	check func(t *testing.T, th *kusttest_test.HarnessEnhanced, rm resmap.ResMap)
+}
+
+// runGeneratorCases runs each case against a harness of its own,
+// holding the test charts.
+func runGeneratorCases(t *testing.T, cases []generatorCase) {
+	t.Helper()
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			th := kusttest_test.MakeEnhancedHarnessWithTmpRoot(t).
+				PrepBuiltin("HelmChartInflationGenerator")
+			defer th.Reset()
+			if tc.realHelm {
+				if err := th.ErrIfNoHelm(); err != nil {
+					t.Skip("skipping: " + err.Error())
+				}
+			}
+
+			copyTestChartsIntoHarness(t, th)
+			if !tc.realHelm {
+				helm := tc.helm
+				if helm == "" {
+					helm = fakeHelmPreamble
+				}
+				writeFakeHelm(t, th, helm)
+			}
+			paths := make([]string, 0, len(tc.files))
+			for path := range tc.files {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				abs := filepath.Join(th.GetRoot(), path)
+				require.NoError(t, os.MkdirAll(filepath.Dir(abs), 0755))
+				th.WriteF(abs, tc.files[path])
+			}
+			if tc.setup != nil {
+				tc.setup(t, th)
+			}
+
+			var logs bytes.Buffer
+			if tc.logs != "" {
+				log.SetOutput(&logs)
+				defer log.SetOutput(os.Stderr)
+			}
+			var rm resmap.ResMap
+			switch {
+			case tc.config == "":
+			case tc.err != "":
+				err := th.ErrorFromLoadAndRunGenerator(tc.config)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				for _, excluded := range tc.errExcludes {
+					assert.NotContains(t, err.Error(), excluded)
+				}
+			default:
+				rm = th.LoadAndRunGenerator(tc.config)
+				if tc.expected != "" {
+					th.AssertActualEqualsExpected(rm, tc.expected)
+				}
+			}
+			if tc.check != nil {
+				tc.check(t, th, rm)
+			}
+			if tc.logs != "" {
+				assert.Contains(t, logs.String(), tc.logs)
+			}
+		})
+	}
+}
+
+// generates returns a check that the plugin generated n resources.
+func generates(n int) func(*testing.T, *kusttest_test.HarnessEnhanced, resmap.ResMap) {
+	return func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+		t.Helper()
+		assert.Equal(t, n, rm.Size())
+	}
+}
+
+// fakeHelmPreamble handles 'helm version' and 'helm template', the
+// latter rendering a single ConfigMap named after the release.  For
+// other commands, it sets $untardir and $chart from the arguments of
+// 'helm pull --untardir {untardir} --repo {repo} {chart}'.
+const fakeHelmPreamble = `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "v3.13.1+g3547a4b"
+  exit 0
+fi
+if [ "$1" = "template" ]; then
+  printf 'apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n' "$2"
+  exit 0
+fi
+untardir=""
+chart=""
+prev=""
+for arg in "$@"; do
+  case "$prev" in
+    --untardir) untardir="$arg" ;;
+    --repo) prev="$arg"; continue ;;
+  esac
+  case "$prev" in
+    http*) chart="$arg" ;;
+  esac
+  prev="$arg"
+done
+`
+
+// fakeHelmRendering returns a fake helm script for which
+// 'helm template' renders the given resources, a YAML stream
+// starting and ending with a newline.
+func fakeHelmRendering(resources string) string {
+	return `if [ "$1" = "template" ]; then
+  cat <<YAML` + resources + `YAML
+  exit 0
+fi
+` + fakeHelmPreamble
+}
+
+// fakeHelmPullChart creates the chart in the pull destination.
+const fakeHelmPullChart = `
+mkdir -p "$untardir/$chart"
+echo "name: $chart" > "$untardir/$chart/Chart.yaml"
+touch "$untardir/$chart/values.yaml"
+`
+
+// writeChartTarball writes a gzipped chart tarball holding the given
+// files, keyed by their path in the tarball.
+func writeChartTarball(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	writeChartTarballWithSymlinks(t, path, files, nil)
+}
+
+// writeChartTarballWithSymlinks writes a chart tarball holding the
+// files, and the symlinks mapped to their targets.
+func writeChartTarballWithSymlinks(
+	t *testing.T, path string, files map[string]string, symlinks map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: name, Mode: 0644, Size: int64(len(files[name])),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	for name, target := range symlinks {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: name, Linkname: target, Mode: 0777, Typeflag: tar.TypeSymlink,
+		}))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644)) //nolint:gosec
+}
+
+func TestHelmChartInflationGeneratorOptions(t *testing.T) {
+	enableExec := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		th.GetPluginConfig().FnpLoadingOptions.EnableExec = true
+	}
+	postCommandsConfig := testChartConfig + `
+postCommands:
+- [sed, "s/name: test/name: transformed/"]
+- [sed, "s/kind: ConfigMap/kind: Secret/"]
+`
+	// Two subcharts render the 'shared' ConfigMap; for the 'conflict'
+	// release they disagree on the value of 'a'.
+	mergeConfigMapsHelm := `#!/bin/sh
+if [ "$1" = "template" ]; then
+  second=1
+  [ "$2" = "conflict" ] && second=2
+  cat <<YAML
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+data:
+  a: "1"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: shared
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+data:
+  a: "$second"
+  b: "2"
+YAML
+  exit 0
+fi
+` + fakeHelmPreamble + fakeHelmPullChart
+	mergeConfigMapsConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: umbrella
+name: umbrella
+repo: https://example.com/charts
+releaseName: %s
+mergeConfigMaps: true
+`
+	// The chart splits the 'web' Deployment across two documents.
+	duplicateResourcesHelm := fakeHelmRendering(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web
+`)
+	duplicateResourcesConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+chartHome: ./charts
+duplicateResources: %s
+`
+	lookupModeConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+chartHome: ./charts
+lookupMode: cluster
+`
+	kubeconfig := map[string]string{
+		"kubeconfig": "apiVersion: v1\nkind: Config\n",
+	}
+	writeHelmBins := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		for _, bin := range []string{"helm-a", "helm-b"} {
+			require.NoError(t, os.WriteFile( //nolint:gosec
+				filepath.Join(th.GetRoot(), bin),
+				[]byte(strings.ReplaceAll(fakeHelmPreamble, "name: %s", "name: "+bin)), 0755))
+		}
+	}
+	helmBinConfig := testChartConfig + "helmBin: ./%s\n"
+	releaseNamePatternConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+chartHome: ./charts
+releaseNamePattern: ^[a-z0-9]([-a-z0-9]*[a-z0-9])?$
+releaseName: %s
+`
+	appConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+releaseName: test
+chartHome: ./charts
+`
+	deprecatedChart := map[string]string{
+		"charts/app/values.yaml": "",
+		"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 1.2.0
+deprecated: true
+`,
+	}
+	legacyChart := map[string]string{
+		"charts/legacy/Chart.yaml":  "apiVersion: v1\nname: legacy\nversion: 0.1.0\n",
+		"charts/legacy/values.yaml": "",
+		"charts/legacy/requirements.yaml": `
+dependencies:
+- name: common
+  version: 0.1.0
+  repository: https://example.com/charts
+`,
+		"charts/legacy/templates/cm.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: legacy
+data:
+  deployed: {{ .Release.Time.Seconds | quote }}
+`,
+	}
+	legacyConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: legacy
+name: legacy
+releaseName: test
+chartHome: ./charts
+`
+	appVersionChart := map[string]string{
+		"charts/app/values.yaml": "",
+		"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 1.2.0
+appVersion: 4.1.0
+`,
+	}
+	parseErrorHelm := `#!/bin/sh
+if [ "$1" = "template" ]; then
+  printf 'apiVersion: v1\nkind: ConfigMap\nmetadata: [name\n'
+  exit 0
+fi
+` + fakeHelmPreamble
+	parseErrorConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: test-chart
+releaseName: test
+chartHome: ./charts
+`
+	revisionChart := map[string]string{
+		"charts/app/values.yaml": "",
+		"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 1.0.0
+`,
+		"charts/app/templates/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  revision: "{{ .Release.Revision }}"
+  upgrade: "{{ gt (int $.Release.Revision) 1 }}"
+`,
+	}
+	// Renders the templates of the chart helm is given the way helm
+	// would, for the literal revision too.
+	revisionHelm := `#!/bin/sh
+if [ "$1" = "template" ]; then
+  sed -e 's/{{ \.Release\.Revision }}/1/' \
+    -e 's/{{ gt (int \$\.Release\.Revision) 1 }}/false/' \
+    -e 's/{{ \([0-9]*\) }}/\1/' \
+    -e 's/{{ gt (int [01]) 1 }}/false/' \
+    -e 's/{{ gt (int [0-9]*) 1 }}/true/' "$3/templates/cm.yaml"
+  exit 0
+fi
+` + fakeHelmPreamble
+	firstRevision := `
+apiVersion: v1
+data:
+  revision: "1"
+  upgrade: "false"
+kind: ConfigMap
+metadata:
+  name: app
+`
+
+	runGeneratorCases(t, []generatorCase{
+		{
+			name: "helm version with a wrapper banner",
+			helm: `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "helm-wrapper 2.0.1 (corp edition)"
+  echo "using cached credentials"
+  echo "v3.13.1+g3547a4b"
+  exit 0
+fi
+` + fakeHelmPreamble,
+			config: testChartConfig,
+			expected: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`,
+		},
+		{
+			name:   "postCommands without exec",
+			config: postCommandsConfig,
+			err:    "postCommands requires --enable-exec",
+		},
+		{
+			name:   "postCommands",
+			setup:  enableExec,
+			config: postCommandsConfig,
+			expected: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: transformed
+`,
+		},
+		{
+			name:  "postCommands failing",
+			setup: enableExec,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(postCommandsConfig +
+					"- [sh, -c, \"echo boom >&2; exit 3\"]\n")
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "boom")
+				assert.Contains(t, err.Error(), "exit status 3")
+			},
+		},
+		{
+			name:   "mergeConfigMaps",
+			helm:   mergeConfigMapsHelm,
+			config: fmt.Sprintf(mergeConfigMapsConfig, "compatible"),
+			expected: `
+apiVersion: v1
+data:
+  a: "1"
+  b: "2"
+kind: ConfigMap
+metadata:
+  name: shared
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: shared
+`,
+		},
+		{
+			name:   "mergeConfigMaps with conflicting values",
+			helm:   mergeConfigMapsHelm,
+			config: fmt.Sprintf(mergeConfigMapsConfig, "conflict"),
+			err:    "conflicting values for key 'a' in ConfigMap 'shared'",
+		},
+		{
+			name:   "duplicateResources merge",
+			helm:   duplicateResourcesHelm,
+			config: fmt.Sprintf(duplicateResourcesConfig, "merge"),
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app: web
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - image: web
+        name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`,
+		},
+		{
+			name:   "duplicateResources error",
+			helm:   duplicateResourcesHelm,
+			config: fmt.Sprintf(duplicateResourcesConfig, "error"),
+			err:    "helm rendered Deployment web in more than one document",
+		},
+		{
+			name:   "duplicateResources unknown",
+			helm:   duplicateResourcesHelm,
+			config: fmt.Sprintf(duplicateResourcesConfig, "ignore"),
+			err:    "duplicateResources must be one of [error merge]",
+		},
+		{
+			name: "lookupMode cluster",
+			helm: `[ "$1" = "template" ] && echo "KUBECONFIG=$KUBECONFIG $*" > "$root/templates.log"
+` + fakeHelmPreamble,
+			files:  kubeconfig,
+			config: lookupModeConfig + "releaseName: test\nkubeconfig: kubeconfig\n",
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "templates.log"))
+				require.NoError(t, err)
+				assert.Contains(t, string(b),
+					"KUBECONFIG="+filepath.Join(th.GetRoot(), "kubeconfig")+" template")
+				assert.Contains(t, string(b), "--dry-run=server")
+			},
+		},
+		{
+			name:   "lookupMode cluster without kubeconfig",
+			config: lookupModeConfig,
+			err:    "lookupMode 'cluster' requires kubeconfig",
+		},
+		{
+			name: "lookupMode cluster with an old helm",
+			helm: `[ "$1" = "version" ] && echo "v3.12.3+g3a31588" && exit 0
+` + fakeHelmPreamble,
+			files:  kubeconfig,
+			config: lookupModeConfig + "kubeconfig: kubeconfig\n",
+			err: "lookupMode 'cluster' requires helm v3.13 or newer, " +
+				"for --dry-run=server, but got v3.12.3",
+		},
+		{
+			name: "annotationsFile",
+			files: map[string]string{
+				"annotations.yaml": `
+team: platform
+owner: from-file
+`,
+			},
+			config: testChartConfig + `
+annotationsFile: annotations.yaml
+commonAnnotations:
+  owner: inline
+`,
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				annotations := rm.Resources()[0].GetAnnotations()
+				assert.Equal(t, "platform", annotations["team"])
+				assert.Equal(t, "inline", annotations["owner"])
+			},
+		},
+		{
+			name: "annotationsFile missing",
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: test-chart
+name: test-chart
+chartHome: ./charts
+annotationsFile: missing.yaml
+`,
+			err: "could not load annotationsFile",
+		},
+		{
+			name: "helmBin without exec",
+			helm: `echo "global helm must not run" >&2
+exit 1
+`,
+			setup:  writeHelmBins,
+			config: fmt.Sprintf(helmBinConfig, "helm-a"),
+			err:    "helmBin requires --enable-exec",
+		},
+		{
+			name: "helmBin",
+			helm: `echo "global helm must not run" >&2
+exit 1
+`,
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				t.Helper()
+				writeHelmBins(t, th)
+				enableExec(t, th)
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				for _, bin := range []string{"helm-a", "helm-b"} {
+					rm := th.LoadAndRunGenerator(fmt.Sprintf(helmBinConfig, bin))
+					assert.Equal(t, bin, rm.Resources()[0].GetName())
+				}
+			},
+		},
+		{
+			name:   "releaseNamePattern",
+			config: fmt.Sprintf(releaseNamePatternConfig, "my-release"),
+			check: func(t *testing.T, _ *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				assert.Equal(t, "my-release", rm.Resources()[0].GetName())
+			},
+		},
+		{
+			name:   "releaseNamePattern mismatch",
+			config: fmt.Sprintf(releaseNamePatternConfig, "My_Release"),
+			err: "releaseName 'My_Release' does not match " +
+				"releaseNamePattern '^[a-z0-9]([-a-z0-9]*[a-z0-9])?$'",
+		},
+		{
+			// The '$' of sed doesn't match before a CR.
+			name: "normalizeLineEndings",
+			helm: `if [ "$1" = "template" ]; then
+  printf 'apiVersion: v1\r\nkind: ConfigMap\r\nmetadata:\r\n  name: first\r\n'
+  printf 'data:\r\n  mode: debug\r\n  script: |\r\n    echo one\r\n    echo two\r\n---\r\n'
+  printf 'apiVersion: v1\r\nkind: ConfigMap\r\nmetadata:\r\n  name: second\r\n'
+  exit 0
+fi
+` + fakeHelmPreamble,
+			setup: enableExec,
+			config: testChartConfig + `
+normalizeLineEndings: true
+postCommands:
+- [sed, "s/: debug$/: release/"]
+`,
+			expected: `
+apiVersion: v1
+data:
+  mode: release
+  script: |
+    echo one
+    echo two
+kind: ConfigMap
+metadata:
+  name: first
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+`,
+		},
+		{
+			name: "List output",
+			helm: fakeHelmRendering(`
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: settings
+  data:
+    a: "1"
+- apiVersion: v1
+  kind: ConfigMapList
+  items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: settings
+    data:
+      b: "2"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`),
+			config: testChartConfig + "mergeConfigMaps: true\n",
+			expected: `
+apiVersion: v1
+data:
+  a: "1"
+  b: "2"
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`,
+		},
+		{
+			name:   "failOnDeprecatedChart error",
+			files:  deprecatedChart,
+			config: appConfig + "failOnDeprecatedChart: error\n",
+			err:    "found deprecated charts: chart 'app' version '1.2.0' is deprecated",
+		},
+		{
+			name:   "failOnDeprecatedChart warn",
+			files:  deprecatedChart,
+			config: appConfig + "failOnDeprecatedChart: warn\n",
+		},
+		{
+			name:   "failOnDeprecatedChart unknown",
+			files:  deprecatedChart,
+			config: appConfig + "failOnDeprecatedChart: fail\n",
+			err:    "failOnDeprecatedChart",
+		},
+		{
+			name:   "compatV2 warn of requirements.yaml",
+			files:  legacyChart,
+			config: legacyConfig + "compatV2: warn\n",
+			logs: "Warning: chart 'legacy' declares its dependencies " +
+				"in requirements.yaml; move them to Chart.yaml and set apiVersion: v2",
+		},
+		{
+			name:   "compatV2 warn of .Release.Time",
+			files:  legacyChart,
+			config: legacyConfig + "compatV2: warn\n",
+			logs: "Warning: template 'templates/cm.yaml' uses " +
+				".Release.Time, which helm 3 removed; use 'now' instead",
+		},
+		{
+			name:   "compatV2 error",
+			files:  legacyChart,
+			config: legacyConfig + "compatV2: error\n",
+			err:    "found helm v2 constructs: ",
+		},
+		{
+			name:   "expectedAppVersion",
+			files:  appVersionChart,
+			config: appConfig + "expectedAppVersion: 4.1.0\n",
+		},
+		{
+			name:   "expectedAppVersion mismatch",
+			files:  appVersionChart,
+			config: appConfig + "expectedAppVersion: 4.2.0\n",
+			err:    "chart 'app' version '1.2.0' has appVersion '4.1.0', expected '4.2.0'",
+		},
+		{
+			name:   "unparsable rendering",
+			helm:   parseErrorHelm,
+			config: parseErrorConfig,
+			err: "unable to parse the 47 bytes rendered " +
+				"from chart 'test-chart' (set rawOutputPath to inspect it): ",
+		},
+		{
+			name:   "unparsable rendering with rawOutputPath",
+			helm:   parseErrorHelm,
+			config: parseErrorConfig + "rawOutputPath: raw.yaml\n",
+			err: "unable to parse the 47 bytes rendered " +
+				"from chart 'test-chart' (see 'raw.yaml'): ",
+		},
+		{
+			name:     "releaseRevision unset",
+			helm:     revisionHelm,
+			files:    revisionChart,
+			config:   appConfig,
+			expected: firstRevision,
+		},
+		{
+			name:   "releaseRevision",
+			helm:   revisionHelm,
+			files:  revisionChart,
+			config: appConfig + "releaseRevision: 3\n",
+			expected: `
+apiVersion: v1
+data:
+  revision: "3"
+  upgrade: "true"
+kind: ConfigMap
+metadata:
+  name: app
+`,
+			// The chart itself is left alone.
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "charts", "app", "templates", "cm.yaml"))
+				require.NoError(t, err)
+				assert.Contains(t, string(b), "{{ .Release.Revision }}")
+			},
+		},
+		{
+			// Zero leaves the revision to helm.
+			name:     "releaseRevision zero",
+			helm:     revisionHelm,
+			files:    revisionChart,
+			config:   appConfig + "releaseRevision: 0\n",
+			expected: firstRevision,
+		},
+		{
+			name:   "releaseRevision negative",
+			helm:   revisionHelm,
+			files:  revisionChart,
+			config: appConfig + "releaseRevision: -1\n",
+			err:    "releaseRevision must not be negative",
+		},
+	})
+}
@@ -0,0 +1,633 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/kustomize/kyaml/yaml/merge2"
+	"sigs.k8s.io/yaml"
+)
+
+// resolveValuesVars replaces the references to ValuesVars in
+// ValuesInline by the fields of ValuesVarsFiles they refer to.
+func (p *plugin) resolveValuesVars() error {
+	rm := resmap.New()
+	for _, file := range p.ValuesVarsFiles {
+		b, err := p.h.Loader().Load(file)
+		if err != nil {
+			return errors.WrapPrefixf(err, "could not load valuesVarsFiles")
+		}
+		resources, err := p.h.ResmapFactory().NewResMapFromBytes(b)
+		if err != nil {
+			return errors.WrapPrefixf(err, "could not parse valuesVarsFiles '%s'", file)
+		}
+		if err = rm.AppendAll(resources); err != nil {
+			return err
+		}
+	}
+	values := map[string]interface{}{}
+	for _, v := range p.ValuesVars {
+		v.Defaulting()
+		value, err := varValue(rm, v)
+		if err != nil {
+			return errors.WrapPrefixf(err, "could not resolve var '%s'", v.Name)
+		}
+		values[v.Name] = value
+	}
+	inline, err := substituteVars(p.ValuesInline, values)
+	if err != nil {
+		return err
+	}
+	p.ValuesInline = inline.(map[string]interface{})
+	return nil
+}
+
+// varValue returns the value of the field of the resource that v refers to.
+func varValue(rm resmap.ResMap, v types.Var) (interface{}, error) {
+	gvk := v.ObjRef.GVK()
+	for _, r := range rm.Resources() {
+		if !r.GetGvk().IsSelected(&gvk) || r.GetName() != v.ObjRef.Name ||
+			(v.ObjRef.Namespace != "" && r.GetNamespace() != v.ObjRef.Namespace) {
+			continue
+		}
+		return r.GetFieldValue(v.FieldRef.FieldPath)
+	}
+	return nil, fmt.Errorf("no resource found for objref %s/%s", gvk, v.ObjRef.Name)
+}
+
+// varRefRe matches the references to vars, capturing their names.
+var varRefRe = regexp.MustCompile(`\$\{([^}]+)\}`) //nolint:gochecknoglobals
+
+// substituteVars replaces the references to vars in the strings of
+// value, in one pass, leaving references to unknown vars as they are.
+// A string that is just a reference is replaced by the value of the
+// var, which need not be a string; otherwise the value must be a
+// scalar.
+func substituteVars(value interface{}, vars map[string]interface{}) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for _, k := range sortedKeys(v) {
+			if result[k], err = substituteVars(v[k], vars); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, e := range v {
+			if result[i], err = substituteVars(e, vars); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case string:
+		if m := varRefRe.FindStringSubmatch(v); m != nil && m[0] == v {
+			if resolved, found := vars[m[1]]; found {
+				return resolved, nil
+			}
+		}
+		return varRefRe.ReplaceAllStringFunc(v, func(ref string) string {
+			resolved, found := vars[ref[2:len(ref)-1]]
+			if !found {
+				return ref
+			}
+			switch resolved.(type) {
+			case map[string]interface{}, []interface{}:
+				if err == nil {
+					err = fmt.Errorf(
+						"var '%s' is not a scalar, so it can't be embedded in '%s'",
+						ref[2:len(ref)-1], v)
+				}
+				return ref
+			}
+			return fmt.Sprint(resolved)
+		}), err
+	default:
+		return v, nil
+	}
+}
+
+// valuesLayerFile returns the values file path, relative to the
+// kustomization root, of the given values layer.
+func (p *plugin) valuesLayerFile(layer string) string {
+	pattern := p.ValuesLayerPattern
+	if pattern == "" {
+		pattern = defaultValuesLayerPattern
+	}
+	return strings.ReplaceAll(pattern, "{layer}", layer)
+}
+
+// mergeValuesInline merges ValuesInline with the values file.  The
+// merge is done on yaml nodes, so the comments and key order of the
+// values file survive it.
+func (p *plugin) mergeValuesInline() ([]byte, error) {
+	pValues, err := p.loadValuesFile()
+	if err != nil {
+		return nil, err
+	}
+	chValues, err := kyaml.Parse(string(pValues))
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "could not parse values file into rnode")
+	}
+	inlineValues, err := kyaml.FromMap(p.ValuesInline)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "could not parse values inline into rnode")
+	}
+	var outValues *kyaml.RNode
+	switch p.ValuesMerge {
+	// Function `merge2.Merge` overrides values in dest with values from src.
+	// To achieve override or merge behavior, we pass parameters in different order.
+	// Object passed as dest will be modified, so we copy it just in case someone
+	// decides to use it after this is called.
+	case valuesMergeOptionOverride:
+		outValues, err = merge2.Merge(inlineValues, chValues.Copy(), kyaml.MergeOptions{})
+	case valuesMergeOptionMerge:
+		outValues, err = merge2.Merge(chValues, inlineValues.Copy(), kyaml.MergeOptions{})
+	}
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "could not merge values")
+	}
+	out, err := outValues.String()
+	return []byte(out), errors.WrapPrefixf(err, "could not serialize merged values")
+}
+
+// loadValuesFile reads ValuesFile.  The values file of a chart
+// extracted by kustomize into the tmp dir is outside the kustomization
+// root, so it's read directly rather than through the loader.
+func (p *plugin) loadValuesFile() ([]byte, error) {
+	if p.tmpDir != "" && strings.HasPrefix(p.ValuesFile, p.tmpDir+string(filepath.Separator)) {
+		b, err := os.ReadFile(p.ValuesFile)
+		return b, errors.WrapPrefixf(err, "unable to read chart values")
+	}
+	return p.h.Loader().Load(p.ValuesFile)
+}
+
+// usesPackagedValues returns true if no values file is configured
+// and nothing needs to be done to the chart's packaged values, so
+// that no values file has to be passed to helm.
+func (p *plugin) usesPackagedValues() bool {
+	return p.defaultValuesFile &&
+		len(p.RemoveValuesKeys) == 0 && p.DumpValuesPath == ""
+}
+
+// removeValuesKeys sets the values at the given dotted paths to null.
+func removeValuesKeys(b []byte, keys []string) ([]byte, error) {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, errors.WrapPrefixf(err, "could not parse values")
+	}
+	for _, key := range keys {
+		path := strings.Split(key, ".")
+		m := values
+		for _, field := range path[:len(path)-1] {
+			next, ok := m[field].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				m[field] = next
+			}
+			m = next
+		}
+		m[path[len(path)-1]] = nil
+	}
+	return yaml.Marshal(values)
+}
+
+// redactedValue replaces secret values in errors.
+const redactedValue = "[redacted]"
+
+// redacted returns err with the values of SecretValuesKeys replaced
+// by redactedValue, unless RedactValuesInErrors is false.
+func (p *plugin) redacted(err error) error {
+	if err == nil || len(p.SecretValuesKeys) == 0 ||
+		(p.RedactValuesInErrors != nil && !*p.RedactValuesInErrors) {
+		return err
+	}
+	msg := err.Error()
+	for _, secret := range p.secretValues() {
+		msg = strings.ReplaceAll(msg, secret, redactedValue)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return errors.Errorf("%s", msg)
+}
+
+// secretValues returns the non-empty string values of SecretValuesKeys
+// in the values given to helm, longest first, so that a secret that
+// contains another is redacted whole.  It does its best with values
+// that can't be read, as it's called on failure.
+func (p *plugin) secretValues() []string {
+	found := map[string]bool{}
+	values, _, _ := p.effectiveValues(false)
+	for _, layer := range []map[string]interface{}{values, p.ValuesInline} {
+		for _, key := range p.SecretValuesKeys {
+			var v interface{} = layer
+			for _, field := range strings.Split(key, ".") {
+				m, _ := v.(map[string]interface{})
+				v = m[field]
+			}
+			if s, isString := v.(string); isString && s != "" {
+				found[s] = true
+			}
+		}
+	}
+	for _, kv := range p.SetValues {
+		key, value, _ := strings.Cut(kv, "=")
+		for _, secret := range p.SecretValuesKeys {
+			if key == secret && value != "" && !strings.HasPrefix(value, "@") {
+				found[value] = true
+			}
+		}
+	}
+	secrets := sortedKeys(found)
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	return secrets
+}
+
+// mergeProvidedValues merges ValuesInline over the values of
+// the valuesProvider.
+func (p *plugin) mergeProvidedValues() error {
+	values, err := p.valuesProvider.Values(p.Name, p.ValuesEnvironment)
+	if err != nil {
+		return errors.WrapPrefixf(err,
+			"could not fetch values of chart '%s' for environment '%s'",
+			p.Name, p.ValuesEnvironment)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	values = copyValues(values)
+	if err = mergeValues(values, p.ValuesInline, "", false); err != nil {
+		return err
+	}
+	p.ValuesInline = values
+	return nil
+}
+
+// mergeSharedValues merges ValuesInline over SharedValuesFile
+// and SharedValues.
+func (p *plugin) mergeSharedValues() error {
+	values := map[string]interface{}{}
+	if p.SharedValuesFile != "" {
+		b, err := p.h.Loader().Load(p.SharedValuesFile)
+		if err != nil {
+			return errors.WrapPrefixf(err, "could not load sharedValuesFile")
+		}
+		if err = yaml.Unmarshal(b, &values); err != nil {
+			return errors.WrapPrefixf(err, "could not parse sharedValuesFile")
+		}
+	}
+	if err := mergeValues(values, copyValues(p.SharedValues), "", false); err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	if err := mergeValues(values, p.ValuesInline, "", false); err != nil {
+		return err
+	}
+	p.ValuesInline = values
+	return nil
+}
+
+// copyValues returns a copy of values, sharing nothing but lists
+// and scalars with it.
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if m, isMap := v.(map[string]interface{}); isMap {
+			v = copyValues(m)
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// requiredValueRegexp matches the uses of helm's 'required' function
+// on a value, capturing the message and the dotted path of the value.
+var requiredValueRegexp = regexp.MustCompile( //nolint:gochecknoglobals
+	"required\\s+(\"[^\"]*\"|`[^`]*`)\\s+\\.Values\\.([\\w.]+)")
+
+// checkRequiredValues returns an error listing the values required by
+// the chart's templates that aren't provided.
+func (p *plugin) checkRequiredValues() error {
+	required, err := p.requiredValues()
+	if err != nil {
+		return err
+	}
+	values, setKeys, err := p.effectiveValues(false)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, path := range sortedKeys(required) {
+		if !isValueProvided(values, setKeys, path) {
+			missing = append(missing, path+": "+required[path])
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("chart '%s' requires values that are not provided:\n  %s",
+			p.Name, strings.Join(missing, "\n  "))
+	}
+	return nil
+}
+
+// requiredValues maps the dotted paths of the values passed to
+// 'required' in the chart's templates to the messages given for them.
+func (p *plugin) requiredValues() (map[string]string, error) {
+	required := map[string]string{}
+	dir := filepath.Join(p.absChartHome(), p.Name, "templates")
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, m := range requiredValueRegexp.FindAllStringSubmatch(string(b), -1) {
+			required[strings.TrimSuffix(m[2], ".")] = m[1][1 : len(m[1])-1]
+		}
+		return nil
+	})
+	return required, errors.WrapPrefixf(err, "unable to read chart templates")
+}
+
+var valuesReferenceRegexp = regexp.MustCompile( //nolint:gochecknoglobals
+	"\\.Values((?:\\.\\w+)*)")
+
+// reportUnusedValues reports the keys of the provided values that
+// no template of the chart references.  A key is taken to be used
+// if a reference leads to it, or into it, or if it's the values of
+// a subchart or the global values, which aren't followed.
+func (p *plugin) reportUnusedValues() error {
+	referenced, err := p.referencedValues()
+	if err != nil {
+		return err
+	}
+	provided, err := p.providedValues()
+	if err != nil {
+		return err
+	}
+	var unused []string
+	for _, key := range provided {
+		top, _, _ := strings.Cut(key, ".")
+		if top == "global" || referenced[""] {
+			continue
+		}
+		if _, err = os.Stat(
+			filepath.Join(p.absChartHome(), p.Name, "charts", top)); err == nil {
+			continue
+		}
+		used := false
+		for ref := range referenced {
+			if key == ref || strings.HasPrefix(key, ref+".") ||
+				strings.HasPrefix(ref, key+".") {
+				used = true
+				break
+			}
+		}
+		if !used {
+			unused = append(unused, fmt.Sprintf(
+				"values key '%s' is not referenced by chart '%s'", key, p.Name))
+		}
+	}
+	return reportFindings(p.ReportUnusedValues, "unused values", unused)
+}
+
+// referencedValues returns the dotted paths of the values that the
+// chart's templates reference; the empty path stands for all values.
+func (p *plugin) referencedValues() (map[string]bool, error) {
+	referenced := map[string]bool{}
+	dir := filepath.Join(p.absChartHome(), p.Name, "templates")
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, m := range valuesReferenceRegexp.FindAllStringSubmatch(string(b), -1) {
+			referenced[strings.TrimPrefix(m[1], ".")] = true
+		}
+		return nil
+	})
+	return referenced, errors.WrapPrefixf(err, "unable to read chart templates")
+}
+
+// providedValues returns the sorted dotted paths of the values
+// provided in values files, inline and with '--set', leaving out
+// the chart's packaged values.
+func (p *plugin) providedValues() ([]string, error) {
+	flat := map[string]string{}
+	var layers [][]byte
+	if !p.defaultValuesFile {
+		b, err := p.loadValuesFile()
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, b)
+	}
+	for _, file := range p.AdditionalValuesFiles {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.WrapPrefixf(err, "unable to read values")
+		}
+		layers = append(layers, b)
+	}
+	for _, b := range layers {
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal(b, &values); err != nil {
+			return nil, errors.WrapPrefixf(err, "could not parse values")
+		}
+		flattenValues(values, "", flat)
+	}
+	flattenValues(p.ValuesInline, "", flat)
+	_, setKeys, err := p.effectiveValues(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range setKeys {
+		key, _, _ = strings.Cut(key, "[")
+		flat[key] = ""
+	}
+	return sortedKeys(flat), nil
+}
+
+// effectiveValues merges the chart's default values with the values
+// files passed to helm, in order, and collects the keys set with
+// '--set' and its variants.  If strict, a key that is a map in one
+// file and not in another is an error.
+func (p *plugin) effectiveValues(strict bool) (map[string]interface{}, []string, error) {
+	files := []string{filepath.Join(p.absChartHome(), p.Name, "values.yaml")}
+	var setKeys []string
+	args := p.AsHelmArgs(p.absChartHome())
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-f":
+			files = append(files, args[i+1])
+		case "--set", "--set-file", "--set-string":
+			key, _, _ := strings.Cut(args[i+1], "=")
+			setKeys = append(setKeys, key)
+		}
+	}
+	values := map[string]interface{}{}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.WrapPrefixf(err, "unable to read values")
+		}
+		layer := map[string]interface{}{}
+		if err = yaml.Unmarshal(b, &layer); err != nil {
+			return nil, nil, errors.WrapPrefixf(err, "could not parse values file '%s'", file)
+		}
+		if err = mergeValues(values, layer, "", strict); err != nil {
+			return nil, nil, errors.WrapPrefixf(err, "cannot merge values file '%s'", file)
+		}
+	}
+	return values, setKeys, nil
+}
+
+// writeValuesDiff writes the differences between the chart's default
+// values, as shown by helm, and the values it's inflated with to
+// ValuesDiffPath, one value per line: '+' marks an added value, '-'
+// a removed one, '~' a changed one, and '*' one set with '--set'.
+func (p *plugin) writeValuesDiff() error {
+	stdout, err := p.runHelmCommand([]string{
+		"show", "values", filepath.Join(p.absChartHome(), p.Name)})
+	if err != nil {
+		return err
+	}
+	defaults := map[string]interface{}{}
+	if err = yaml.Unmarshal(stdout, &defaults); err != nil {
+		return errors.WrapPrefixf(err, "could not parse chart default values")
+	}
+	values, setKeys, err := p.effectiveValues(false)
+	if err != nil {
+		return err
+	}
+	before, after := map[string]string{}, map[string]string{}
+	flattenValues(defaults, "", before)
+	flattenValues(values, "", after)
+	var lines []string
+	for _, key := range sortedKeys(before) {
+		v, found := after[key]
+		switch {
+		case !found:
+			lines = append(lines, "- "+key+": "+before[key])
+		case v != before[key]:
+			lines = append(lines, "~ "+key+": "+before[key]+" -> "+v)
+		}
+	}
+	for _, key := range sortedKeys(after) {
+		if _, found := before[key]; !found {
+			lines = append(lines, "+ "+key+": "+after[key])
+		}
+	}
+	for _, key := range setKeys {
+		lines = append(lines, "* "+key)
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.ValuesDiffPath, []byte(strings.Join(lines, "\n")+"\n")),
+		"failed to write values diff")
+}
+
+// flattenValues maps the dotted paths of the values that aren't
+// maps to their JSON representation.
+func flattenValues(values map[string]interface{}, prefix string, out map[string]string) {
+	for k, v := range values {
+		if m, isMap := v.(map[string]interface{}); isMap && len(m) > 0 {
+			flattenValues(m, prefix+k+".", out)
+			continue
+		}
+		b, _ := json.Marshal(v)
+		out[prefix+k] = string(b)
+	}
+}
+
+// mergeValues merges src into dst as helm merges values files:
+// maps are merged recursively, and null removes a key.  If strict,
+// replacing a map by a scalar, or vice versa, is an error.
+func mergeValues(dst, src map[string]interface{}, prefix string, strict bool) error {
+	for k, v := range src {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			if err := mergeValues(dstMap, srcMap, prefix+k+".", strict); err != nil {
+				return err
+			}
+			continue
+		}
+		if strict && dst[k] != nil && srcIsMap != dstIsMap {
+			return fmt.Errorf(
+				"values key '%s' is %s, but was %s in an earlier values file",
+				prefix+k, valueShape(srcIsMap), valueShape(dstIsMap))
+		}
+		dst[k] = v
+	}
+	return nil
+}
+
+// valueShape describes a value in the errors of mergeValues.
+func valueShape(isMap bool) string {
+	if isMap {
+		return "a map"
+	}
+	return "not a map"
+}
+
+// isValueProvided returns true if the value at the dotted path is
+// neither missing nor empty, as helm's 'required' demands, or if it,
+// or a value within it, is set with '--set'.
+func isValueProvided(values map[string]interface{}, setKeys []string, path string) bool {
+	for _, key := range setKeys {
+		if key == path || strings.HasPrefix(key, path+".") || strings.HasPrefix(key, path+"[") {
+			return true
+		}
+	}
+	var v interface{} = values
+	for _, field := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		v = m[field]
+	}
+	return v != nil && v != ""
+}
+
+// dumpValues copies the values file given to helm to DumpValuesPath.
+func (p *plugin) dumpValues() error {
+	b, err := os.ReadFile(p.ValuesFile)
+	if err != nil {
+		return errors.WrapPrefixf(err, "unable to read values")
+	}
+	return errors.WrapPrefixf(
+		p.writeOutput(p.DumpValuesPath, b),
+		"failed to dump values")
+}
@@ -0,0 +1,667 @@
+// Copyright 2024 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/ifc"
+	"sigs.k8s.io/kustomize/api/resmap"
+	kusttest_test "sigs.k8s.io/kustomize/api/testutils/kusttest"
+)
+
+// fakeValuesProvider provides values by environment.
+type fakeValuesProvider map[string]map[string]interface{}
+
+func (f fakeValuesProvider) Values(chart, environment string) (map[string]interface{}, error) {
+	if chart != "app" {
+		return nil, fmt.Errorf("unknown chart '%s'", chart)
+	}
+	return f[environment], nil
+}
+
+func TestHelmChartInflationGeneratorValues(t *testing.T) {
+	appConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+releaseName: test
+chartHome: ./charts
+`
+	// The fake 'helm template' names the ConfigMap after the
+	// 'env' of the values file it's given.
+	chartValuesFileHelm := `if [ "$1" = "template" ]; then
+  while [ "$1" != "-f" ]; do shift; done
+  printf 'apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n' "$(sed -n 's/^env: //p' "$2")"
+  exit 0
+fi
+` + fakeHelmPreamble
+	chartValuesFileConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: examples
+name: examples
+chartTarball: examples-1.0.0.tgz
+`
+	writeExamplesTarball := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		writeChartTarball(t, filepath.Join(th.GetRoot(), "examples-1.0.0.tgz"), map[string]string{
+			"examples/Chart.yaml":       "apiVersion: v2\nname: examples\nversion: 1.0.0\n",
+			"examples/values.yaml":      "env: default\n",
+			"examples/values-prod.yaml": "env: prod\n",
+		})
+	}
+	logTemplateArgsHelm := `[ "$1" = "template" ] && echo "$@" > "$root/templates.log"
+` + fakeHelmPreamble
+	dbConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: db
+name: db
+chartTarball: db-1.0.0.tgz
+`
+	writeDBTarball := func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+		t.Helper()
+		writeChartTarball(t, filepath.Join(th.GetRoot(), "db-1.0.0.tgz"), map[string]string{
+			"db/Chart.yaml": "apiVersion: v2\nname: db\nversion: 1.0.0\n",
+			"db/values.yaml": `auth:
+  user: admin
+  password: changeme
+`,
+		})
+	}
+	needyChart := map[string]string{
+		"charts/needy/Chart.yaml": `
+apiVersion: v2
+name: needy
+version: 1.0.0
+`,
+		"charts/needy/values.yaml": `
+image:
+  tag: ""
+db:
+  host: localhost
+`,
+		"charts/needy/templates/cm.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: needy
+data:
+  tag: {{ required "image.tag must be set" .Values.image.tag }}
+  host: {{ required "db.host must be set" .Values.db.host }}
+  password: {{ required "db.password must be set" .Values.db.password | quote }}
+`,
+	}
+	needyConfig := `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: needy
+name: needy
+releaseName: test
+chartHome: ./charts
+precheckRequired: true
+`
+	strictValuesMergeFiles := map[string]string{
+		"charts/app/Chart.yaml": "name: app\n",
+		"charts/app/values.yaml": `
+image:
+  repository: nginx
+  tag: "1.25"
+`,
+		"override.yaml": `
+image: nginx:1.26
+`,
+	}
+	strictValuesMergeConfig := appConfig + `
+additionalValuesFiles:
+- override.yaml
+`
+	valuesVarsFiles := map[string]string{
+		"charts/app/Chart.yaml":  "name: app\n",
+		"charts/app/values.yaml": "{}\n",
+		"db.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: db
+spec:
+  clusterIP: 10.0.0.42
+  ports:
+  - port: 5432
+`,
+	}
+	unusedValuesFiles := map[string]string{
+		"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 1.0.0
+`,
+		"charts/app/values.yaml": `
+replicaCount: 1
+image:
+  repository: app
+  tag: v1
+`,
+		"charts/app/templates/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  replicas: {{ .Values.replicaCount }}
+  template:
+    spec:
+      containers:
+      - name: app
+        image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+        resources: {{- toYaml $.Values.resources | nindent 10 }}
+`,
+	}
+	unusedValuesConfig := appConfig + `
+valuesInline:
+  replicaCout: 2
+  image:
+    tag: v2
+  resources:
+    limits:
+      cpu: 100m
+setValues:
+- imge.repository=nginx
+`
+	redactingHelm := `if [ "$1" = "template" ]; then
+  echo "Error: execution error: invalid database url" >&2
+  cat "$(echo "$@" | sed 's/.*-f \([^ ]*\).*/\1/')" >&2
+  exit 1
+fi
+` + fakeHelmPreamble
+	redactingConfig := testChartConfig + `
+valuesInline:
+  db:
+    user: admin
+    password: hunter2
+setValues:
+- apiToken=s3cr3t-t0ken
+secretValuesKeys:
+- db.password
+- apiToken
+`
+
+	runGeneratorCases(t, []generatorCase{
+		{
+			name:     "valuesLayers",
+			realHelm: true,
+			files: map[string]string{
+				"layers/base.yaml": `
+a: 10
+b: 10
+map:
+  a: 10
+`,
+				"layers/region.yaml": `
+b: 20
+c: 20
+`,
+				"layers/cluster.yaml": `
+c: 30
+map:
+  a: 30
+`,
+			},
+			config: `
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: values-merge
+name: values-merge
+releaseName: values-merge
+valuesLayers:
+- base
+- region
+- cluster
+valuesLayerPattern: layers/{layer}.yaml
+`,
+			expected: `
+apiVersion: test.kustomize.io/v1
+kind: ValuesMergeTest
+metadata:
+  name: values-merge
+obj:
+  a: 10
+  b: 20
+  c: 30
+  list:
+  - a
+  - b
+  map:
+    a: 30
+    b: 5
+    c: null
+`,
+		},
+		{
+			name:   "chartValuesFile",
+			helm:   chartValuesFileHelm,
+			setup:  writeExamplesTarball,
+			config: chartValuesFileConfig + "chartValuesFile: values-prod.yaml\n",
+			expected: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: prod
+`,
+		},
+		{
+			name:   "chartValuesFile not in the chart",
+			helm:   chartValuesFileHelm,
+			setup:  writeExamplesTarball,
+			config: chartValuesFileConfig + "chartValuesFile: values-dev.yaml\n",
+			err:    "chartValuesFile 'values-dev.yaml' not found in chart 'examples'",
+		},
+		{
+			name:   "chartValuesFile outside the chart",
+			helm:   chartValuesFileHelm,
+			setup:  writeExamplesTarball,
+			config: chartValuesFileConfig + "chartValuesFile: ../values.yaml\n",
+			err:    "must be a path within the chart",
+		},
+		{
+			name:  "setValues",
+			helm:  logTemplateArgsHelm,
+			files: map[string]string{"files/app.conf": "debug = true"},
+			config: testChartConfig + `
+setValues:
+- replicas=3
+- config=@files/app.conf
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "templates.log"))
+				require.NoError(t, err)
+				assert.Contains(t, string(b), "--set replicas=3 --set-file config="+
+					filepath.Join(th.GetRoot(), "files", "app.conf"))
+			},
+		},
+		{
+			name: "setValues with a missing file",
+			helm: logTemplateArgsHelm,
+			config: testChartConfig + `
+setValues:
+- config=@files/missing.conf
+`,
+			err: "could not load file for setValues key 'config'",
+		},
+		{
+			name: "removeValuesKeys",
+			helm: `if [ "$1" = "template" ]; then
+  while [ "$1" != "-f" ]; do shift; done
+  cp "$2" "$root/values.log"
+fi
+` + fakeHelmPreamble,
+			setup: writeDBTarball,
+			config: dbConfig + `
+removeValuesKeys:
+- auth.password
+- tls.key
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "values.log"))
+				require.NoError(t, err)
+				assert.Equal(t, `auth:
+  password: null
+  user: admin
+tls:
+  key: null
+`, string(b))
+			},
+		},
+		{
+			name:  "invalid removeValuesKeys",
+			setup: writeDBTarball,
+			config: dbConfig + `
+removeValuesKeys:
+- auth..password
+`,
+			err: "invalid removeValuesKeys entry 'auth..password'",
+		},
+		{
+			name:   "precheckRequired",
+			files:  needyChart,
+			config: needyConfig,
+			err: "chart 'needy' requires values that are not provided:\n" +
+				"  db.password: db.password must be set\n" +
+				"  image.tag: image.tag must be set",
+		},
+		{
+			name:  "precheckRequired with the values",
+			files: needyChart,
+			config: needyConfig + `
+valuesInline:
+  image:
+    tag: v1
+setValues:
+- db.password=secret
+`,
+			check: generates(1),
+		},
+		{
+			name:   "no strictValuesMerge",
+			files:  strictValuesMergeFiles,
+			config: strictValuesMergeConfig,
+			check:  generates(1),
+		},
+		{
+			name:  "strictValuesMerge",
+			files: strictValuesMergeFiles,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(strictValuesMergeConfig + "strictValuesMerge: true\n")
+				require.Error(t, err)
+				assert.Contains(t, err.Error(),
+					"values key 'image' is not a map, but was a map in an earlier values file")
+				assert.Contains(t, err.Error(), "override.yaml")
+			},
+		},
+		{
+			name: "dumpValuesPath",
+			files: map[string]string{
+				"charts/app/Chart.yaml": "name: app\n",
+				"charts/app/values.yaml": `# Number of pods.
+replicas: 1
+# The image to run.
+image:
+  # Where to pull the image from.
+  repository: nginx
+  tag: "1.25" # pinned
+`,
+			},
+			config: appConfig + `
+dumpValuesPath: values.dump.yaml
+valuesInline:
+  replicas: 3
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "values.dump.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `# Number of pods.
+replicas: 3
+# The image to run.
+image:
+  # Where to pull the image from.
+  repository: nginx
+  tag: "1.25" # pinned
+`, string(b))
+			},
+		},
+		{
+			name: "valuesDiffPath",
+			helm: `if [ "$1" = "show" ] && [ "$2" = "values" ]; then
+  cat "$3/values.yaml"
+  exit 0
+fi
+` + fakeHelmPreamble,
+			files: map[string]string{
+				"charts/app/Chart.yaml": "name: app\n",
+				"charts/app/values.yaml": `
+replicas: 1
+image:
+  repository: nginx
+  tag: "1.25"
+debug: false
+`,
+				"prod.yaml": `
+image:
+  tag: "1.26"
+debug: null
+resources:
+  limits:
+    cpu: 1
+`,
+			},
+			config: appConfig + `
+additionalValuesFiles:
+- prod.yaml
+setValues:
+- replicas=3
+valuesDiffPath: values.diff
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "values.diff"))
+				require.NoError(t, err)
+				assert.Equal(t, `- debug: false
+~ image.tag: "1.25" -> "1.26"
++ resources.limits.cpu: 1
+* replicas
+`, string(b))
+			},
+		},
+		{
+			name: "valuesMatrix",
+			helm: `if [ "$1" = "template" ]; then
+  values=""
+  prev=""
+  for arg in "$@"; do
+    [ "$prev" = "-f" ] && values="$arg"
+    prev="$arg"
+  done
+  printf 'apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  values.yaml: |\n' "$2"
+  sed 's/^/    /' "$values"
+  exit 0
+fi
+` + fakeHelmPreamble,
+			setup: func(t *testing.T, th *kusttest_test.HarnessEnhanced) {
+				writeChartTarball(t, filepath.Join(th.GetRoot(), "app-1.0.0.tgz"), map[string]string{
+					"app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+					"app/values.yaml": "replicas: 1\nimage:\n  tag: latest\n",
+				})
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				g := th.LoadGenerator(`
+apiVersion: builtin
+kind: HelmChartInflationGenerator
+metadata:
+  name: app
+name: app
+releaseName: test
+chartTarball: app-1.0.0.tgz
+valuesInline:
+  image:
+    tag: v1
+valuesMatrix:
+- replicas: 2
+- replicas: 3
+  image:
+    tag: v2
+`)
+				m, ok := g.(interface {
+					GenerateMatrix() ([]resmap.ResMap, error)
+				})
+				require.True(t, ok)
+				rms, err := m.GenerateMatrix()
+				require.NoError(t, err)
+				require.Len(t, rms, 2)
+				values := func(rm resmap.ResMap) string {
+					return rm.Resources()[0].GetDataMap()["values.yaml"]
+				}
+				assert.Equal(t, "replicas: 2\nimage:\n  tag: v1\n", values(rms[0]))
+				assert.Equal(t, "replicas: 3\nimage:\n  tag: v2\n", values(rms[1]))
+			},
+		},
+		{
+			name:  "valuesVars",
+			files: valuesVarsFiles,
+			config: appConfig + `
+dumpValuesPath: values.dump.yaml
+valuesVarsFiles:
+- db.yaml
+valuesVars:
+- name: DB_IP
+  objref:
+    kind: Service
+    name: db
+    apiVersion: v1
+  fieldref:
+    fieldPath: spec.clusterIP
+- name: DB_PORT
+  objref:
+    kind: Service
+    name: db
+  fieldref:
+    fieldPath: spec.ports[0].port
+- name: DB
+  objref:
+    kind: Service
+    name: db
+- name: DB_PORTS
+  objref:
+    kind: Service
+    name: db
+  fieldref:
+    fieldPath: spec.ports
+valuesInline:
+  database:
+    url: postgres://${DB_IP}:${DB_PORT}/app
+    host: ${DB}.${DB_IP}.${UNKNOWN}
+    port: ${DB_PORT}
+    ports: ${DB_PORTS}
+`,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "values.dump.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, `database:
+  host: db.10.0.0.42.${UNKNOWN}
+  port: 5432
+  ports:
+  - port: 5432
+  url: postgres://10.0.0.42:5432/app
+`, string(b))
+			},
+		},
+		{
+			name:  "valuesVars embedding a non-scalar",
+			files: valuesVarsFiles,
+			config: appConfig + `
+valuesVarsFiles:
+- db.yaml
+valuesVars:
+- name: DB_PORTS
+  objref:
+    kind: Service
+    name: db
+  fieldref:
+    fieldPath: spec.ports
+valuesInline:
+  ports: "ports: ${DB_PORTS}"
+`,
+			err: "var 'DB_PORTS' is not a scalar, so it can't be embedded in 'ports: ${DB_PORTS}'",
+		},
+		{
+			name:  "valuesVars referring to a missing object",
+			files: valuesVarsFiles,
+			config: appConfig + `
+valuesVarsFiles:
+- db.yaml
+valuesVars:
+- name: CACHE_IP
+  objref:
+    kind: Service
+    name: cache
+`,
+			err: "could not resolve var 'CACHE_IP'",
+		},
+		{
+			name: "chart without a values file",
+			helm: logTemplateArgsHelm,
+			files: map[string]string{
+				"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 1.0.0
+`,
+			},
+			config: appConfig,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, rm resmap.ResMap) {
+				assert.Equal(t, 1, rm.Size())
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "templates.log"))
+				require.NoError(t, err)
+				assert.NotContains(t, string(b), "-f ")
+			},
+		},
+		{
+			name:   "reportUnusedValues error",
+			files:  unusedValuesFiles,
+			config: unusedValuesConfig + "reportUnusedValues: error\n",
+			err: "found unused values: " +
+				"values key 'imge.repository' is not referenced by chart 'app'; " +
+				"values key 'replicaCout' is not referenced by chart 'app'",
+		},
+		{
+			name:   "reportUnusedValues warn",
+			files:  unusedValuesFiles,
+			config: unusedValuesConfig + "reportUnusedValues: warn\n",
+			check:  generates(1),
+		},
+		{
+			name: "values provider",
+			files: map[string]string{
+				"charts/app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+				"charts/app/values.yaml": "replicas: 1\nfeatures:\n  search: false\n",
+			},
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				g := th.LoadGenerator(appConfig + `
+dumpValuesPath: values.dump.yaml
+valuesEnvironment: staging
+valuesInline:
+  replicas: 2
+`)
+				s, ok := g.(interface {
+					SetValuesProvider(ifc.ValuesProvider)
+				})
+				require.True(t, ok)
+				s.SetValuesProvider(fakeValuesProvider{
+					"staging": {
+						"replicas": 5,
+						"features": map[string]interface{}{"search": true},
+					},
+				})
+				_, err := g.Generate()
+				require.NoError(t, err)
+				b, err := os.ReadFile(filepath.Join(th.GetRoot(), "values.dump.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, "replicas: 2\nfeatures:\n  search: true\n", string(b))
+			},
+		},
+		{
+			name: "redactValuesInErrors",
+			helm: redactingHelm,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(redactingConfig)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "user: admin")
+				assert.Contains(t, err.Error(), "password: [redacted]")
+				assert.Contains(t, err.Error(), "--set apiToken=[redacted]")
+				assert.NotContains(t, err.Error(), "hunter2")
+				assert.NotContains(t, err.Error(), "s3cr3t-t0ken")
+			},
+		},
+		{
+			name: "redactValuesInErrors false",
+			helm: redactingHelm,
+			check: func(t *testing.T, th *kusttest_test.HarnessEnhanced, _ resmap.ResMap) {
+				err := th.ErrorFromLoadAndRunGenerator(redactingConfig + "redactValuesInErrors: false\n")
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "hunter2")
+				assert.Contains(t, err.Error(), "s3cr3t-t0ken")
+			},
+		},
+	})
+}